@@ -1,10 +1,14 @@
 package core
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 type Config struct {
@@ -17,22 +21,195 @@ type Config struct {
 }
 
 type LabConfig struct {
-	DefaultImage     string            `json:"defaultImage" yaml:"defaultImage"`
-	PodNamePrefix    string            `json:"podNamePrefix" yaml:"podNamePrefix"`
-	ContainerName    string            `json:"containerName" yaml:"containerName"`
-	Command          []string          `json:"command" yaml:"command"`
-	PodResources     ResourceConfig    `json:"resources" yaml:"resources"`
-	EnvVars          map[string]string `json:"envVars" yaml:"envVars"`
-	Privileged       bool              `json:"privileged" yaml:"privileged"`
-	TemplatesDir     string            `json:"templatesDir" yaml:"templatesDir"`
-	ContentMountPath string            `json:"contentMountPath" yaml:"contentMountPath"`
+	DefaultImage      string             `json:"defaultImage" yaml:"defaultImage"`
+	PodNamePrefix     string             `json:"podNamePrefix" yaml:"podNamePrefix"`
+	ContainerName     string             `json:"containerName" yaml:"containerName"`
+	Command           []string           `json:"command" yaml:"command"`
+	PodResources      ResourceConfig     `json:"resources" yaml:"resources"`
+	EnvVars           map[string]string  `json:"envVars" yaml:"envVars"`
+	Privileged        bool               `json:"privileged" yaml:"privileged"`
+	TemplatesDir      string             `json:"templatesDir" yaml:"templatesDir"`
+	ContentMountPath  string             `json:"contentMountPath" yaml:"contentMountPath"`
+	Backend           string             `json:"backend" yaml:"backend"`           // "kubernetes" ou "local"
+	LocalWorkDir      string             `json:"localWorkDir" yaml:"localWorkDir"` // Diretório dos laboratórios no backend local
+	WarmPool          WarmPoolConfig     `json:"warmPool" yaml:"warmPool"`
+	Security          SecurityConfig     `json:"security" yaml:"security"`
+	Workspace         WorkspaceConfig    `json:"workspace" yaml:"workspace"`
+	Snapshot          SnapshotConfig     `json:"snapshot" yaml:"snapshot"`
+	Extensions        ExtensionConfig    `json:"extensions" yaml:"extensions"`
+	Network           NetworkConfig      `json:"network" yaml:"network"`
+	Quota             QuotaConfig        `json:"quota" yaml:"quota"`
+	DisableQuotas     bool               `json:"disableQuotas" yaml:"disableQuotas"` // Não instala ResourceQuota/LimitRange
+	Access            AccessConfig       `json:"access" yaml:"access"`
+	Scheduling        SchedulingSettings `json:"scheduling" yaml:"scheduling"` // Padrões de agendamento, combinados com os do template
+	Prepull           PrepullConfig      `json:"prepull" yaml:"prepull"`
+	TemplateReload    string             `json:"templateReload" yaml:"templateReload"` // Intervalo de releitura dos templates ("0" desabilita)
+	Capacity          CapacityConfig     `json:"capacity" yaml:"capacity"`
+	ExistingLabPolicy string             `json:"existingLabPolicy" yaml:"existingLabPolicy"` // Laboratório de outro template em execução: "reject" ou "replace"
+	Reset             ResetConfig        `json:"reset" yaml:"reset"`
+	DisableCache      bool               `json:"disableCache" yaml:"disableCache"` // Lê pods e namespaces direto da API, sem informers
+	Operator          OperatorConfig     `json:"operator" yaml:"operator"`
+	GC                GCConfig           `json:"gc" yaml:"gc"`
+}
+
+// GCConfig controla a coleta de namespaces, ConfigMaps e pods órfãos
+type GCConfig struct {
+	Disabled    bool   `json:"disabled" yaml:"disabled"`
+	Interval    string `json:"interval" yaml:"interval"`       // Intervalo entre as coletas
+	GracePeriod string `json:"gracePeriod" yaml:"gracePeriod"` // Tempo que um recurso fica órfão antes de ser removido
+	DryRun      bool   `json:"dryRun" yaml:"dryRun"`           // Coletas periódicas apenas relatam o que seria removido
+}
+
+// OperatorConfig controla o reconciliador de recursos GirusLab
+type OperatorConfig struct {
+	Enabled           bool `json:"enabled" yaml:"enabled"`
+	DisableCRDInstall bool `json:"disableCRDInstall" yaml:"disableCRDInstall"` // Não cria o CRD giruslabs.girus.io na inicialização
+	Workers           int  `json:"workers" yaml:"workers"`
+}
+
+// ResetConfig controla o reinício de laboratórios a partir do template
+type ResetConfig struct {
+	Disabled bool   `json:"disabled" yaml:"disabled"`
+	Timer    string `json:"timer" yaml:"timer"` // "keep" (padrão) preserva o timer; "restart" o reinicia
+}
+
+// CapacityConfig limita quantos laboratórios existem ao mesmo tempo. Pedidos
+// além dos limites aguardam em fila. Limites zerados não se aplicam.
+type CapacityConfig struct {
+	MaxLabs               int            `json:"maxLabs" yaml:"maxLabs"`                             // Total de laboratórios entregues
+	MaxPerUser            int            `json:"maxPerUser" yaml:"maxPerUser"`                       // Laboratórios por usuário
+	MaxPerOrg             int            `json:"maxPerOrg" yaml:"maxPerOrg"`                         // Laboratórios por organização
+	MaxPerTemplate        map[string]int `json:"maxPerTemplate" yaml:"maxPerTemplate"`               // Laboratórios por template
+	DefaultMaxPerTemplate int            `json:"defaultMaxPerTemplate" yaml:"defaultMaxPerTemplate"` // Limite dos templates sem entrada em MaxPerTemplate
+	QueueSize             int            `json:"queueSize" yaml:"queueSize"`                         // Máximo de pedidos aguardando (0 = sem limite)
+	MaxWait               string         `json:"maxWait" yaml:"maxWait"`                             // Espera máxima na fila (vazio = sem limite)
+}
+
+// PrepullConfig define o DaemonSet que baixa as imagens dos templates nos nós
+type PrepullConfig struct {
+	Enabled      bool              `json:"enabled" yaml:"enabled"`
+	Namespace    string            `json:"namespace" yaml:"namespace"`       // Namespace do DaemonSet (padrão: namespace do backend)
+	HelperImage  string            `json:"helperImage" yaml:"helperImage"`   // Imagem com busybox estático, copiado para as imagens sem shell
+	PauseImage   string            `json:"pauseImage" yaml:"pauseImage"`     // Contêiner que mantém o pod no nó
+	NodeSelector map[string]string `json:"nodeSelector" yaml:"nodeSelector"` // Nós que recebem as imagens (padrão: todos)
+}
+
+// AccessConfig define a credencial do cluster entregue a cada laboratório
+type AccessConfig struct {
+	Disabled  bool   `json:"disabled" yaml:"disabled"`   // Não cria ServiceAccount nem kubeconfig nos laboratórios
+	APIServer string `json:"apiServer" yaml:"apiServer"` // Endereço da API usado no kubeconfig (padrão: o do backend)
+	TokenTTL  string `json:"tokenTTL" yaml:"tokenTTL"`   // Validade dos tokens emitidos
+	MountPath string `json:"mountPath" yaml:"mountPath"` // Diretório do kubeconfig no contêiner do laboratório
+}
+
+// NetworkConfig define o isolamento de rede dos namespaces de laboratório
+type NetworkConfig struct {
+	DisablePolicies  bool     `json:"disablePolicies" yaml:"disablePolicies"`   // Não instala NetworkPolicies
+	BackendNamespace string   `json:"backendNamespace" yaml:"backendNamespace"` // Namespace do backend, que acessa as portas dos laboratórios
+	ClusterCIDRs     []string `json:"clusterCIDRs" yaml:"clusterCIDRs"`         // Faixas bloqueadas na saída padrão (pods, serviços, nós)
+	MirrorCIDRs      []string `json:"mirrorCIDRs" yaml:"mirrorCIDRs"`           // Espelhos de pacotes liberados com allowMirrors
+}
+
+// ExtensionConfig define os limites padrão de extensão de tempo dos laboratórios
+type ExtensionConfig struct {
+	Step             string   `json:"step" yaml:"step"`                         // Tempo concedido por extensão (ex.: "15m")
+	MaxCount         int      `json:"maxCount" yaml:"maxCount"`                 // Máximo de extensões por laboratório
+	MaxTotalDuration string   `json:"maxTotalDuration" yaml:"maxTotalDuration"` // Duração total máxima com extensões (vazio = sem limite)
+	InstructorRoles  []string `json:"instructorRoles" yaml:"instructorRoles"`   // Papéis que ignoram os limites
+	TrustRoleHeader  bool     `json:"trustRoleHeader" yaml:"trustRoleHeader"`   // Aceita o papel do cabeçalho X-Girus-Role
+}
+
+// SnapshotConfig define onde e como os snapshots dos laboratórios são guardados
+type SnapshotConfig struct {
+	Enabled      bool     `json:"enabled" yaml:"enabled"`
+	Dir          string   `json:"dir" yaml:"dir"`                   // Diretório do armazenamento local de snapshots
+	DefaultPaths []string `json:"defaultPaths" yaml:"defaultPaths"` // Caminhos salvos quando o template não declara os seus
+	MaxSize      string   `json:"maxSize" yaml:"maxSize"`           // Tamanho máximo de um snapshot (ex.: "512Mi")
+}
+
+// WorkspaceConfig define os workspaces persistentes dos usuários
+type WorkspaceConfig struct {
+	Enabled      bool   `json:"enabled" yaml:"enabled"`
+	Scope        string `json:"scope" yaml:"scope"` // "user" (um por usuário) ou "user-template" (um por usuário e template)
+	MountPath    string `json:"mountPath" yaml:"mountPath"`
+	Size         string `json:"size" yaml:"size"`
+	MaxSize      string `json:"maxSize" yaml:"maxSize"` // Maior tamanho que um template pode solicitar
+	StorageClass string `json:"storageClass" yaml:"storageClass"`
+	RetainDays   int    `json:"retainDays" yaml:"retainDays"` // Dias sem uso antes da remoção (0 = indefinidamente)
+}
+
+// SecurityConfig define a política de segurança aplicada a todos os laboratórios
+type SecurityConfig struct {
+	ForbidEscalation bool   `json:"forbidEscalation" yaml:"forbidEscalation"` // Recusa laboratórios que pedem privilégios ou capabilities
+	RuntimeClassName string `json:"runtimeClassName" yaml:"runtimeClassName"` // RuntimeClass padrão (ex.: gvisor, kata)
+}
+
+// WarmPoolConfig define quantos laboratórios pré-provisionados manter por template
+type WarmPoolConfig struct {
+	Enabled           bool           `json:"enabled" yaml:"enabled"`
+	MinIdle           map[string]int `json:"minIdle" yaml:"minIdle"`                     // Mínimo de laboratórios ociosos por template
+	DefaultMinIdle    int            `json:"defaultMinIdle" yaml:"defaultMinIdle"`       // Mínimo para templates sem entrada em MinIdle
+	MaxTotal          int            `json:"maxTotal" yaml:"maxTotal"`                   // Máximo de laboratórios ociosos no total (0 = sem limite)
+	ReplenishInterval string         `json:"replenishInterval" yaml:"replenishInterval"` // Formato: "30s", "1m", etc.
 }
 
 type ResourceConfig struct {
-	CpuRequest    string `json:"cpuRequest" yaml:"cpuRequest"`
-	CpuLimit      string `json:"cpuLimit" yaml:"cpuLimit"`
-	MemoryRequest string `json:"memoryRequest" yaml:"memoryRequest"`
-	MemoryLimit   string `json:"memoryLimit" yaml:"memoryLimit"`
+	CpuRequest              string `json:"cpuRequest" yaml:"cpuRequest"`
+	CpuLimit                string `json:"cpuLimit" yaml:"cpuLimit"`
+	MemoryRequest           string `json:"memoryRequest" yaml:"memoryRequest"`
+	MemoryLimit             string `json:"memoryLimit" yaml:"memoryLimit"`
+	EphemeralStorageRequest string `json:"ephemeralStorageRequest,omitempty" yaml:"ephemeralStorageRequest"`
+	EphemeralStorageLimit   string `json:"ephemeralStorageLimit,omitempty" yaml:"ephemeralStorageLimit"`
+}
+
+// builtinPodResources são os recursos usados quando nem o template nem a configuração os definem
+var builtinPodResources = ResourceConfig{
+	CpuRequest:    "200m",
+	CpuLimit:      "500m",
+	MemoryRequest: "512Mi",
+	MemoryLimit:   "1Gi",
+}
+
+// validate verifica se todas as quantidades definidas podem ser interpretadas
+func (r ResourceConfig) validate() error {
+	fields := []struct {
+		name  string
+		value string
+	}{
+		{"cpuRequest", r.CpuRequest},
+		{"cpuLimit", r.CpuLimit},
+		{"memoryRequest", r.MemoryRequest},
+		{"memoryLimit", r.MemoryLimit},
+		{"ephemeralStorageRequest", r.EphemeralStorageRequest},
+		{"ephemeralStorageLimit", r.EphemeralStorageLimit},
+	}
+	for _, field := range fields {
+		if field.value == "" {
+			continue
+		}
+		if _, err := resource.ParseQuantity(field.value); err != nil {
+			return fmt.Errorf("quantidade inválida em %s (%q): %v", field.name, field.value, err)
+		}
+	}
+	return nil
+}
+
+// merge completa os campos vazios de r com os valores de defaults
+func (r ResourceConfig) merge(defaults ResourceConfig) ResourceConfig {
+	pick := func(value, fallback string) string {
+		if value != "" {
+			return value
+		}
+		return fallback
+	}
+	return ResourceConfig{
+		CpuRequest:              pick(r.CpuRequest, defaults.CpuRequest),
+		CpuLimit:                pick(r.CpuLimit, defaults.CpuLimit),
+		MemoryRequest:           pick(r.MemoryRequest, defaults.MemoryRequest),
+		MemoryLimit:             pick(r.MemoryLimit, defaults.MemoryLimit),
+		EphemeralStorageRequest: pick(r.EphemeralStorageRequest, defaults.EphemeralStorageRequest),
+		EphemeralStorageLimit:   pick(r.EphemeralStorageLimit, defaults.EphemeralStorageLimit),
+	}
 }
 
 func NewConfig() *Config {
@@ -76,15 +253,296 @@ func LoadConfig() (*Config, error) {
 		}
 	}
 	if config.Lab.TemplatesDir == "" {
-		config.Lab.TemplatesDir = "/tmp/lab-templates"
+		config.Lab.TemplatesDir = getEnv("GIRUS_TEMPLATES_DIR", "/tmp/lab-templates")
 	}
 	if config.Lab.ContentMountPath == "" {
 		config.Lab.ContentMountPath = "/lab"
 	}
+	if config.Lab.Backend == "" {
+		config.Lab.Backend = getEnv("GIRUS_LAB_BACKEND", "kubernetes")
+	}
+	if config.Lab.LocalWorkDir == "" {
+		config.Lab.LocalWorkDir = getEnv("GIRUS_LOCAL_WORKDIR", filepath.Join(os.TempDir(), "girus-labs"))
+	}
+
+	if config.Lab.PodResources == (ResourceConfig{}) {
+		config.Lab.PodResources = ResourceConfig{
+			CpuRequest:              getEnv("GIRUS_LAB_CPU_REQUEST", ""),
+			CpuLimit:                getEnv("GIRUS_LAB_CPU_LIMIT", ""),
+			MemoryRequest:           getEnv("GIRUS_LAB_MEMORY_REQUEST", ""),
+			MemoryLimit:             getEnv("GIRUS_LAB_MEMORY_LIMIT", ""),
+			EphemeralStorageRequest: getEnv("GIRUS_LAB_EPHEMERAL_STORAGE_REQUEST", ""),
+			EphemeralStorageLimit:   getEnv("GIRUS_LAB_EPHEMERAL_STORAGE_LIMIT", ""),
+		}
+	}
+	if err := config.Lab.PodResources.validate(); err != nil {
+		log.Printf("Recursos padrão dos laboratórios inválidos, usando valores embutidos: %v", err)
+		config.Lab.PodResources = ResourceConfig{}
+	}
+	if !config.Lab.Security.ForbidEscalation {
+		config.Lab.Security.ForbidEscalation = getEnv("GIRUS_LAB_FORBID_ESCALATION", "false") == "true"
+	}
+	if config.Lab.Security.RuntimeClassName == "" {
+		config.Lab.Security.RuntimeClassName = getEnv("GIRUS_LAB_RUNTIME_CLASS", "")
+	}
+	if !config.Lab.Workspace.Enabled {
+		config.Lab.Workspace.Enabled = getEnv("GIRUS_WORKSPACE_ENABLED", "false") == "true"
+	}
+	if config.Lab.Workspace.Scope == "" {
+		config.Lab.Workspace.Scope = getEnv("GIRUS_WORKSPACE_SCOPE", "user")
+	}
+	if config.Lab.Workspace.MountPath == "" {
+		config.Lab.Workspace.MountPath = getEnv("GIRUS_WORKSPACE_MOUNT_PATH", "/workspace")
+	}
+	if config.Lab.Workspace.Size == "" {
+		config.Lab.Workspace.Size = getEnv("GIRUS_WORKSPACE_SIZE", "1Gi")
+	}
+	if config.Lab.Workspace.MaxSize == "" {
+		config.Lab.Workspace.MaxSize = getEnv("GIRUS_WORKSPACE_MAX_SIZE", "5Gi")
+	}
+	if config.Lab.Workspace.StorageClass == "" {
+		config.Lab.Workspace.StorageClass = getEnv("GIRUS_WORKSPACE_STORAGE_CLASS", "")
+	}
+	if config.Lab.Workspace.RetainDays == 0 {
+		config.Lab.Workspace.RetainDays, _ = strconv.Atoi(getEnv("GIRUS_WORKSPACE_RETAIN_DAYS", "7"))
+	}
+	if config.Lab.Workspace.Enabled {
+		if config.Lab.Workspace.Scope != "user" && config.Lab.Workspace.Scope != "user-template" {
+			log.Printf("Escopo de workspace inválido %q, usando \"user\"", config.Lab.Workspace.Scope)
+			config.Lab.Workspace.Scope = "user"
+		}
+		for _, size := range []string{config.Lab.Workspace.Size, config.Lab.Workspace.MaxSize} {
+			if _, err := resource.ParseQuantity(size); err != nil {
+				log.Printf("Tamanho de workspace inválido %q, workspaces desabilitados: %v", size, err)
+				config.Lab.Workspace.Enabled = false
+			}
+		}
+	}
+	if !config.Lab.Snapshot.Enabled {
+		config.Lab.Snapshot.Enabled = getEnv("GIRUS_SNAPSHOTS_ENABLED", "false") == "true"
+	}
+	if config.Lab.Snapshot.Dir == "" {
+		config.Lab.Snapshot.Dir = getEnv("GIRUS_SNAPSHOT_DIR", "/var/lib/girus/snapshots")
+	}
+	if len(config.Lab.Snapshot.DefaultPaths) == 0 {
+		config.Lab.Snapshot.DefaultPaths = strings.Split(getEnv("GIRUS_SNAPSHOT_PATHS", "/root,/home"), ",")
+	}
+	if config.Lab.Snapshot.MaxSize == "" {
+		config.Lab.Snapshot.MaxSize = getEnv("GIRUS_SNAPSHOT_MAX_SIZE", "512Mi")
+	}
+	if _, err := resource.ParseQuantity(config.Lab.Snapshot.MaxSize); err != nil {
+		log.Printf("Tamanho máximo de snapshot inválido %q, usando 512Mi: %v", config.Lab.Snapshot.MaxSize, err)
+		config.Lab.Snapshot.MaxSize = "512Mi"
+	}
+	if config.Lab.Extensions.Step == "" {
+		config.Lab.Extensions.Step = getEnv("GIRUS_LAB_EXTENSION_STEP", "15m")
+	}
+	if config.Lab.Extensions.MaxCount == 0 {
+		config.Lab.Extensions.MaxCount, _ = strconv.Atoi(getEnv("GIRUS_LAB_EXTENSION_MAX_COUNT", "2"))
+	}
+	if config.Lab.Extensions.MaxTotalDuration == "" {
+		config.Lab.Extensions.MaxTotalDuration = getEnv("GIRUS_LAB_EXTENSION_MAX_TOTAL", "")
+	}
+	if len(config.Lab.Extensions.InstructorRoles) == 0 {
+		config.Lab.Extensions.InstructorRoles = strings.Split(getEnv("GIRUS_INSTRUCTOR_ROLES", "instructor,admin"), ",")
+	}
+	if !config.Lab.Extensions.TrustRoleHeader {
+		config.Lab.Extensions.TrustRoleHeader = getEnv("GIRUS_TRUST_ROLE_HEADER", "false") == "true"
+	}
+	if err := (&ExtensionSettings{Step: config.Lab.Extensions.Step, MaxTotalDuration: config.Lab.Extensions.MaxTotalDuration}).validate(); err != nil {
+		log.Printf("Configuração de extensões inválida, usando 15m sem limite total: %v", err)
+		config.Lab.Extensions.Step = "15m"
+		config.Lab.Extensions.MaxTotalDuration = ""
+	}
+	if !config.Lab.Network.DisablePolicies {
+		config.Lab.Network.DisablePolicies = getEnv("GIRUS_NETWORK_POLICIES", "true") == "false"
+	}
+	if config.Lab.Network.BackendNamespace == "" {
+		config.Lab.Network.BackendNamespace = getEnv("GIRUS_BACKEND_NAMESPACE", "girus")
+	}
+	if len(config.Lab.Network.ClusterCIDRs) == 0 {
+		config.Lab.Network.ClusterCIDRs = splitList(getEnv("GIRUS_CLUSTER_CIDRS", "10.0.0.0/8,172.16.0.0/12,192.168.0.0/16,169.254.0.0/16,fc00::/7"))
+	}
+	if len(config.Lab.Network.MirrorCIDRs) == 0 {
+		config.Lab.Network.MirrorCIDRs = splitList(getEnv("GIRUS_MIRROR_CIDRS", ""))
+	}
+	for _, cidrs := range [][]string{config.Lab.Network.ClusterCIDRs, config.Lab.Network.MirrorCIDRs} {
+		if err := (&NetworkSettings{Egress: cidrEgressRules(cidrs)}).validate(); err != nil {
+			log.Printf("Configuração de rede inválida, NetworkPolicies desabilitadas: %v", err)
+			config.Lab.Network.DisablePolicies = true
+		}
+	}
+	if !config.Lab.DisableQuotas {
+		config.Lab.DisableQuotas = getEnv("GIRUS_LAB_QUOTAS", "true") == "false"
+	}
+	for env, field := range map[string]*string{
+		"GIRUS_QUOTA_PODS":                   &config.Lab.Quota.Pods,
+		"GIRUS_QUOTA_CPU":                    &config.Lab.Quota.CPU,
+		"GIRUS_QUOTA_MEMORY":                 &config.Lab.Quota.Memory,
+		"GIRUS_QUOTA_PVCS":                   &config.Lab.Quota.PersistentVolumeClaims,
+		"GIRUS_QUOTA_STORAGE":                &config.Lab.Quota.Storage,
+		"GIRUS_QUOTA_LOADBALANCERS":          &config.Lab.Quota.LoadBalancers,
+		"GIRUS_QUOTA_NODEPORTS":              &config.Lab.Quota.NodePorts,
+		"GIRUS_LIMIT_DEFAULT_CPU":            &config.Lab.Quota.DefaultCPU,
+		"GIRUS_LIMIT_DEFAULT_MEMORY":         &config.Lab.Quota.DefaultMemory,
+		"GIRUS_LIMIT_DEFAULT_REQUEST_CPU":    &config.Lab.Quota.DefaultRequestCPU,
+		"GIRUS_LIMIT_DEFAULT_REQUEST_MEMORY": &config.Lab.Quota.DefaultRequestMemory,
+		"GIRUS_LIMIT_MAX_CPU":                &config.Lab.Quota.MaxCPU,
+		"GIRUS_LIMIT_MAX_MEMORY":             &config.Lab.Quota.MaxMemory,
+	} {
+		if *field == "" {
+			*field = getEnv(env, "")
+		}
+	}
+	if err := config.Lab.Quota.validate(); err != nil {
+		log.Printf("Cota de laboratório inválida, usando valores padrão: %v", err)
+		config.Lab.Quota = QuotaConfig{}
+	}
+	if !config.Lab.Access.Disabled {
+		config.Lab.Access.Disabled = getEnv("GIRUS_LAB_KUBECONFIG", "true") == "false"
+	}
+	if config.Lab.Access.APIServer == "" {
+		config.Lab.Access.APIServer = getEnv("GIRUS_LAB_API_SERVER", "")
+	}
+	if config.Lab.Access.TokenTTL == "" {
+		config.Lab.Access.TokenTTL = getEnv("GIRUS_LAB_TOKEN_TTL", "2h")
+	}
+	if config.Lab.Access.MountPath == "" {
+		config.Lab.Access.MountPath = getEnv("GIRUS_LAB_KUBECONFIG_PATH", "/root/.kube")
+	}
+	if err := (&KubeAccessSettings{TokenTTL: config.Lab.Access.TokenTTL, MountPath: config.Lab.Access.MountPath}).validate(); err != nil {
+		log.Printf("Configuração de acesso inválida, usando valores padrão: %v", err)
+		config.Lab.Access.TokenTTL = "2h"
+		config.Lab.Access.MountPath = "/root/.kube"
+	}
+	if len(config.Lab.Scheduling.NodeSelector) == 0 {
+		config.Lab.Scheduling.NodeSelector = parseNodeSelector(getEnv("GIRUS_LAB_NODE_SELECTOR", ""))
+	}
+	if len(config.Lab.Scheduling.Tolerations) == 0 {
+		config.Lab.Scheduling.Tolerations = parseTolerations(getEnv("GIRUS_LAB_TOLERATIONS", ""))
+	}
+	if config.Lab.Scheduling.AntiAffinity == "" {
+		config.Lab.Scheduling.AntiAffinity = getEnv("GIRUS_LAB_ANTI_AFFINITY", "")
+	}
+	if config.Lab.Scheduling.PriorityClassName == "" {
+		config.Lab.Scheduling.PriorityClassName = getEnv("GIRUS_LAB_PRIORITY_CLASS", "")
+	}
+	if err := config.Lab.Scheduling.validate(); err != nil {
+		log.Printf("Configuração de agendamento inválida, usando padrões do cluster: %v", err)
+		config.Lab.Scheduling = SchedulingSettings{}
+	}
+	if !config.Lab.Prepull.Enabled {
+		config.Lab.Prepull.Enabled = getEnv("GIRUS_IMAGE_PREPULL", "false") == "true"
+	}
+	if config.Lab.Prepull.Namespace == "" {
+		config.Lab.Prepull.Namespace = getEnv("GIRUS_PREPULL_NAMESPACE", config.Lab.Network.BackendNamespace)
+	}
+	if config.Lab.Prepull.HelperImage == "" {
+		config.Lab.Prepull.HelperImage = getEnv("GIRUS_PREPULL_HELPER_IMAGE", "busybox:1.36")
+	}
+	if config.Lab.Prepull.PauseImage == "" {
+		config.Lab.Prepull.PauseImage = getEnv("GIRUS_PREPULL_PAUSE_IMAGE", "registry.k8s.io/pause:3.9")
+	}
+	if len(config.Lab.Prepull.NodeSelector) == 0 {
+		config.Lab.Prepull.NodeSelector = parseNodeSelector(getEnv("GIRUS_PREPULL_NODE_SELECTOR", ""))
+	}
+	if config.Lab.TemplateReload == "" {
+		config.Lab.TemplateReload = getEnv("GIRUS_TEMPLATE_RELOAD_INTERVAL", "1m")
+	}
+	if !config.Lab.DisableCache {
+		config.Lab.DisableCache = getEnv("GIRUS_LAB_CACHE", "true") == "false"
+	}
+	if !config.Lab.GC.Disabled {
+		config.Lab.GC.Disabled = getEnv("GIRUS_LAB_GC", "true") == "false"
+	}
+	if config.Lab.GC.Interval == "" {
+		config.Lab.GC.Interval = getEnv("GIRUS_LAB_GC_INTERVAL", "10m")
+	}
+	if config.Lab.GC.GracePeriod == "" {
+		config.Lab.GC.GracePeriod = getEnv("GIRUS_LAB_GC_GRACE_PERIOD", "30m")
+	}
+	if !config.Lab.GC.DryRun {
+		config.Lab.GC.DryRun = getEnv("GIRUS_LAB_GC_DRY_RUN", "false") == "true"
+	}
+	if !config.Lab.Operator.Enabled {
+		config.Lab.Operator.Enabled = getEnv("GIRUS_OPERATOR", "false") == "true"
+	}
+	if !config.Lab.Operator.DisableCRDInstall {
+		config.Lab.Operator.DisableCRDInstall = getEnv("GIRUS_OPERATOR_INSTALL_CRD", "true") == "false"
+	}
+	if config.Lab.Operator.Workers <= 0 {
+		config.Lab.Operator.Workers, _ = strconv.Atoi(getEnv("GIRUS_OPERATOR_WORKERS", "2"))
+		if config.Lab.Operator.Workers <= 0 {
+			config.Lab.Operator.Workers = 1
+		}
+	}
+	if !config.Lab.Reset.Disabled {
+		config.Lab.Reset.Disabled = getEnv("GIRUS_LAB_RESET", "true") == "false"
+	}
+	if config.Lab.Reset.Timer == "" {
+		config.Lab.Reset.Timer = getEnv("GIRUS_LAB_RESET_TIMER", ResetTimerKeep)
+	}
+	if config.Lab.ExistingLabPolicy == "" {
+		config.Lab.ExistingLabPolicy = getEnv("GIRUS_EXISTING_LAB_POLICY", ExistingLabReplace)
+	}
+	if config.Lab.Capacity.MaxLabs == 0 {
+		config.Lab.Capacity.MaxLabs, _ = strconv.Atoi(getEnv("GIRUS_MAX_LABS", "0"))
+	}
+	if config.Lab.Capacity.MaxPerUser == 0 {
+		config.Lab.Capacity.MaxPerUser, _ = strconv.Atoi(getEnv("GIRUS_MAX_LABS_PER_USER", "0"))
+	}
+	if config.Lab.Capacity.MaxPerOrg == 0 {
+		config.Lab.Capacity.MaxPerOrg, _ = strconv.Atoi(getEnv("GIRUS_MAX_LABS_PER_ORG", "0"))
+	}
+	if config.Lab.Capacity.MaxPerTemplate == nil {
+		config.Lab.Capacity.MaxPerTemplate = parseMinIdle(getEnv("GIRUS_MAX_LABS_PER_TEMPLATE", ""))
+	}
+	if config.Lab.Capacity.DefaultMaxPerTemplate == 0 {
+		config.Lab.Capacity.DefaultMaxPerTemplate, _ = strconv.Atoi(getEnv("GIRUS_DEFAULT_MAX_LABS_PER_TEMPLATE", "0"))
+	}
+	if config.Lab.Capacity.QueueSize == 0 {
+		config.Lab.Capacity.QueueSize, _ = strconv.Atoi(getEnv("GIRUS_LAB_QUEUE_SIZE", "500"))
+	}
+	if config.Lab.Capacity.MaxWait == "" {
+		config.Lab.Capacity.MaxWait = getEnv("GIRUS_LAB_QUEUE_MAX_WAIT", "1h")
+	}
+	if !config.Lab.WarmPool.Enabled {
+		config.Lab.WarmPool.Enabled = getEnv("GIRUS_WARM_POOL_ENABLED", "false") == "true"
+	}
+	if config.Lab.WarmPool.MinIdle == nil {
+		config.Lab.WarmPool.MinIdle = parseMinIdle(getEnv("GIRUS_WARM_POOL_MIN_IDLE", ""))
+	}
+	if config.Lab.WarmPool.DefaultMinIdle == 0 {
+		config.Lab.WarmPool.DefaultMinIdle, _ = strconv.Atoi(getEnv("GIRUS_WARM_POOL_DEFAULT_MIN_IDLE", "0"))
+	}
+	if config.Lab.WarmPool.MaxTotal == 0 {
+		config.Lab.WarmPool.MaxTotal, _ = strconv.Atoi(getEnv("GIRUS_WARM_POOL_MAX_TOTAL", "10"))
+	}
+	if config.Lab.WarmPool.ReplenishInterval == "" {
+		config.Lab.WarmPool.ReplenishInterval = getEnv("GIRUS_WARM_POOL_INTERVAL", "30s")
+	}
 
 	return config, nil
 }
 
+// parseMinIdle interpreta a lista "template=quantidade,template=quantidade"
+func parseMinIdle(value string) map[string]int {
+	minIdle := make(map[string]int)
+	for _, entry := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		count, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			log.Printf("Quantidade inválida para o warm pool do template %s: %v", parts[0], err)
+			continue
+		}
+		minIdle[strings.TrimSpace(parts[0])] = count
+	}
+	return minIdle
+}
+
 func GetLabImage() string {
 	// Primeiro tenta ler da variável de ambiente
 	if envImage := os.Getenv("LAB_DEFAULT_IMAGE"); envImage != "" {
@@ -101,34 +559,13 @@ func GetLabImage() string {
 	return "ubuntu:latest"
 }
 
-// GetImageForTemplate seleciona a imagem apropriada para o template
-func GetImageForTemplate(templateName string, customImage string) string {
-	// Se uma imagem personalizada for especificada, usá-la
-	if customImage != "" {
-		log.Printf("Usando imagem personalizada %s para o template %s", customImage, templateName)
-		return customImage
-	}
-
-	// Se o template for relacionado a Kubernetes, usar a imagem pré-configurada
-	if strings.Contains(templateName, "kubernetes") {
-		// Usar a imagem padrão para Kubernetes que já está configurada
-		return "linuxtips/girus-kind-multi-node:0.1"
-	}
-
-	// Para templates "default", também podemos usar a imagem Kubernetes
-	if templateName == "default" {
-		log.Printf("Usando imagem linuxtips/girus-kind-multi-node:0.1 para o template default")
-		return "linuxtips/girus-kind-multi-node:0.1"
-	}
-
-	// Para templates Linux, Terraform e Docker, usar a imagem DevOps
-	if strings.Contains(strings.ToLower(templateName), "linux") ||
-		strings.Contains(strings.ToLower(templateName), "terraform") ||
-		strings.Contains(strings.ToLower(templateName), "docker") {
-		log.Printf("Usando imagem linuxtips/girus-devops:0.1 para o template %s", templateName)
-		return "linuxtips/girus-devops:0.1"
+// splitList separa uma lista de valores por vírgula, ignorando itens vazios
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
-
-	// Para outros templates, usar a imagem padrão
-	return GetLabImage()
+	return items
 }
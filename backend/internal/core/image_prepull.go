@@ -0,0 +1,374 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	// prepullName é o nome do DaemonSet que mantém as imagens dos templates nos nós
+	prepullName = "girus-image-prepull"
+	// prepullBinDir recebe o busybox estático usado para encerrar cada contêiner de
+	// imagem, já que as imagens de laboratório nem sempre têm um shell
+	prepullBinDir = "/girus-prepull"
+	// prepullResyncInterval reaplica o DaemonSet caso ele tenha sido alterado ou removido
+	prepullResyncInterval = 5 * time.Minute
+)
+
+// Estados de uma imagem em um nó
+const (
+	imageStatePulled  = "pulled"
+	imageStatePulling = "pulling"
+	imageStatePending = "pending"
+	imageStateError   = "error"
+)
+
+// imagePullErrors são os motivos de espera que indicam falha no download da imagem
+var imagePullErrors = map[string]bool{
+	"ErrImagePull":     true,
+	"ImagePullBackOff": true,
+	"InvalidImageName": true,
+}
+
+// ImagePrepuller mantém um DaemonSet que baixa em todos os nós as imagens
+// referenciadas pelos templates, para que o primeiro laboratório de cada nó
+// não espere o download
+type ImagePrepuller struct {
+	lm      *LabManager
+	cfg     PrepullConfig
+	mu      sync.Mutex
+	images  []string
+	trigger chan struct{}
+}
+
+// ImagePullState é o estado de uma imagem em um nó
+type ImagePullState struct {
+	Image   string `json:"image"`
+	State   string `json:"state"`
+	Message string `json:"message,omitempty"`
+}
+
+// NodePrepullStatus resume as imagens de um nó
+type NodePrepullStatus struct {
+	Node   string           `json:"node"`
+	Images []ImagePullState `json:"images"`
+}
+
+// TemplateWarmth indica em quantos nós todas as imagens do template já estão presentes
+type TemplateWarmth struct {
+	Template   string   `json:"template"`
+	Images     []string `json:"images"`
+	WarmNodes  int      `json:"warmNodes"`
+	TotalNodes int      `json:"totalNodes"`
+	Warm       bool     `json:"warm"`
+}
+
+// PrepullStatus resume o pré-download de imagens no cluster
+type PrepullStatus struct {
+	Enabled   bool                `json:"enabled"`
+	Images    []string            `json:"images"`
+	Nodes     []NodePrepullStatus `json:"nodes"`
+	Templates []TemplateWarmth    `json:"templates"`
+}
+
+// NewImagePrepuller cria o gerenciador de pré-download do LabManager
+func NewImagePrepuller(lm *LabManager, cfg PrepullConfig) *ImagePrepuller {
+	return &ImagePrepuller{
+		lm:      lm,
+		cfg:     cfg,
+		trigger: make(chan struct{}, 1),
+	}
+}
+
+// Start aplica o DaemonSet e o atualiza sempre que os templates mudam
+func (p *ImagePrepuller) Start(ctx context.Context) {
+	p.lm.templates.Subscribe(func() {
+		select {
+		case p.trigger <- struct{}{}:
+		default:
+		}
+	})
+	log.Printf("Iniciando pré-download de imagens no namespace %s", p.cfg.Namespace)
+
+	go func() {
+		ticker := time.NewTicker(prepullResyncInterval)
+		defer ticker.Stop()
+
+		p.sync()
+		for {
+			select {
+			case <-ticker.C:
+				p.sync()
+			case <-p.trigger:
+				p.sync()
+			case <-ctx.Done():
+				log.Printf("Pré-download de imagens encerrado")
+				return
+			}
+		}
+	}()
+}
+
+// templateImages retorna as imagens usadas por um template: o runtime e os sidecars
+func templateImages(template *LabTemplate) []string {
+	images := []string{}
+	if runtime, err := ResolveRuntime(template); err == nil && runtime.Image != "" {
+		images = append(images, runtime.Image)
+	}
+	for _, sidecar := range template.Sidecars {
+		images = append(images, sidecar.Image)
+	}
+	return images
+}
+
+// wantedImages retorna as imagens de todos os templates, sem repetição e em ordem estável
+func (p *ImagePrepuller) wantedImages() []string {
+	seen := map[string]bool{}
+	images := []string{}
+	for _, template := range p.lm.templates.ListTemplates() {
+		for _, image := range templateImages(template) {
+			if !seen[image] {
+				seen[image] = true
+				images = append(images, image)
+			}
+		}
+	}
+	sort.Strings(images)
+	return images
+}
+
+// daemonSet monta o DaemonSet de pré-download. Cada imagem vira um init
+// container que apenas executa o busybox copiado para um volume compartilhado;
+// o contêiner principal é um pause que mantém o pod (e as imagens) no nó.
+func (p *ImagePrepuller) daemonSet(images []string) *appsv1.DaemonSet {
+	labels := map[string]string{"app": prepullName, "createdBy": "girus"}
+	small := v1.ResourceRequirements{
+		Requests: v1.ResourceList{
+			v1.ResourceCPU:    resource.MustParse("10m"),
+			v1.ResourceMemory: resource.MustParse("16Mi"),
+		},
+		Limits: v1.ResourceList{
+			v1.ResourceCPU:    resource.MustParse("100m"),
+			v1.ResourceMemory: resource.MustParse("64Mi"),
+		},
+	}
+	binMount := []v1.VolumeMount{{Name: "prepull-bin", MountPath: prepullBinDir}}
+
+	initContainers := []v1.Container{{
+		Name:         "prepull-helper",
+		Image:        p.cfg.HelperImage,
+		Command:      []string{"/bin/cp", "/bin/busybox", prepullBinDir + "/busybox"},
+		Resources:    small,
+		VolumeMounts: binMount,
+	}}
+	for i, image := range images {
+		initContainers = append(initContainers, v1.Container{
+			Name:            fmt.Sprintf("prepull-%d", i),
+			Image:           image,
+			ImagePullPolicy: v1.PullIfNotPresent,
+			Command:         []string{prepullBinDir + "/busybox", "true"},
+			Resources:       small,
+			VolumeMounts:    binMount,
+		})
+	}
+
+	maxUnavailable := intstr.FromString("100%")
+	return &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      prepullName,
+			Namespace: p.cfg.Namespace,
+			Labels:    labels,
+		},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": prepullName}},
+			// Todos os pods são atualizados juntos: o pré-download não atende usuários
+			UpdateStrategy: appsv1.DaemonSetUpdateStrategy{
+				Type:          appsv1.RollingUpdateDaemonSetStrategyType,
+				RollingUpdate: &appsv1.RollingUpdateDaemonSet{MaxUnavailable: &maxUnavailable},
+			},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: v1.PodSpec{
+					InitContainers: initContainers,
+					Containers: []v1.Container{{
+						Name:      "pause",
+						Image:     p.cfg.PauseImage,
+						Resources: small,
+					}},
+					Volumes: []v1.Volume{{
+						Name:         "prepull-bin",
+						VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}},
+					}},
+					NodeSelector: p.cfg.NodeSelector,
+					// Os nós dedicados a laboratórios costumam ter taints
+					Tolerations:                   []v1.Toleration{{Operator: v1.TolerationOpExists}},
+					AutomountServiceAccountToken:  new(bool),
+					TerminationGracePeriodSeconds: new(int64),
+				},
+			},
+		},
+	}
+}
+
+// sync cria ou atualiza o DaemonSet com as imagens dos templates carregados
+func (p *ImagePrepuller) sync() {
+	images := p.wantedImages()
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+
+	client := p.lm.clientset.AppsV1().DaemonSets(p.cfg.Namespace)
+	wanted := p.daemonSet(images)
+	existing, err := client.Get(ctx, prepullName, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		_, err = client.Create(ctx, wanted, metav1.CreateOptions{})
+	case err == nil:
+		existing.Labels = wanted.Labels
+		existing.Spec.Template = wanted.Spec.Template
+		existing.Spec.UpdateStrategy = wanted.Spec.UpdateStrategy
+		_, err = client.Update(ctx, existing, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		log.Printf("[Prepull] Erro ao aplicar o DaemonSet de pré-download: %v", err)
+		return
+	}
+
+	p.mu.Lock()
+	changed := strings.Join(p.images, ",") != strings.Join(images, ",")
+	p.images = images
+	p.mu.Unlock()
+	if changed {
+		log.Printf("[Prepull] DaemonSet de pré-download atualizado com %d imagens: %s", len(images), strings.Join(images, ", "))
+	}
+}
+
+// imageNames retorna os nomes possíveis de uma imagem, com e sem o registro padrão
+func imageNames(image string) []string {
+	names := []string{image}
+	if !strings.Contains(image, ":") && !strings.Contains(image, "@") {
+		image += ":latest"
+		names = append(names, image)
+	}
+	first := strings.SplitN(image, "/", 2)[0]
+	if !strings.ContainsAny(first, ".:") && first != "localhost" {
+		if !strings.Contains(image, "/") {
+			names = append(names, "docker.io/library/"+image)
+		} else {
+			names = append(names, "docker.io/"+image)
+		}
+	}
+	return names
+}
+
+// Status retorna o estado das imagens em cada nó que executa o pré-download
+func (p *ImagePrepuller) Status() (*PrepullStatus, error) {
+	p.mu.Lock()
+	images := append([]string{}, p.images...)
+	p.mu.Unlock()
+
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+	pods, err := p.lm.clientset.CoreV1().Pods(p.cfg.Namespace).List(ctx, metav1.ListOptions{LabelSelector: "app=" + prepullName})
+	if err != nil {
+		return nil, fmt.Errorf("erro ao listar pods de pré-download: %v", err)
+	}
+
+	// As imagens presentes em cada nó complementam o estado dos init containers,
+	// que fica desatualizado enquanto o pod é recriado após uma mudança
+	nodeImages := map[string]map[string]bool{}
+	if nodes, err := p.lm.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{}); err == nil {
+		for _, node := range nodes.Items {
+			present := map[string]bool{}
+			for _, image := range node.Status.Images {
+				for _, name := range image.Names {
+					present[name] = true
+				}
+			}
+			nodeImages[node.Name] = present
+		}
+	}
+
+	status := &PrepullStatus{Enabled: true, Images: images, Nodes: []NodePrepullStatus{}, Templates: []TemplateWarmth{}}
+	pulledOn := map[string]map[string]bool{} // nó -> imagem -> presente
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName == "" {
+			continue
+		}
+		node := NodePrepullStatus{Node: pod.Spec.NodeName, Images: []ImagePullState{}}
+		pulledOn[node.Node] = map[string]bool{}
+
+		specImages := map[string]string{}
+		for _, container := range pod.Spec.InitContainers {
+			specImages[container.Name] = container.Image
+		}
+		containerStates := map[string]v1.ContainerStatus{}
+		for _, containerStatus := range pod.Status.InitContainerStatuses {
+			containerStates[specImages[containerStatus.Name]] = containerStatus
+		}
+
+		for _, image := range images {
+			state := ImagePullState{Image: image, State: imageStatePending}
+			containerStatus, ok := containerStates[image]
+			switch {
+			case ok && containerStatus.State.Terminated != nil:
+				state.State = imageStatePulled
+			case ok && containerStatus.State.Running != nil:
+				state.State = imageStatePulled
+			case ok && containerStatus.State.Waiting != nil:
+				switch reason := containerStatus.State.Waiting.Reason; {
+				case imagePullErrors[reason]:
+					state.State = imageStateError
+					state.Message = containerStatus.State.Waiting.Message
+				case reason == "CrashLoopBackOff":
+					// A imagem foi baixada, mas o contêiner não encerrou com sucesso
+					state.State = imageStatePulled
+					state.Message = containerStatus.State.Waiting.Message
+				case reason != "PodInitializing":
+					state.State = imageStatePulling
+				}
+			}
+			if state.State != imageStatePulled {
+				for _, name := range imageNames(image) {
+					if nodeImages[node.Node][name] {
+						state.State = imageStatePulled
+						state.Message = ""
+						break
+					}
+				}
+			}
+			pulledOn[node.Node][image] = state.State == imageStatePulled
+			node.Images = append(node.Images, state)
+		}
+		status.Nodes = append(status.Nodes, node)
+	}
+	sort.Slice(status.Nodes, func(i, j int) bool { return status.Nodes[i].Node < status.Nodes[j].Node })
+
+	for _, template := range p.lm.templates.ListTemplates() {
+		warmth := TemplateWarmth{Template: template.Name, Images: templateImages(template), TotalNodes: len(pulledOn)}
+		for _, pulled := range pulledOn {
+			warm := true
+			for _, image := range warmth.Images {
+				warm = warm && pulled[image]
+			}
+			if warm {
+				warmth.WarmNodes++
+			}
+		}
+		warmth.Warm = warmth.TotalNodes > 0 && warmth.WarmNodes == warmth.TotalNodes
+		status.Templates = append(status.Templates, warmth)
+	}
+	sort.Slice(status.Templates, func(i, j int) bool { return status.Templates[i].Template < status.Templates[j].Template })
+	return status, nil
+}
@@ -0,0 +1,158 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// KubernetesBackend executa os laboratórios como pods em um cluster Kubernetes
+type KubernetesBackend struct {
+	clientset *kubernetes.Clientset
+	config    *rest.Config
+}
+
+// loadClusterConfig obtém a configuração do cluster (in-cluster ou kubeconfig local)
+func loadClusterConfig() (*rest.Config, error) {
+	config, err := rest.InClusterConfig()
+	if err == nil {
+		return config, nil
+	}
+
+	// Fallback para desenvolvimento local
+	kubeconfig := os.Getenv("KUBECONFIG")
+	if kubeconfig == "" {
+		kubeconfig = filepath.Join(os.Getenv("HOME"), ".kube", "config")
+	}
+	config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		log.Printf("Erro ao carregar kubeconfig: %v", err)
+		return nil, fmt.Errorf("falha ao obter configuração do cluster: %v", err)
+	}
+	log.Printf("Usando kubeconfig: %s", kubeconfig)
+	return config, nil
+}
+
+// NewKubernetesBackend conecta ao cluster e cria o backend Kubernetes
+func NewKubernetesBackend() (*KubernetesBackend, error) {
+	config, err := loadClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		log.Printf("Erro ao criar clientset: %v", err)
+		return nil, fmt.Errorf("falha ao criar cliente Kubernetes: %v", err)
+	}
+
+	// Verificar conexão com o cluster
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+	_, err = clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("erro ao conectar ao cluster Kubernetes: %v", err)
+	}
+	log.Printf("Conexão com o cluster estabelecida com sucesso")
+
+	return &KubernetesBackend{
+		clientset: clientset,
+		config:    config,
+	}, nil
+}
+
+// Name retorna o identificador do backend
+func (b *KubernetesBackend) Name() string {
+	return "kubernetes"
+}
+
+// Clientset retorna o cliente do cluster
+func (b *KubernetesBackend) Clientset() kubernetes.Interface {
+	return b.clientset
+}
+
+// RESTConfig retorna a configuração usada para acessar o cluster
+func (b *KubernetesBackend) RESTConfig() *rest.Config {
+	return b.config
+}
+
+// DynamicClient retorna o cliente dos recursos customizados do cluster
+func (b *KubernetesBackend) DynamicClient() (dynamic.Interface, error) {
+	return dynamic.NewForConfig(b.config)
+}
+
+// CreateLab cria o pod do laboratório no cluster
+func (b *KubernetesBackend) CreateLab(ctx context.Context, pod *v1.Pod) (*v1.Pod, error) {
+	return b.clientset.CoreV1().Pods(pod.Namespace).Create(ctx, pod, metav1.CreateOptions{})
+}
+
+// GetLab obtém o pod do laboratório no cluster
+func (b *KubernetesBackend) GetLab(ctx context.Context, namespace, name string) (*v1.Pod, error) {
+	return b.clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+// ListLabs lista os pods de um namespace no cluster
+func (b *KubernetesBackend) ListLabs(ctx context.Context, namespace string, opts metav1.ListOptions) ([]v1.Pod, error) {
+	podList, err := b.clientset.CoreV1().Pods(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return podList.Items, nil
+}
+
+// DeleteLab exclui o pod do laboratório no cluster
+func (b *KubernetesBackend) DeleteLab(ctx context.Context, namespace, name string, opts metav1.DeleteOptions) error {
+	return b.clientset.CoreV1().Pods(namespace).Delete(ctx, name, opts)
+}
+
+// Exec executa um comando no pod usando o subrecurso exec
+func (b *KubernetesBackend) Exec(ctx context.Context, pod *v1.Pod, opts ExecOptions) error {
+	req := b.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(pod.Name).
+		Namespace(pod.Namespace).
+		SubResource("exec")
+
+	req.VersionedParams(&v1.PodExecOptions{
+		Container: opts.Container,
+		Command:   opts.Command,
+		Stdin:     opts.Stdin != nil,
+		Stdout:    opts.Stdout != nil,
+		Stderr:    opts.Stderr != nil && !opts.TTY,
+		TTY:       opts.TTY,
+	}, scheme.ParameterCodec)
+
+	exec, err := remotecommand.NewSPDYExecutor(b.config, "POST", req.URL())
+	if err != nil {
+		log.Printf("Erro ao criar executor SPDY: %v", err)
+		return fmt.Errorf("erro ao criar executor: %v", err)
+	}
+
+	streamOptions := remotecommand.StreamOptions{
+		Stdin:             opts.Stdin,
+		Stdout:            opts.Stdout,
+		Tty:               opts.TTY,
+		TerminalSizeQueue: opts.TerminalSizeQueue,
+	}
+	if !opts.TTY {
+		streamOptions.Stderr = opts.Stderr
+	}
+	return exec.StreamWithContext(ctx, streamOptions)
+}
+
+// AttachTerminal abre uma sessão interativa com TTY no pod
+func (b *KubernetesBackend) AttachTerminal(ctx context.Context, pod *v1.Pod, opts ExecOptions) error {
+	opts.TTY = true
+	return b.Exec(ctx, pod, opts)
+}
@@ -0,0 +1,352 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// labAccessName é o nome da ServiceAccount, Role e RoleBinding do laboratório
+	labAccessName = "girus-lab"
+	// kubeconfigSecretName é o Secret com o kubeconfig montado no contêiner do laboratório
+	kubeconfigSecretName = "girus-kubeconfig"
+	// tokenExpiresAtAnnotation registra no Secret a expiração do token atual
+	tokenExpiresAtAnnotation = "girus.io/token-expires-at"
+	// minTokenTTL é a menor validade aceita pela API TokenRequest
+	minTokenTTL = 10 * time.Minute
+)
+
+// KubeAccessSettings define o acesso do aluno à API do Kubernetes a partir do
+// laboratório. O acesso é sempre restrito ao namespace do laboratório.
+type KubeAccessSettings struct {
+	Disabled  bool         `json:"disabled,omitempty" yaml:"disabled"`   // Não injeta kubeconfig no laboratório
+	Rules     []AccessRule `json:"rules,omitempty" yaml:"rules"`         // Vazio = regras padrão
+	TokenTTL  string       `json:"tokenTTL,omitempty" yaml:"tokenTTL"`   // Validade do token (padrão: configuração)
+	MountPath string       `json:"mountPath,omitempty" yaml:"mountPath"` // Diretório do kubeconfig (padrão: configuração)
+}
+
+// AccessRule concede verbos sobre recursos do namespace do laboratório
+type AccessRule struct {
+	APIGroups []string `json:"apiGroups" yaml:"apiGroups"` // "" = grupo core
+	Resources []string `json:"resources" yaml:"resources"`
+	Verbs     []string `json:"verbs" yaml:"verbs"`
+}
+
+// defaultAccessRules são as permissões de laboratórios que não declaram regras
+var defaultAccessRules = []AccessRule{
+	{
+		APIGroups: []string{""},
+		Resources: []string{"pods", "pods/log", "pods/exec", "pods/portforward", "services", "endpoints", "configmaps", "secrets", "persistentvolumeclaims", "serviceaccounts", "events"},
+		Verbs:     []string{"get", "list", "watch", "create", "update", "patch", "delete"},
+	},
+	{
+		APIGroups: []string{"apps", "batch", "autoscaling", "networking.k8s.io"},
+		Resources: []string{"deployments", "replicasets", "statefulsets", "daemonsets", "jobs", "cronjobs", "horizontalpodautoscalers", "ingresses"},
+		Verbs:     []string{"get", "list", "watch", "create", "update", "patch", "delete"},
+	},
+	{
+		APIGroups: []string{""},
+		Resources: []string{"resourcequotas", "limitranges"},
+		Verbs:     []string{"get", "list", "watch"},
+	},
+}
+
+// protectedResources são os recursos que isolam o laboratório e que o aluno não pode alterar
+var protectedResources = map[string]bool{
+	"*":               true,
+	"roles":           true,
+	"rolebindings":    true,
+	"resourcequotas":  true,
+	"limitranges":     true,
+	"networkpolicies": true,
+	"namespaces":      true,
+}
+
+// validate verifica as regras de acesso e a validade do token
+func (s *KubeAccessSettings) validate() error {
+	if s == nil {
+		return nil
+	}
+	if s.TokenTTL != "" {
+		ttl, err := time.ParseDuration(s.TokenTTL)
+		if err != nil || ttl < minTokenTTL {
+			return fmt.Errorf("tokenTTL deve ser uma duração de pelo menos %s: %q", minTokenTTL, s.TokenTTL)
+		}
+	}
+	if s.MountPath != "" && !path.IsAbs(s.MountPath) {
+		return fmt.Errorf("mountPath deve ser absoluto: %s", s.MountPath)
+	}
+	for i, rule := range s.Rules {
+		if len(rule.Resources) == 0 || len(rule.Verbs) == 0 {
+			return fmt.Errorf("regra de acesso %d sem recursos ou verbos", i+1)
+		}
+		readOnly := true
+		for _, verb := range rule.Verbs {
+			switch verb {
+			case "get", "list", "watch":
+			case "escalate", "bind", "impersonate", "*":
+				return fmt.Errorf("verbo não permitido na regra de acesso %d: %s", i+1, verb)
+			default:
+				readOnly = false
+			}
+		}
+		for _, group := range rule.APIGroups {
+			if group == "*" || group == rbacv1.GroupName {
+				return fmt.Errorf("grupo de API não permitido na regra de acesso %d: %s", i+1, group)
+			}
+		}
+		for _, resource := range rule.Resources {
+			if protectedResources[strings.Split(resource, "/")[0]] && !(readOnly && resource != "*") {
+				return fmt.Errorf("recurso protegido na regra de acesso %d: %s", i+1, resource)
+			}
+		}
+	}
+	return nil
+}
+
+// kubeAccessEnabled indica se o laboratório recebe uma credencial própria do cluster
+func kubeAccessEnabled(template *LabTemplate) bool {
+	if config.Lab.Access.Disabled {
+		return false
+	}
+	return template.KubernetesAccess == nil || !template.KubernetesAccess.Disabled
+}
+
+// accessRules retorna as regras do template ou as padrão
+func accessRules(template *LabTemplate) []rbacv1.PolicyRule {
+	rules := defaultAccessRules
+	if template.KubernetesAccess != nil && len(template.KubernetesAccess.Rules) > 0 {
+		rules = template.KubernetesAccess.Rules
+	}
+	policyRules := make([]rbacv1.PolicyRule, 0, len(rules))
+	for _, rule := range rules {
+		groups := rule.APIGroups
+		if len(groups) == 0 {
+			groups = []string{""}
+		}
+		policyRules = append(policyRules, rbacv1.PolicyRule{
+			APIGroups: groups,
+			Resources: rule.Resources,
+			Verbs:     rule.Verbs,
+		})
+	}
+	return policyRules
+}
+
+// tokenTTL retorna a validade dos tokens do laboratório
+func tokenTTL(template *LabTemplate) time.Duration {
+	value := config.Lab.Access.TokenTTL
+	if template != nil && template.KubernetesAccess != nil && template.KubernetesAccess.TokenTTL != "" {
+		value = template.KubernetesAccess.TokenTTL
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl < minTokenTTL {
+		return 2 * time.Hour
+	}
+	return ttl
+}
+
+// kubeconfigMountPath retorna o diretório onde o kubeconfig é montado no laboratório
+func kubeconfigMountPath(template *LabTemplate) string {
+	if template.KubernetesAccess != nil && template.KubernetesAccess.MountPath != "" {
+		return template.KubernetesAccess.MountPath
+	}
+	return config.Lab.Access.MountPath
+}
+
+// kubeconfigVolume retorna o volume e a montagem do kubeconfig no contêiner do laboratório
+func kubeconfigVolume(template *LabTemplate) (v1.Volume, v1.VolumeMount, v1.EnvVar) {
+	mode := int32(0600)
+	volume := v1.Volume{
+		Name: kubeconfigSecretName,
+		VolumeSource: v1.VolumeSource{
+			Secret: &v1.SecretVolumeSource{
+				SecretName:  kubeconfigSecretName,
+				DefaultMode: &mode,
+			},
+		},
+	}
+	mount := v1.VolumeMount{
+		Name:      kubeconfigSecretName,
+		MountPath: kubeconfigMountPath(template),
+		ReadOnly:  true,
+	}
+	env := v1.EnvVar{Name: "KUBECONFIG", Value: path.Join(kubeconfigMountPath(template), "config")}
+	return volume, mount, env
+}
+
+var (
+	apiEndpointOnce sync.Once
+	apiServer       string
+	apiCAData       []byte
+)
+
+// labAPIEndpoint retorna o endereço da API e a CA usados nos kubeconfigs dos laboratórios
+func labAPIEndpoint() (string, []byte) {
+	apiEndpointOnce.Do(func() {
+		apiServer = config.Lab.Access.APIServer
+		restConfig, err := loadClusterConfig()
+		if err != nil {
+			log.Printf("Configuração do cluster indisponível, kubeconfigs de laboratório sem CA: %v", err)
+			return
+		}
+		if apiServer == "" {
+			apiServer = restConfig.Host
+		}
+		apiCAData = restConfig.TLSClientConfig.CAData
+		if len(apiCAData) == 0 && restConfig.TLSClientConfig.CAFile != "" {
+			if apiCAData, err = os.ReadFile(restConfig.TLSClientConfig.CAFile); err != nil {
+				log.Printf("Erro ao ler CA do cluster: %v", err)
+			}
+		}
+	})
+	if apiServer == "" {
+		return "https://kubernetes.default.svc", apiCAData
+	}
+	return apiServer, apiCAData
+}
+
+// ensureLabAccess cria a ServiceAccount do laboratório com uma Role restrita ao
+// namespace e grava o kubeconfig com um token de curta duração
+func (lm *LabManager) ensureLabAccess(namespace string, template *LabTemplate) error {
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+	labels := map[string]string{"createdBy": "girus"}
+
+	serviceAccount := &v1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{Name: labAccessName, Labels: labels},
+		// O token da conta não é montado nos pods; o aluno usa apenas o kubeconfig
+		AutomountServiceAccountToken: new(bool),
+	}
+	if _, err := lm.clientset.CoreV1().ServiceAccounts(namespace).Create(ctx, serviceAccount, metav1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("erro ao criar ServiceAccount do laboratório: %v", err)
+	}
+
+	roles := lm.clientset.RbacV1().Roles(namespace)
+	role := &rbacv1.Role{
+		ObjectMeta: metav1.ObjectMeta{Name: labAccessName, Labels: labels},
+		Rules:      accessRules(template),
+	}
+	existingRole, err := roles.Get(ctx, labAccessName, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		_, err = roles.Create(ctx, role, metav1.CreateOptions{})
+	case err == nil:
+		existingRole.Rules = role.Rules
+		_, err = roles.Update(ctx, existingRole, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("erro ao aplicar Role do laboratório: %v", err)
+	}
+
+	binding := &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: labAccessName, Labels: labels},
+		Subjects: []rbacv1.Subject{{
+			Kind:      rbacv1.ServiceAccountKind,
+			Name:      labAccessName,
+			Namespace: namespace,
+		}},
+		RoleRef: rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: labAccessName},
+	}
+	if _, err := lm.clientset.RbacV1().RoleBindings(namespace).Create(ctx, binding, metav1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("erro ao criar RoleBinding do laboratório: %v", err)
+	}
+
+	_, err = lm.writeLabKubeconfig(namespace, template)
+	return err
+}
+
+// writeLabKubeconfig emite um novo token da ServiceAccount do laboratório e
+// grava o kubeconfig no Secret montado no contêiner
+func (lm *LabManager) writeLabKubeconfig(namespace string, template *LabTemplate) (time.Time, error) {
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+
+	ttlSeconds := int64(tokenTTL(template).Seconds())
+	request, err := lm.clientset.CoreV1().ServiceAccounts(namespace).CreateToken(ctx, labAccessName, &authenticationv1.TokenRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: labAccessName},
+		Spec:       authenticationv1.TokenRequestSpec{ExpirationSeconds: &ttlSeconds},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("erro ao emitir token do laboratório: %v", err)
+	}
+	expiresAt := request.Status.ExpirationTimestamp.Time
+	if expiresAt.IsZero() {
+		expiresAt = time.Now().Add(time.Duration(ttlSeconds) * time.Second)
+	}
+
+	server, caData := labAPIEndpoint()
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        kubeconfigSecretName,
+			Labels:      map[string]string{"createdBy": "girus"},
+			Annotations: map[string]string{tokenExpiresAtAnnotation: expiresAt.UTC().Format(time.RFC3339)},
+		},
+		Type: v1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			"config": []byte(generateRestrictedKubeConfig(server, caData, namespace, request.Status.Token)),
+		},
+	}
+
+	secrets := lm.clientset.CoreV1().Secrets(namespace)
+	existing, err := secrets.Get(ctx, kubeconfigSecretName, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		_, err = secrets.Create(ctx, secret, metav1.CreateOptions{})
+	case err == nil:
+		existing.Annotations = secret.Annotations
+		existing.Data = secret.Data
+		_, err = secrets.Update(ctx, existing, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("erro ao gravar kubeconfig do laboratório: %v", err)
+	}
+	return expiresAt, nil
+}
+
+// TokenRotation descreve o token emitido na rotação da credencial do laboratório
+type TokenRotation struct {
+	LabID     string    `json:"labId"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// RotateLabToken emite um novo token para o kubeconfig do laboratório. O Secret
+// montado é atualizado pelo kubelet e o token anterior expira no prazo original.
+func (lm *LabManager) RotateLabToken(labID string) (*TokenRotation, error) {
+	if _, err := lm.getLabNamespace(labID); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+	if _, err := lm.clientset.CoreV1().ServiceAccounts(labID).Get(ctx, labAccessName, metav1.GetOptions{}); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, errors.NewBadRequest("o laboratório não tem acesso à API do Kubernetes")
+		}
+		return nil, err
+	}
+
+	// A validade do token segue o template do laboratório em execução, se houver
+	var template *LabTemplate
+	if pods, err := lm.backend.ListLabs(ctx, labID, metav1.ListOptions{LabelSelector: "app=girus-lab"}); err == nil && len(pods) > 0 {
+		template = lm.GetTemplate(pods[0].Labels["template"])
+	}
+
+	expiresAt, err := lm.writeLabKubeconfig(labID, template)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Token do laboratório %s renovado, expira em %s", labID, expiresAt.Format(time.RFC3339))
+	return &TokenRotation{LabID: labID, ExpiresAt: expiresAt}, nil
+}
@@ -0,0 +1,60 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// ExecOptions descreve a execução de um comando dentro de um laboratório
+type ExecOptions struct {
+	Container         string
+	Command           []string
+	Stdin             io.Reader
+	Stdout            io.Writer
+	Stderr            io.Writer
+	TTY               bool
+	TerminalSizeQueue remotecommand.TerminalSizeQueue
+}
+
+// LabBackend abstrai onde os pods de laboratório são executados.
+// O LabManager usa Clientset() para os objetos auxiliares (namespaces, ConfigMaps)
+// e os demais métodos para o ciclo de vida e a execução de comandos nos laboratórios.
+type LabBackend interface {
+	// Name retorna o identificador do backend ("kubernetes", "local")
+	Name() string
+	// Clientset retorna o cliente usado para os objetos auxiliares do laboratório
+	Clientset() kubernetes.Interface
+	// DynamicClient retorna o cliente dos recursos customizados (GirusLab)
+	DynamicClient() (dynamic.Interface, error)
+	// CreateLab cria o pod do laboratório
+	CreateLab(ctx context.Context, pod *v1.Pod) (*v1.Pod, error)
+	// GetLab obtém o pod de um laboratório
+	GetLab(ctx context.Context, namespace, name string) (*v1.Pod, error)
+	// ListLabs lista os pods de laboratório de um namespace ("" para todos)
+	ListLabs(ctx context.Context, namespace string, opts metav1.ListOptions) ([]v1.Pod, error)
+	// DeleteLab exclui o pod de um laboratório
+	DeleteLab(ctx context.Context, namespace, name string, opts metav1.DeleteOptions) error
+	// Exec executa um comando não interativo no laboratório
+	Exec(ctx context.Context, pod *v1.Pod, opts ExecOptions) error
+	// AttachTerminal abre uma sessão interativa no laboratório
+	AttachTerminal(ctx context.Context, pod *v1.Pod, opts ExecOptions) error
+}
+
+// NewLabBackend cria o backend de laboratórios pelo nome configurado
+func NewLabBackend(name string) (LabBackend, error) {
+	switch name {
+	case "", "kubernetes":
+		return NewKubernetesBackend()
+	case "local":
+		return NewLocalBackend(config.Lab.LocalWorkDir)
+	default:
+		return nil, fmt.Errorf("backend de laboratório desconhecido: %s", name)
+	}
+}
@@ -0,0 +1,293 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// labPodSelector seleciona os pods de laboratório mantidos no cache
+	labPodSelector = "app=girus-lab"
+	// labNamespaceSelector seleciona os namespaces criados pelo Girus
+	labNamespaceSelector = "createdBy=girus"
+	// labEventSelector seleciona os eventos do kubelet sobre pods (download de imagens)
+	labEventSelector = "involvedObject.kind=Pod,source=kubelet"
+	// cacheResync é o intervalo de reprocessamento completo dos informers
+	cacheResync = 10 * time.Minute
+	// namespaceUpdateAttempts limita as novas tentativas de atualização após conflitos
+	namespaceUpdateAttempts = 3
+)
+
+// LabCache mantém em memória os pods de laboratório, os namespaces do Girus e os
+// eventos do kubelet sobre pods, atualizados por informers. As leituras são
+// servidas pelos listers, sem chamadas ao API server; enquanto o cache não
+// sincroniza, elas consultam a API.
+type LabCache struct {
+	podFactory       informers.SharedInformerFactory
+	namespaceFactory informers.SharedInformerFactory
+	eventFactory     informers.SharedInformerFactory
+	pods             corelisters.PodLister
+	namespaces       corelisters.NamespaceLister
+	events           corelisters.EventLister
+	synced           []cache.InformerSynced
+	eventsSynced     cache.InformerSynced // Separado: sem permissão para eventos o restante do cache continua útil
+}
+
+// NewLabCache cria os informers filtrados; eles só observam o cluster após Start
+func NewLabCache(clientset kubernetes.Interface) *LabCache {
+	podFactory := informers.NewSharedInformerFactoryWithOptions(clientset, cacheResync,
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.LabelSelector = labPodSelector
+		}))
+	namespaceFactory := informers.NewSharedInformerFactoryWithOptions(clientset, cacheResync,
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.LabelSelector = labNamespaceSelector
+		}))
+
+	eventFactory := informers.NewSharedInformerFactoryWithOptions(clientset, cacheResync,
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.FieldSelector = labEventSelector
+		}))
+
+	podInformer := podFactory.Core().V1().Pods()
+	namespaceInformer := namespaceFactory.Core().V1().Namespaces()
+	eventInformer := eventFactory.Core().V1().Events()
+	return &LabCache{
+		podFactory:       podFactory,
+		namespaceFactory: namespaceFactory,
+		eventFactory:     eventFactory,
+		pods:             podInformer.Lister(),
+		namespaces:       namespaceInformer.Lister(),
+		events:           eventInformer.Lister(),
+		synced:           []cache.InformerSynced{podInformer.Informer().HasSynced, namespaceInformer.Informer().HasSynced},
+		eventsSynced:     eventInformer.Informer().HasSynced,
+	}
+}
+
+// Start inicia os informers e aguarda a primeira sincronização
+func (c *LabCache) Start(ctx context.Context) {
+	c.podFactory.Start(ctx.Done())
+	c.namespaceFactory.Start(ctx.Done())
+	c.eventFactory.Start(ctx.Done())
+	go func() {
+		if cache.WaitForCacheSync(ctx.Done(), c.synced...) {
+			log.Printf("[Cache] Pods de laboratório e namespaces sincronizados")
+		}
+	}()
+}
+
+// Synced indica se os listers já refletem o estado do cluster
+func (c *LabCache) Synced() bool {
+	for _, synced := range c.synced {
+		if !synced() {
+			return false
+		}
+	}
+	return true
+}
+
+// ListPods lista os pods de laboratório de um namespace ("" para todos) que
+// correspondem ao seletor. Os pods retornados são cópias.
+func (c *LabCache) ListPods(namespace, selector string) ([]v1.Pod, error) {
+	parsed, err := labels.Parse(selector)
+	if err != nil {
+		return nil, fmt.Errorf("seletor inválido %q: %v", selector, err)
+	}
+	var cached []*v1.Pod
+	if namespace == "" {
+		cached, err = c.pods.List(parsed)
+	} else {
+		cached, err = c.pods.Pods(namespace).List(parsed)
+	}
+	if err != nil {
+		return nil, err
+	}
+	pods := make([]v1.Pod, 0, len(cached))
+	for _, pod := range cached {
+		pods = append(pods, *pod.DeepCopy())
+	}
+	return pods, nil
+}
+
+// GetPod obtém uma cópia de um pod de laboratório
+func (c *LabCache) GetPod(namespace, name string) (*v1.Pod, error) {
+	pod, err := c.pods.Pods(namespace).Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return pod.DeepCopy(), nil
+}
+
+// GetNamespace obtém uma cópia de um namespace do Girus
+func (c *LabCache) GetNamespace(name string) (*v1.Namespace, error) {
+	namespace, err := c.namespaces.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return namespace.DeepCopy(), nil
+}
+
+// ListPodEvents lista cópias dos eventos do kubelet sobre o pod
+func (c *LabCache) ListPodEvents(namespace, podName string) ([]v1.Event, error) {
+	if !c.eventsSynced() {
+		return nil, fmt.Errorf("eventos ainda não sincronizados")
+	}
+	cached, err := c.events.Events(namespace).List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	events := []v1.Event{}
+	for _, event := range cached {
+		if event.InvolvedObject.Name == podName {
+			events = append(events, *event.DeepCopy())
+		}
+	}
+	return events, nil
+}
+
+// ListNamespaces lista cópias dos namespaces do Girus
+func (c *LabCache) ListNamespaces() ([]v1.Namespace, error) {
+	cached, err := c.namespaces.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	namespaces := make([]v1.Namespace, 0, len(cached))
+	for _, namespace := range cached {
+		namespaces = append(namespaces, *namespace.DeepCopy())
+	}
+	return namespaces, nil
+}
+
+// cacheReady indica se as leituras podem ser servidas pelo cache
+func (lm *LabManager) cacheReady() bool {
+	return lm.cache != nil && lm.cache.Synced()
+}
+
+// listLabPods lista os pods de laboratório pelo cache, ou pela API enquanto ele
+// não está disponível. O seletor deve restringir a busca a app=girus-lab.
+func (lm *LabManager) listLabPods(namespace, selector string) ([]v1.Pod, error) {
+	if lm.cacheReady() {
+		return lm.cache.ListPods(namespace, selector)
+	}
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+	return lm.backend.ListLabs(ctx, namespace, metav1.ListOptions{LabelSelector: selector})
+}
+
+// getLabPod obtém um pod de laboratório pelo cache, recorrendo à API quando ele
+// ainda não está disponível ou não conhece o pod (recém-criado, por exemplo)
+func (lm *LabManager) getLabPod(namespace, name string) (*v1.Pod, error) {
+	if lm.cacheReady() {
+		if pod, err := lm.cache.GetPod(namespace, name); err == nil {
+			return pod, nil
+		} else if !errors.IsNotFound(err) {
+			return nil, err
+		}
+	}
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+	return lm.backend.GetLab(ctx, namespace, name)
+}
+
+// getNamespace obtém um namespace pelo cache, recorrendo à API quando ele ainda
+// não está disponível ou não conhece o namespace (recém-criado, por exemplo)
+func (lm *LabManager) getNamespace(name string) (*v1.Namespace, error) {
+	if lm.cacheReady() {
+		if namespace, err := lm.cache.GetNamespace(name); err == nil {
+			return namespace, nil
+		} else if !errors.IsNotFound(err) {
+			return nil, err
+		}
+	}
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+	return lm.clientset.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+}
+
+// listLabNamespaces lista os namespaces criados pelo Girus
+func (lm *LabManager) listLabNamespaces() ([]v1.Namespace, error) {
+	if lm.cacheReady() {
+		return lm.cache.ListNamespaces()
+	}
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+	list, err := lm.clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{LabelSelector: labNamespaceSelector})
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// podEvents lista os eventos do kubelet sobre o pod pelo cache, ou pela API
+// enquanto os eventos não estão disponíveis
+func (lm *LabManager) podEvents(namespace, podName string) ([]v1.Event, error) {
+	if lm.cacheReady() {
+		if events, err := lm.cache.ListPodEvents(namespace, podName); err == nil {
+			return events, nil
+		}
+	}
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+	list, err := lm.clientset.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: "involvedObject.name=" + podName,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// updateNamespace aplica mutate ao namespace lido do cache e grava o resultado.
+// Se a cópia do cache estiver desatualizada, o namespace é relido da API e a
+// alteração é repetida. mutate retorna false quando não há nada a gravar.
+func (lm *LabManager) updateNamespace(name string, mutate func(namespace *v1.Namespace) bool) error {
+	namespace, err := lm.getNamespace(name)
+	for attempt := 1; ; attempt++ {
+		if err != nil {
+			return err
+		}
+		if !mutate(namespace) {
+			return nil
+		}
+		ctx, cancel := contextWithTimeout()
+		_, err = lm.clientset.CoreV1().Namespaces().Update(ctx, namespace, metav1.UpdateOptions{})
+		if !errors.IsConflict(err) || attempt == namespaceUpdateAttempts {
+			cancel()
+			return err
+		}
+		namespace, err = lm.clientset.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+		cancel()
+	}
+}
+
+// updateLabPod aplica mutate ao pod lido do cache e grava o resultado, relendo
+// o pod da API quando a cópia do cache estiver desatualizada
+func (lm *LabManager) updateLabPod(namespace, name string, mutate func(pod *v1.Pod)) (*v1.Pod, error) {
+	pod, err := lm.getLabPod(namespace, name)
+	for attempt := 1; ; attempt++ {
+		if err != nil {
+			return nil, err
+		}
+		mutate(pod)
+		ctx, cancel := contextWithTimeout()
+		var updated *v1.Pod
+		updated, err = lm.clientset.CoreV1().Pods(namespace).Update(ctx, pod, metav1.UpdateOptions{})
+		if !errors.IsConflict(err) || attempt == namespaceUpdateAttempts {
+			cancel()
+			return updated, err
+		}
+		pod, err = lm.clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+		cancel()
+	}
+}
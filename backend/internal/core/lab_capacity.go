@@ -0,0 +1,493 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	// PhaseQueued indica que a criação aguarda uma vaga
+	PhaseQueued = "queued"
+
+	// orgLabel identifica a organização dona do namespace do laboratório
+	orgLabel = "girus.io/org"
+
+	// capacityCheckInterval é a frequência com que a fila verifica vagas liberadas
+	capacityCheckInterval = 5 * time.Second
+
+	// capacityRetryAfter é o intervalo sugerido ao cliente quando a fila está cheia
+	capacityRetryAfter = 30 * time.Second
+)
+
+// Limites que podem bloquear uma criação
+const (
+	limitGlobal   = "global"
+	limitUser     = "user"
+	limitTemplate = "template"
+	limitOrg      = "organization"
+)
+
+// LabRequest descreve um pedido de criação de laboratório
+type LabRequest struct {
+	UserID   string `json:"userId"`
+	Template string `json:"templateId"`
+	Org      string `json:"org,omitempty"`
+	Priority int    `json:"priority"` // Maior sai da fila primeiro; empates seguem a ordem de chegada
+
+	IdempotencyKey string `json:"-"` // Chave enviada pelo cliente para evitar criações duplicadas
+}
+
+// QueueStatus é a situação de uma criação na fila
+type QueueStatus struct {
+	Position      int    `json:"position"`
+	Reason        string `json:"reason"`                  // Limite que impede a criação
+	EstimatedWait string `json:"estimatedWait,omitempty"` // Vazio quando não há estimativa
+	EnqueuedAt    string `json:"enqueuedAt"`
+}
+
+// queuedLab é uma criação aguardando vaga
+type queuedLab struct {
+	operationID string
+	request     LabRequest
+	seq         int64
+	enqueuedAt  time.Time
+	status      QueueStatus
+}
+
+// labSlot é um laboratório que ocupa vaga
+type labSlot struct {
+	user     string
+	template string
+	org      string
+}
+
+// capacityUsage é a ocupação atual, por limite
+type capacityUsage struct {
+	total       int
+	users       map[string]int
+	templates   map[string]int
+	orgs        map[string]int
+	byNamespace map[string]labSlot
+	expirations []time.Time // Fim previsto dos laboratórios em execução, em ordem
+}
+
+func (u *capacityUsage) add(slot labSlot) {
+	u.total++
+	u.users[slot.user]++
+	u.templates[slot.template]++
+	if slot.org != "" {
+		u.orgs[slot.org]++
+	}
+}
+
+// CapacityManager limita quantos laboratórios existem ao mesmo tempo e enfileira
+// os pedidos que excedem os limites, criando-os automaticamente quando há vaga
+type CapacityManager struct {
+	lm         *LabManager
+	cfg        CapacityConfig
+	mu         sync.Mutex
+	processing sync.Mutex
+	queue      []*queuedLab
+	inFlight   map[string]labSlot // Criações admitidas cujo pod ainda não existe, por operação
+	seq        int64
+	trigger    chan struct{}
+	start      func(operationID string, request LabRequest) // Inicia a criação admitida
+}
+
+// CapacityStatus resume a ocupação e a fila
+type CapacityStatus struct {
+	Limits    CapacityConfig   `json:"limits"`
+	Running   int              `json:"running"`
+	InFlight  int              `json:"inFlight"`
+	Users     map[string]int   `json:"users"`
+	Templates map[string]int   `json:"templates"`
+	Orgs      map[string]int   `json:"organizations"`
+	Queue     []QueuedLabEntry `json:"queue"`
+}
+
+// QueuedLabEntry é um item da fila exibido aos administradores
+type QueuedLabEntry struct {
+	OperationID string `json:"operationId"`
+	LabRequest
+	QueueStatus
+}
+
+// limited indica se algum limite de capacidade está configurado
+func (c CapacityConfig) limited() bool {
+	return c.MaxLabs > 0 || c.MaxPerUser > 0 || c.MaxPerOrg > 0 || c.DefaultMaxPerTemplate > 0 || len(c.MaxPerTemplate) > 0
+}
+
+// templateLimit retorna o limite do template (0 = sem limite)
+func (c CapacityConfig) templateLimit(template string) int {
+	if limit, ok := c.MaxPerTemplate[template]; ok {
+		return limit
+	}
+	return c.DefaultMaxPerTemplate
+}
+
+// NewCapacityManager cria o controle de capacidade do LabManager
+func NewCapacityManager(lm *LabManager, cfg CapacityConfig) *CapacityManager {
+	return &CapacityManager{
+		lm:       lm,
+		cfg:      cfg,
+		inFlight: make(map[string]labSlot),
+		trigger:  make(chan struct{}, 1),
+		start:    lm.runCreateLab,
+	}
+}
+
+// Start verifica periodicamente se há vagas para os pedidos na fila
+func (m *CapacityManager) Start(ctx context.Context) {
+	log.Printf("Limites de laboratórios: total=%d, por usuário=%d, por organização=%d, por template=%d, fila=%d",
+		m.cfg.MaxLabs, m.cfg.MaxPerUser, m.cfg.MaxPerOrg, m.cfg.DefaultMaxPerTemplate, m.cfg.QueueSize)
+
+	go func() {
+		ticker := time.NewTicker(capacityCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.process()
+			case <-m.trigger:
+				m.process()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// wake agenda uma nova verificação da fila
+func (m *CapacityManager) wake() {
+	select {
+	case m.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Submit coloca o pedido na fila e o admite imediatamente se houver vaga
+func (m *CapacityManager) Submit(operationID string, request LabRequest) error {
+	m.mu.Lock()
+	for _, entry := range m.queue {
+		if entry.request.UserID == request.UserID {
+			m.mu.Unlock()
+			return errors.NewConflict(labResource, request.UserID, fmt.Errorf("já existe um pedido de laboratório na fila (operação %s)", entry.operationID))
+		}
+	}
+	if m.cfg.QueueSize > 0 && len(m.queue) >= m.cfg.QueueSize {
+		m.mu.Unlock()
+		return errors.NewTooManyRequests("a fila de laboratórios está cheia, tente novamente mais tarde", int(capacityRetryAfter.Seconds()))
+	}
+	m.seq++
+	m.queue = append(m.queue, &queuedLab{
+		operationID: operationID,
+		request:     request,
+		seq:         m.seq,
+		enqueuedAt:  time.Now(),
+	})
+	m.mu.Unlock()
+
+	m.process()
+	return nil
+}
+
+// Cancel retira um pedido da fila
+func (m *CapacityManager) Cancel(operationID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, entry := range m.queue {
+		if entry.operationID == operationID {
+			m.queue = append(m.queue[:i], m.queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Reserve ocupa imediatamente uma vaga para uma criação que não passa pela fila
+// (retomada, restauração de snapshot, GirusLab). Sem vaga, ou com pedidos
+// aguardando o limite global, retorna TooManyRequests. A função devolvida libera
+// a vaga e deve ser chamada quando o pod já existir ou a criação falhar.
+func (m *CapacityManager) Reserve(request LabRequest) (func(), error) {
+	m.processing.Lock()
+	defer m.processing.Unlock()
+
+	usage, err := m.usage()
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.addInFlight(usage)
+	reason := m.blocked(usage, request)
+	for _, entry := range m.queue {
+		if reason == "" && entry.status.Reason == limitGlobal {
+			// Quem aguarda na fila tem preferência pela próxima vaga global
+			reason = limitGlobal
+		}
+	}
+	if reason != "" {
+		return nil, errors.NewTooManyRequests(fmt.Sprintf("sem vaga para o laboratório (limite %s)", reason), int(capacityRetryAfter.Seconds()))
+	}
+
+	m.seq++
+	key := fmt.Sprintf("reserve-%d", m.seq)
+	m.inFlight[key] = labSlot{user: request.UserID, template: request.Template, org: request.Org}
+	return func() { m.release(key) }, nil
+}
+
+// addInFlight soma à ocupação as criações admitidas cujo pod ainda não existe;
+// exige m.mu
+func (m *CapacityManager) addInFlight(usage *capacityUsage) {
+	for _, slot := range m.inFlight {
+		if existing, ok := usage.byNamespace[m.lm.namespaceForUser(slot.user)]; ok && existing.user == slot.user {
+			continue
+		}
+		usage.add(slot)
+	}
+}
+
+// reserveCapacity reserva uma vaga fora da fila; sem limites configurados não há o que reservar
+func (lm *LabManager) reserveCapacity(request LabRequest) (func(), error) {
+	if lm.capacity == nil {
+		return func() {}, nil
+	}
+	return lm.capacity.Reserve(request)
+}
+
+// release libera a vaga reservada por uma criação quando o pod já existe (ou a criação falhou)
+func (m *CapacityManager) release(operationID string) {
+	m.mu.Lock()
+	delete(m.inFlight, operationID)
+	m.mu.Unlock()
+	m.wake()
+}
+
+// usage calcula a ocupação a partir dos laboratórios entregues no cluster
+func (m *CapacityManager) usage() (*capacityUsage, error) {
+	pods, err := m.lm.listLabPods("", labPodSelector)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao listar laboratórios: %v", err)
+	}
+	namespaces, err := m.lm.listLabNamespaces()
+	if err != nil {
+		return nil, fmt.Errorf("erro ao listar namespaces de laboratório: %v", err)
+	}
+	orgs := map[string]string{}
+	extended := map[string]time.Duration{}
+	for _, namespace := range namespaces {
+		orgs[namespace.Name] = namespace.Labels[orgLabel]
+		_, extended[namespace.Name] = labExtensions(&namespace)
+	}
+
+	usage := &capacityUsage{
+		users:       map[string]int{},
+		templates:   map[string]int{},
+		orgs:        map[string]int{},
+		byNamespace: map[string]labSlot{},
+	}
+	for i := range pods {
+		pod := &pods[i]
+		// Laboratórios ociosos do warm pool têm limite próprio e não ocupam vaga
+		if pod.DeletionTimestamp != nil || pod.Labels["user"] == "" {
+			continue
+		}
+		if _, counted := usage.byNamespace[pod.Namespace]; counted {
+			continue
+		}
+		slot := labSlot{user: pod.Labels["user"], template: pod.Labels["template"], org: orgs[pod.Namespace]}
+		usage.byNamespace[pod.Namespace] = slot
+		usage.add(slot)
+
+		duration := time.Hour
+		if template := m.lm.GetTemplate(slot.template); template != nil {
+			duration = templateMaxDuration(template)
+		}
+		usage.expirations = append(usage.expirations, podStartTime(pod).Add(duration+extended[pod.Namespace]))
+	}
+	sort.Slice(usage.expirations, func(i, j int) bool { return usage.expirations[i].Before(usage.expirations[j]) })
+	return usage, nil
+}
+
+// blocked retorna o limite que impede a criação do pedido, ou "" se houver vaga.
+// Um laboratório existente no namespace do pedido será substituído e não conta.
+func (m *CapacityManager) blocked(usage *capacityUsage, request LabRequest) string {
+	total, user, template, org := usage.total, usage.users[request.UserID], usage.templates[request.Template], 0
+	if request.Org != "" {
+		org = usage.orgs[request.Org]
+	}
+	if existing, ok := usage.byNamespace[m.lm.namespaceForUser(request.UserID)]; ok {
+		total--
+		if existing.user == request.UserID {
+			user--
+		}
+		if existing.template == request.Template {
+			template--
+		}
+		if request.Org != "" && existing.org == request.Org {
+			org--
+		}
+	}
+
+	switch {
+	case m.cfg.MaxLabs > 0 && total >= m.cfg.MaxLabs:
+		return limitGlobal
+	case m.cfg.MaxPerUser > 0 && user >= m.cfg.MaxPerUser:
+		return limitUser
+	case m.cfg.templateLimit(request.Template) > 0 && template >= m.cfg.templateLimit(request.Template):
+		return limitTemplate
+	case m.cfg.MaxPerOrg > 0 && request.Org != "" && org >= m.cfg.MaxPerOrg:
+		return limitOrg
+	}
+	return ""
+}
+
+// estimatedWait estima a espera de quem está na posição informada pelo fim
+// previsto dos laboratórios em execução
+func (m *CapacityManager) estimatedWait(usage *capacityUsage, position int) string {
+	index := position - 1
+	if m.cfg.MaxLabs > 0 && usage.total > m.cfg.MaxLabs {
+		index += usage.total - m.cfg.MaxLabs
+	}
+	if index < 0 || index >= len(usage.expirations) {
+		return ""
+	}
+	wait := time.Until(usage.expirations[index])
+	if wait < 0 {
+		wait = 0
+	}
+	return wait.Round(time.Minute).String()
+}
+
+// process admite os pedidos da fila que cabem nos limites, por prioridade e
+// ordem de chegada, e atualiza a posição e a espera estimada dos demais
+func (m *CapacityManager) process() {
+	// Verificações simultâneas poderiam admitir pedidos com a mesma ocupação
+	m.processing.Lock()
+	defer m.processing.Unlock()
+
+	m.mu.Lock()
+	empty := len(m.queue) == 0
+	m.mu.Unlock()
+	if empty {
+		return
+	}
+
+	usage, err := m.usage()
+	if err != nil {
+		log.Printf("[Capacidade] %v", err)
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.addInFlight(usage)
+
+	sort.SliceStable(m.queue, func(i, j int) bool {
+		if m.queue[i].request.Priority != m.queue[j].request.Priority {
+			return m.queue[i].request.Priority > m.queue[j].request.Priority
+		}
+		return m.queue[i].seq < m.queue[j].seq
+	})
+
+	maxWait, _ := time.ParseDuration(m.cfg.MaxWait)
+	remaining := []*queuedLab{}
+	globalFull := false
+	for _, entry := range m.queue {
+		if maxWait > 0 && time.Since(entry.enqueuedAt) > maxWait {
+			m.lm.operations.Finish(entry.operationID, fmt.Errorf("tempo máximo de espera na fila (%s) excedido", maxWait))
+			continue
+		}
+
+		reason := limitGlobal
+		if !globalFull {
+			reason = m.blocked(usage, entry.request)
+		}
+		if reason == "" {
+			slot := labSlot{user: entry.request.UserID, template: entry.request.Template, org: entry.request.Org}
+			if _, replacing := usage.byNamespace[m.lm.namespaceForUser(entry.request.UserID)]; !replacing {
+				usage.add(slot)
+			}
+			m.inFlight[entry.operationID] = slot
+			if entry.status.Position > 0 {
+				log.Printf("[Capacidade] Pedido %s de %s saiu da fila após %s", entry.operationID, entry.request.UserID, time.Since(entry.enqueuedAt).Round(time.Second))
+			}
+			go m.start(entry.operationID, entry.request)
+			continue
+		}
+		// Sem vaga global ninguém mais é admitido, preservando a ordem da fila
+		if reason == limitGlobal {
+			globalFull = true
+		}
+		remaining = append(remaining, entry)
+	}
+	m.queue = remaining
+
+	for i, entry := range m.queue {
+		status := QueueStatus{
+			Position:      i + 1,
+			Reason:        m.blocked(usage, entry.request),
+			EstimatedWait: m.estimatedWait(usage, i+1),
+			EnqueuedAt:    entry.enqueuedAt.Format(time.RFC3339),
+		}
+		if status.Reason == "" {
+			status.Reason = limitGlobal
+		}
+		if status == entry.status {
+			continue
+		}
+		entry.status = status
+		message := fmt.Sprintf("Aguardando vaga (limite %s): posição %d na fila", status.Reason, status.Position)
+		if status.EstimatedWait != "" {
+			message += fmt.Sprintf(", espera estimada de %s", status.EstimatedWait)
+		}
+		queueStatus := status
+		m.lm.operations.SetQueue(entry.operationID, &queueStatus)
+		m.lm.operations.Publish(entry.operationID, PhaseQueued, message, 0)
+	}
+}
+
+// Status retorna a ocupação atual e os pedidos na fila
+func (m *CapacityManager) Status() (*CapacityStatus, error) {
+	usage, err := m.usage()
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	status := &CapacityStatus{
+		Limits:    m.cfg,
+		Running:   usage.total,
+		InFlight:  len(m.inFlight),
+		Users:     usage.users,
+		Templates: usage.templates,
+		Orgs:      usage.orgs,
+		Queue:     []QueuedLabEntry{},
+	}
+	for _, entry := range m.queue {
+		status.Queue = append(status.Queue, QueuedLabEntry{OperationID: entry.operationID, LabRequest: entry.request, QueueStatus: entry.status})
+	}
+	return status, nil
+}
+
+// setNamespaceLabel define um label no namespace do laboratório
+func (lm *LabManager) setNamespaceLabel(namespace, key, value string) error {
+	return lm.updateNamespace(namespace, func(current *v1.Namespace) bool {
+		if current.Labels[key] == value {
+			return false
+		}
+		if current.Labels == nil {
+			current.Labels = map[string]string{}
+		}
+		current.Labels[key] = value
+		return true
+	})
+}
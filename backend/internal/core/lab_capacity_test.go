@@ -0,0 +1,310 @@
+package core
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// testLab é um laboratório em execução antes do teste
+type testLab struct {
+	namespace string
+	user      string
+	template  string
+	org       string
+}
+
+// newTestLabManager cria um LabManager sobre o backend local com os
+// laboratórios informados em execução
+func newTestLabManager(t *testing.T, running []testLab) *LabManager {
+	t.Helper()
+	backend, err := NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lm := NewLabManagerWithBackend(backend)
+	ctx := context.Background()
+	for i, lab := range running {
+		namespace := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:   lab.namespace,
+			Labels: map[string]string{"createdBy": "girus", orgLabel: lab.org},
+		}}
+		if _, err := lm.clientset.CoreV1().Namespaces().Create(ctx, namespace, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		pod := &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      lab.namespace + "-pod",
+				Namespace: lab.namespace,
+				Labels:    map[string]string{"app": "girus-lab", "user": lab.user, "template": lab.template},
+			},
+			Spec: v1.PodSpec{Containers: []v1.Container{{Name: labContainerName}}},
+		}
+		if _, err := backend.CreateLab(ctx, pod); err != nil {
+			t.Fatalf("laboratório %d: %v", i, err)
+		}
+	}
+	return lm
+}
+
+// newCapacityTestManager cria um CapacityManager com os laboratórios informados
+// em execução. As criações admitidas não são iniciadas.
+func newCapacityTestManager(t *testing.T, cfg CapacityConfig, running []testLab) *CapacityManager {
+	t.Helper()
+	m := NewCapacityManager(newTestLabManager(t, running), cfg)
+	m.start = func(string, LabRequest) {}
+	return m
+}
+
+func TestCapacityBlocked(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     CapacityConfig
+		running []testLab
+		request LabRequest
+		want    string
+	}{
+		{
+			name:    "sem limites",
+			running: []testLab{{"lab-u2", "u2", "linux", ""}, {"lab-u3", "u3", "linux", ""}},
+			request: LabRequest{UserID: "u1", Template: "linux"},
+			want:    "",
+		},
+		{
+			name:    "limite global",
+			cfg:     CapacityConfig{MaxLabs: 2},
+			running: []testLab{{"lab-u2", "u2", "linux", ""}, {"lab-u3", "u3", "linux", ""}},
+			request: LabRequest{UserID: "u1", Template: "linux"},
+			want:    limitGlobal,
+		},
+		{
+			name:    "laboratório do próprio namespace será substituído",
+			cfg:     CapacityConfig{MaxLabs: 1, MaxPerUser: 1, DefaultMaxPerTemplate: 1},
+			running: []testLab{{"lab-u1", "u1", "linux", ""}},
+			request: LabRequest{UserID: "u1", Template: "linux"},
+			want:    "",
+		},
+		{
+			name:    "limite por usuário",
+			cfg:     CapacityConfig{MaxPerUser: 1},
+			running: []testLab{{"lab-pool-1", "u1", "linux", ""}},
+			request: LabRequest{UserID: "u1", Template: "docker"},
+			want:    limitUser,
+		},
+		{
+			name:    "limite do template",
+			cfg:     CapacityConfig{MaxPerTemplate: map[string]int{"docker": 1}},
+			running: []testLab{{"lab-u2", "u2", "docker", ""}},
+			request: LabRequest{UserID: "u1", Template: "docker"},
+			want:    limitTemplate,
+		},
+		{
+			name:    "limite padrão de template",
+			cfg:     CapacityConfig{DefaultMaxPerTemplate: 1},
+			running: []testLab{{"lab-u2", "u2", "linux", ""}},
+			request: LabRequest{UserID: "u1", Template: "linux"},
+			want:    limitTemplate,
+		},
+		{
+			name:    "template sem limite ignora o padrão",
+			cfg:     CapacityConfig{DefaultMaxPerTemplate: 1, MaxPerTemplate: map[string]int{"docker": 0}},
+			running: []testLab{{"lab-u2", "u2", "docker", ""}},
+			request: LabRequest{UserID: "u1", Template: "docker"},
+			want:    "",
+		},
+		{
+			name:    "limite por organização",
+			cfg:     CapacityConfig{MaxPerOrg: 1},
+			running: []testLab{{"lab-u2", "u2", "linux", "acme"}},
+			request: LabRequest{UserID: "u1", Template: "linux", Org: "acme"},
+			want:    limitOrg,
+		},
+		{
+			name:    "outra organização",
+			cfg:     CapacityConfig{MaxPerOrg: 1},
+			running: []testLab{{"lab-u2", "u2", "linux", "acme"}},
+			request: LabRequest{UserID: "u1", Template: "linux", Org: "globex"},
+			want:    "",
+		},
+		{
+			name:    "pedido sem organização",
+			cfg:     CapacityConfig{MaxPerOrg: 1},
+			running: []testLab{{"lab-u2", "u2", "linux", "acme"}},
+			request: LabRequest{UserID: "u1", Template: "linux"},
+			want:    "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newCapacityTestManager(t, tt.cfg, tt.running)
+			usage, err := m.usage()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := m.blocked(usage, tt.request); got != tt.want {
+				t.Errorf("blocked() = %q, esperado %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCapacityProcess(t *testing.T) {
+	type queued struct {
+		user   string
+		reason string
+	}
+	tests := []struct {
+		name      string
+		cfg       CapacityConfig
+		running   []testLab
+		inFlight  []string // Usuários com criação admitida e pod ainda inexistente
+		requests  []LabRequest
+		expired   []string // Usuários que já esperaram mais que MaxWait
+		admitted  []string
+		remaining []queued
+	}{
+		{
+			name: "maior prioridade sai primeiro",
+			cfg:  CapacityConfig{MaxLabs: 1},
+			requests: []LabRequest{
+				{UserID: "a", Template: "linux"},
+				{UserID: "b", Template: "linux", Priority: 5},
+				{UserID: "c", Template: "linux", Priority: 5},
+			},
+			admitted:  []string{"b"},
+			remaining: []queued{{"c", limitGlobal}, {"a", limitGlobal}},
+		},
+		{
+			name: "empate segue a ordem de chegada",
+			cfg:  CapacityConfig{MaxLabs: 2},
+			requests: []LabRequest{
+				{UserID: "a", Template: "linux"},
+				{UserID: "b", Template: "linux"},
+				{UserID: "c", Template: "linux"},
+			},
+			admitted:  []string{"a", "b"},
+			remaining: []queued{{"c", limitGlobal}},
+		},
+		{
+			name:    "sem vaga global ninguém é admitido",
+			cfg:     CapacityConfig{MaxLabs: 1, MaxPerUser: 1},
+			running: []testLab{{"lab-x", "x", "linux", ""}},
+			requests: []LabRequest{
+				{UserID: "a", Template: "linux"},
+				{UserID: "b", Template: "linux"},
+			},
+			remaining: []queued{{"a", limitGlobal}, {"b", limitGlobal}},
+		},
+		{
+			name:    "limite por usuário não bloqueia os demais",
+			cfg:     CapacityConfig{MaxLabs: 3, MaxPerUser: 1},
+			running: []testLab{{"lab-pool-1", "a", "linux", ""}},
+			requests: []LabRequest{
+				{UserID: "a", Template: "linux"},
+				{UserID: "b", Template: "linux"},
+			},
+			admitted:  []string{"b"},
+			remaining: []queued{{"a", limitUser}},
+		},
+		{
+			name: "limite do template conta os admitidos na mesma rodada",
+			cfg:  CapacityConfig{MaxPerTemplate: map[string]int{"docker": 1}},
+			requests: []LabRequest{
+				{UserID: "a", Template: "docker"},
+				{UserID: "b", Template: "docker"},
+				{UserID: "c", Template: "linux"},
+			},
+			admitted:  []string{"a", "c"},
+			remaining: []queued{{"b", limitTemplate}},
+		},
+		{
+			name:      "criação em andamento ocupa vaga",
+			cfg:       CapacityConfig{MaxLabs: 1},
+			inFlight:  []string{"x"},
+			requests:  []LabRequest{{UserID: "a", Template: "linux"}},
+			remaining: []queued{{"a", limitGlobal}},
+		},
+		{
+			name:    "pedido que excedeu a espera máxima sai da fila",
+			cfg:     CapacityConfig{MaxLabs: 1, MaxWait: "1m"},
+			running: []testLab{{"lab-x", "x", "linux", ""}},
+			requests: []LabRequest{
+				{UserID: "a", Template: "linux"},
+				{UserID: "b", Template: "linux"},
+			},
+			expired:   []string{"a"},
+			remaining: []queued{{"b", limitGlobal}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newCapacityTestManager(t, tt.cfg, tt.running)
+			for _, user := range tt.inFlight {
+				m.inFlight["op-"+user] = labSlot{user: user, template: "linux"}
+			}
+			expired := map[string]bool{}
+			for _, user := range tt.expired {
+				expired[user] = true
+			}
+			for _, request := range tt.requests {
+				m.seq++
+				entry := &queuedLab{operationID: "op-" + request.UserID, request: request, seq: m.seq, enqueuedAt: time.Now()}
+				if expired[request.UserID] {
+					entry.enqueuedAt = time.Now().Add(-time.Hour)
+				}
+				m.queue = append(m.queue, entry)
+			}
+
+			m.process()
+
+			admitted := []string{}
+			for operationID, slot := range m.inFlight {
+				if operationID == "op-"+slot.user && !contains(tt.inFlight, slot.user) {
+					admitted = append(admitted, slot.user)
+				}
+			}
+			sort.Strings(admitted)
+			if !equalStrings(admitted, tt.admitted) {
+				t.Errorf("admitidos = %v, esperado %v", admitted, tt.admitted)
+			}
+
+			if len(m.queue) != len(tt.remaining) {
+				t.Fatalf("fila com %d pedidos, esperado %d", len(m.queue), len(tt.remaining))
+			}
+			for i, entry := range m.queue {
+				want := tt.remaining[i]
+				if entry.request.UserID != want.user || entry.status.Reason != want.reason || entry.status.Position != i+1 {
+					t.Errorf("posição %d: %s (limite %s, posição %d), esperado %s (limite %s)",
+						i+1, entry.request.UserID, entry.status.Reason, entry.status.Position, want.user, want.reason)
+				}
+			}
+		})
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
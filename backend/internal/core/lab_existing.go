@@ -0,0 +1,115 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Políticas aplicadas quando o usuário pede um laboratório de outro template
+// enquanto ainda tem um laboratório em execução. Não há política que mantenha os
+// dois: o laboratório ocupa o namespace do usuário, que guarda o estado de um só.
+const (
+	ExistingLabReject  = "reject"  // Recusa a criação até o laboratório atual ser excluído
+	ExistingLabReplace = "replace" // Exclui o laboratório atual depois de criar o novo
+)
+
+// existingLabPolicy retorna a política configurada, recorrendo a "replace"
+func existingLabPolicy() string {
+	switch config.Lab.ExistingLabPolicy {
+	case ExistingLabReject, ExistingLabReplace:
+		return config.Lab.ExistingLabPolicy
+	case "":
+		return ExistingLabReplace
+	default:
+		log.Printf("Política de laboratório existente desconhecida (%s), usando %s", config.Lab.ExistingLabPolicy, ExistingLabReplace)
+		return ExistingLabReplace
+	}
+}
+
+// labHealthy indica se o pod ainda serve como laboratório do usuário
+func labHealthy(pod *v1.Pod) bool {
+	if pod.DeletionTimestamp != nil {
+		return false
+	}
+	return pod.Status.Phase != v1.PodFailed && pod.Status.Phase != v1.PodSucceeded
+}
+
+// userLabs lista os pods de laboratório do usuário em qualquer namespace (inclusive
+// os entregues pelo warm pool), do mais recente para o mais antigo
+func (lm *LabManager) userLabs(userID string) ([]v1.Pod, error) {
+	pods, err := lm.listLabPods("", fmt.Sprintf("%s,user=%s", labPodSelector, userID))
+	if err != nil {
+		return nil, fmt.Errorf("erro ao listar laboratórios do usuário %s: %v", userID, err)
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[i].CreationTimestamp.After(pods[j].CreationTimestamp.Time)
+	})
+	return pods, nil
+}
+
+// existingLab procura um laboratório saudável do usuário. Um laboratório do mesmo
+// template é retornado para ser reaproveitado; um de outro template impede a
+// criação apenas com a política "reject". Sem laboratório a reaproveitar, retorna nil.
+func (lm *LabManager) existingLab(userID, templateName string) (*v1.Pod, error) {
+	pods, err := lm.userLabs(userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range pods {
+		pod := &pods[i]
+		if !labHealthy(pod) {
+			continue
+		}
+		if pod.Labels["template"] == templateName {
+			return pod, nil
+		}
+		if existingLabPolicy() == ExistingLabReject {
+			return nil, errors.NewConflict(labResource, pod.Namespace,
+				fmt.Errorf("o usuário já tem um laboratório do template %s em execução", pod.Labels["template"]))
+		}
+	}
+	return nil, nil
+}
+
+// runningLab retorna o laboratório em execução mais recente do usuário, de qualquer template
+func (lm *LabManager) runningLab(userID string) (*v1.Pod, error) {
+	pods, err := lm.userLabs(userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range pods {
+		if labHealthy(&pods[i]) {
+			return &pods[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// replaceUserLabs exclui os demais laboratórios do usuário depois que o novo é
+// criado, quando a política é "replace"
+func (lm *LabManager) replaceUserLabs(userID string, current *v1.Pod) {
+	if existingLabPolicy() != ExistingLabReplace {
+		return
+	}
+	pods, err := lm.userLabs(userID)
+	if err != nil {
+		log.Printf("Erro ao procurar laboratórios anteriores do usuário %s: %v", userID, err)
+		return
+	}
+	for _, pod := range pods {
+		if pod.Namespace == current.Namespace && pod.Name == current.Name {
+			continue
+		}
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		log.Printf("Excluindo laboratório anterior %s/%s (template: %s) do usuário %s", pod.Namespace, pod.Name, pod.Labels["template"], userID)
+		if err := lm.DeletePod(pod.Namespace, pod.Name); err != nil {
+			log.Printf("Erro ao excluir laboratório anterior %s/%s: %v", pod.Namespace, pod.Name, err)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	// extensionCountAnnotation registra no namespace quantas extensões o laboratório recebeu
+	extensionCountAnnotation = "girus.io/extension-count"
+	// extendedSecondsAnnotation registra no namespace o tempo total concedido por extensões
+	extendedSecondsAnnotation = "girus.io/extended-seconds"
+)
+
+// extensionAnnotations são as anotações descartadas quando um novo laboratório é criado no namespace
+var extensionAnnotations = []string{extensionCountAnnotation, extendedSecondsAnnotation}
+
+// ExtensionSettings define as regras de extensão de tempo de um template.
+// Campos vazios usam os padrões da configuração do servidor.
+type ExtensionSettings struct {
+	Disabled         bool   `json:"disabled,omitempty" yaml:"disabled"`
+	Step             string `json:"step,omitempty" yaml:"step"`                         // Tempo concedido por extensão (ex.: "15m")
+	MaxCount         int    `json:"maxCount,omitempty" yaml:"maxCount"`                 // Máximo de extensões por laboratório
+	MaxTotalDuration string `json:"maxTotalDuration,omitempty" yaml:"maxTotalDuration"` // Duração total máxima, incluindo a MaxDuration
+}
+
+// validate verifica se as durações declaradas podem ser interpretadas
+func (s *ExtensionSettings) validate() error {
+	if s == nil {
+		return nil
+	}
+	if s.MaxCount < 0 {
+		return fmt.Errorf("maxCount não pode ser negativo: %d", s.MaxCount)
+	}
+	for _, value := range []string{s.Step, s.MaxTotalDuration} {
+		if value == "" {
+			continue
+		}
+		if duration, err := time.ParseDuration(value); err != nil || duration <= 0 {
+			return fmt.Errorf("duração inválida: %q", value)
+		}
+	}
+	return nil
+}
+
+// extensionPolicy é a política efetiva de extensões de um laboratório
+type extensionPolicy struct {
+	disabled         bool
+	step             time.Duration
+	maxCount         int
+	maxTotalDuration time.Duration // 0 = sem limite
+}
+
+// resolveExtensionPolicy combina as regras do template com os padrões da configuração
+func resolveExtensionPolicy(template *LabTemplate) extensionPolicy {
+	policy := extensionPolicy{maxCount: config.Lab.Extensions.MaxCount}
+	policy.step, _ = time.ParseDuration(config.Lab.Extensions.Step)
+	policy.maxTotalDuration, _ = time.ParseDuration(config.Lab.Extensions.MaxTotalDuration)
+
+	if settings := template.Extensions; settings != nil {
+		policy.disabled = settings.Disabled
+		if settings.Step != "" {
+			policy.step, _ = time.ParseDuration(settings.Step)
+		}
+		if settings.MaxCount > 0 {
+			policy.maxCount = settings.MaxCount
+		}
+		if settings.MaxTotalDuration != "" {
+			policy.maxTotalDuration, _ = time.ParseDuration(settings.MaxTotalDuration)
+		}
+	}
+	if policy.step <= 0 {
+		policy.step = 15 * time.Minute
+	}
+	return policy
+}
+
+// templateMaxDuration retorna a duração do timer do template (padrão: 1 hora)
+func templateMaxDuration(template *LabTemplate) time.Duration {
+	if template.MaxDuration != "" {
+		maxDuration, err := time.ParseDuration(template.MaxDuration)
+		if err == nil {
+			return maxDuration
+		}
+		log.Printf("Erro ao analisar MaxDuration '%s': %v", template.MaxDuration, err)
+	}
+	return 1 * time.Hour
+}
+
+// labExtensions lê do namespace as extensões já concedidas ao laboratório
+func labExtensions(namespace *v1.Namespace) (int, time.Duration) {
+	count, _ := strconv.Atoi(namespace.Annotations[extensionCountAnnotation])
+	seconds, _ := strconv.ParseInt(namespace.Annotations[extendedSecondsAnnotation], 10, 64)
+	return count, time.Duration(seconds) * time.Second
+}
+
+// IsInstructorRole indica se o papel pode estender laboratórios além dos limites do template
+func IsInstructorRole(role string) bool {
+	if role == "" {
+		return false
+	}
+	for _, instructorRole := range config.Lab.Extensions.InstructorRoles {
+		if strings.EqualFold(strings.TrimSpace(instructorRole), role) {
+			return true
+		}
+	}
+	return false
+}
+
+// ExtensionResult descreve o prazo de um laboratório após uma extensão
+type ExtensionResult struct {
+	LabID               string `json:"labId"`
+	Extensions          int    `json:"extensions"`          // Extensões concedidas até agora
+	RemainingExtensions int    `json:"remainingExtensions"` // Extensões que o aluno ainda pode pedir
+	ExtendedBy          string `json:"extendedBy"`          // Tempo total concedido por extensões
+	ExpirationTime      string `json:"expirationTime"`
+	RemainingTime       int64  `json:"remainingTime"` // Em segundos
+}
+
+// ExtendLab estende o prazo de um laboratório em andamento. Sem duração, concede
+// o passo da política do template. Instrutores ignoram os limites do template.
+func (lm *LabManager) ExtendLab(labID string, requested time.Duration, instructor bool) (*ExtensionResult, error) {
+	namespace, err := lm.getLabNamespace(labID)
+	if err != nil {
+		return nil, err
+	}
+	if _, paused := namespace.Annotations[pausedAtAnnotation]; paused {
+		return nil, errors.NewConflict(labResource, labID, fmt.Errorf("o laboratório está pausado"))
+	}
+
+	labInfo, found := lm.GetLabByUserID(labUserID(namespace))
+	if !found || labInfo.Namespace != labID {
+		return nil, errors.NewNotFound(labResource, labID)
+	}
+	if !labInfo.TimerEnabled {
+		return nil, errors.NewBadRequest("o laboratório não tem timer habilitado")
+	}
+	template := lm.GetTemplate(labInfo.TemplateID)
+	if template == nil {
+		return nil, fmt.Errorf("template %s do laboratório não encontrado", labInfo.TemplateID)
+	}
+
+	// Um laboratório expirado que o monitor ainda não removeu não volta à vida por extensão
+	expiration, err := time.Parse(time.RFC3339, labInfo.ExpirationTime)
+	if err == nil && time.Now().After(expiration) && !instructor {
+		return nil, errors.NewConflict(labResource, labID, fmt.Errorf("o prazo do laboratório já terminou"))
+	}
+
+	policy := resolveExtensionPolicy(template)
+	if requested < 0 {
+		return nil, errors.NewBadRequest("a duração da extensão deve ser positiva")
+	}
+	if requested == 0 {
+		requested = policy.step
+	}
+
+	count, extendedBy := labExtensions(namespace)
+	if !instructor {
+		var reason string
+		switch {
+		case policy.disabled:
+			reason = "o template não permite extensões"
+		case requested > policy.step:
+			reason = fmt.Sprintf("cada extensão pode ser de no máximo %s", policy.step)
+		case count >= policy.maxCount:
+			reason = fmt.Sprintf("limite de %d extensões atingido", policy.maxCount)
+		case policy.maxTotalDuration > 0 && templateMaxDuration(template)+extendedBy+requested > policy.maxTotalDuration:
+			reason = fmt.Sprintf("a duração total do laboratório não pode passar de %s", policy.maxTotalDuration)
+		}
+		if reason != "" {
+			return nil, errors.NewForbidden(labResource, labID, fmt.Errorf("%s", reason))
+		}
+	}
+
+	// Uma extensão concorrente invalida os limites verificados acima
+	validated := count
+	count++
+	extendedBy += requested
+	concurrent := false
+	err = lm.updateNamespace(labID, func(current *v1.Namespace) bool {
+		if currentCount, _ := labExtensions(current); currentCount != validated {
+			concurrent = true
+			return false
+		}
+		if current.Annotations == nil {
+			current.Annotations = map[string]string{}
+		}
+		current.Annotations[extensionCountAnnotation] = strconv.Itoa(count)
+		current.Annotations[extendedSecondsAnnotation] = strconv.FormatInt(int64(extendedBy/time.Second), 10)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if concurrent {
+		return nil, errors.NewConflict(labResource, labID, fmt.Errorf("o laboratório foi estendido por outra requisição"))
+	}
+
+	expiration = expiration.Add(requested)
+	remaining := int64(0)
+	if now := time.Now(); now.Before(expiration) {
+		remaining = int64(expiration.Sub(now).Seconds())
+	}
+	remainingExtensions := policy.maxCount - count
+	if remainingExtensions < 0 || policy.disabled {
+		remainingExtensions = 0
+	}
+
+	log.Printf("[Extensão] Laboratório %s estendido em %s (extensão %d, instrutor: %v)", labID, requested, count, instructor)
+	return &ExtensionResult{
+		LabID:               labID,
+		Extensions:          count,
+		RemainingExtensions: remainingExtensions,
+		ExtendedBy:          extendedBy.String(),
+		ExpirationTime:      expiration.Format(time.RFC3339),
+		RemainingTime:       remaining,
+	}, nil
+}
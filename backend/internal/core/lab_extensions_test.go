@@ -0,0 +1,220 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestResolveExtensionPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		defaults ExtensionConfig
+		settings *ExtensionSettings
+		want     extensionPolicy
+	}{
+		{
+			name: "sem configuração usa o passo padrão",
+			want: extensionPolicy{step: 15 * time.Minute},
+		},
+		{
+			name:     "padrões do servidor",
+			defaults: ExtensionConfig{Step: "10m", MaxCount: 2, MaxTotalDuration: "2h"},
+			want:     extensionPolicy{step: 10 * time.Minute, maxCount: 2, maxTotalDuration: 2 * time.Hour},
+		},
+		{
+			name:     "template sobrescreve os padrões",
+			defaults: ExtensionConfig{Step: "10m", MaxCount: 2, MaxTotalDuration: "2h"},
+			settings: &ExtensionSettings{Step: "5m", MaxCount: 4, MaxTotalDuration: "90m"},
+			want:     extensionPolicy{step: 5 * time.Minute, maxCount: 4, maxTotalDuration: 90 * time.Minute},
+		},
+		{
+			name:     "campos vazios do template mantêm os padrões",
+			defaults: ExtensionConfig{Step: "10m", MaxCount: 2, MaxTotalDuration: "2h"},
+			settings: &ExtensionSettings{MaxCount: 3},
+			want:     extensionPolicy{step: 10 * time.Minute, maxCount: 3, maxTotalDuration: 2 * time.Hour},
+		},
+		{
+			name:     "template desabilita extensões",
+			defaults: ExtensionConfig{Step: "10m", MaxCount: 2},
+			settings: &ExtensionSettings{Disabled: true},
+			want:     extensionPolicy{disabled: true, step: 10 * time.Minute, maxCount: 2},
+		},
+		{
+			name:     "passo inválido na configuração usa o padrão",
+			defaults: ExtensionConfig{Step: "quinze", MaxCount: 1},
+			want:     extensionPolicy{step: 15 * time.Minute, maxCount: 1},
+		},
+	}
+
+	previous := config.Lab.Extensions
+	t.Cleanup(func() { config.Lab.Extensions = previous })
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Lab.Extensions = tt.defaults
+			got := resolveExtensionPolicy(&LabTemplate{Name: "ext-lab", Extensions: tt.settings})
+			if got != tt.want {
+				t.Errorf("resolveExtensionPolicy() = %+v, esperado %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtendLab(t *testing.T) {
+	template := &LabTemplate{
+		Name:         "ext-lab",
+		TimerEnabled: true,
+		MaxDuration:  "30m",
+		Extensions:   &ExtensionSettings{Step: "10m", MaxCount: 2, MaxTotalDuration: "1h"},
+	}
+	tests := []struct {
+		name         string
+		count        int           // Extensões já concedidas
+		extendedBy   time.Duration // Tempo já concedido por extensões
+		startedAgo   time.Duration
+		requested    time.Duration
+		instructor   bool
+		concurrent   bool // Outra extensão é gravada entre a leitura e a escrita
+		wantErr      func(error) bool
+		wantCount    int
+		wantExtended time.Duration
+	}{
+		{
+			name:         "passo padrão",
+			startedAgo:   time.Minute,
+			wantCount:    1,
+			wantExtended: 10 * time.Minute,
+		},
+		{
+			name:         "duração menor que o passo",
+			startedAgo:   time.Minute,
+			requested:    5 * time.Minute,
+			wantCount:    1,
+			wantExtended: 5 * time.Minute,
+		},
+		{
+			name:       "passo máximo excedido",
+			startedAgo: time.Minute,
+			requested:  20 * time.Minute,
+			wantErr:    errors.IsForbidden,
+		},
+		{
+			name:       "limite de extensões atingido",
+			count:      2,
+			extendedBy: 20 * time.Minute,
+			startedAgo: time.Minute,
+			wantErr:    errors.IsForbidden,
+		},
+		{
+			name:       "duração total máxima excedida",
+			count:      1,
+			extendedBy: 25 * time.Minute,
+			startedAgo: time.Minute,
+			wantErr:    errors.IsForbidden,
+		},
+		{
+			name:         "instrutor ignora os limites",
+			count:        2,
+			extendedBy:   20 * time.Minute,
+			startedAgo:   time.Minute,
+			requested:    time.Hour,
+			instructor:   true,
+			wantCount:    3,
+			wantExtended: 80 * time.Minute,
+		},
+		{
+			name:       "prazo já terminou",
+			startedAgo: time.Hour,
+			wantErr:    errors.IsConflict,
+		},
+		{
+			name:         "instrutor estende laboratório com prazo terminado",
+			startedAgo:   time.Hour,
+			requested:    time.Hour,
+			instructor:   true,
+			wantCount:    1,
+			wantExtended: time.Hour,
+		},
+		{
+			name:       "extensão concorrente",
+			startedAgo: time.Minute,
+			concurrent: true,
+			wantErr:    errors.IsConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lm := newTestLabManager(t, []testLab{{"lab-u1", "u1", "ext-lab", ""}})
+			lm.templates.templates[template.Name] = template
+			pods, err := lm.listLabPods("lab-u1", labPodSelector)
+			if err != nil || len(pods) != 1 {
+				t.Fatalf("pod do laboratório não encontrado: %v", err)
+			}
+			startedAt := time.Now().Add(-tt.startedAgo).Truncate(time.Second)
+			if _, err := lm.setLabStartTime(&pods[0], startedAt); err != nil {
+				t.Fatal(err)
+			}
+			err = lm.updateNamespace("lab-u1", func(namespace *v1.Namespace) bool {
+				namespace.Annotations = map[string]string{
+					extensionCountAnnotation:  strconv.Itoa(tt.count),
+					extendedSecondsAnnotation: strconv.FormatInt(int64(tt.extendedBy/time.Second), 10),
+				}
+				return true
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.concurrent {
+				clientset := lm.backend.(*LocalBackend).clientset
+				raced := false
+				clientset.PrependReactor("update", "namespaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+					if raced {
+						return false, nil, nil
+					}
+					raced = true
+					stored, err := clientset.Tracker().Get(action.GetResource(), "", "lab-u1")
+					if err != nil {
+						return true, nil, err
+					}
+					namespace := stored.(*v1.Namespace).DeepCopy()
+					namespace.Annotations[extensionCountAnnotation] = strconv.Itoa(tt.count + 1)
+					if err := clientset.Tracker().Update(action.GetResource(), namespace, ""); err != nil {
+						return true, nil, err
+					}
+					return true, nil, errors.NewConflict(action.GetResource().GroupResource(), "lab-u1", fmt.Errorf("objeto modificado"))
+				})
+			}
+
+			result, err := lm.ExtendLab("lab-u1", tt.requested, tt.instructor)
+			if tt.wantErr != nil {
+				if err == nil || !tt.wantErr(err) {
+					t.Fatalf("ExtendLab() erro = %v, resultado = %+v", err, result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantExpiration := startedAt.Add(templateMaxDuration(template) + tt.wantExtended).Format(time.RFC3339)
+			if result.Extensions != tt.wantCount || result.ExtendedBy != tt.wantExtended.String() || result.ExpirationTime != wantExpiration {
+				t.Errorf("ExtendLab() = %+v, esperado %d extensões, %s e expiração %s", result, tt.wantCount, tt.wantExtended, wantExpiration)
+			}
+
+			namespace, err := lm.getNamespace("lab-u1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count, extendedBy := labExtensions(namespace); count != tt.wantCount || extendedBy != tt.wantExtended {
+				t.Errorf("anotações do namespace: %d extensões e %s, esperado %d e %s", count, extendedBy, tt.wantCount, tt.wantExtended)
+			}
+		})
+	}
+}
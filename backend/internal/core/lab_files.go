@@ -0,0 +1,117 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// ownerPattern aceita usuário[:grupo] por nome ou por ID numérico
+var ownerPattern = regexp.MustCompile(`^[a-z_0-9][a-z0-9_.-]*(:[a-z_0-9][a-z0-9_.-]*)?$`)
+
+// validateTemplateFiles verifica destino, codificação, permissões e dono dos arquivos do template
+func validateTemplateFiles(template *LabTemplate) error {
+	seen := map[string]bool{}
+	for _, file := range template.Files {
+		if !strings.HasPrefix(file.Path, "/") || path.Clean(file.Path) == "/" || strings.Contains(file.Path, "..") {
+			return fmt.Errorf("arquivo com caminho inválido: %q (use um caminho absoluto sem \"..\")", file.Path)
+		}
+		key := file.Container + ":" + path.Clean(file.Path)
+		if seen[key] {
+			return fmt.Errorf("arquivo declarado mais de uma vez: %s", file.Path)
+		}
+		seen[key] = true
+
+		if _, err := file.data(); err != nil {
+			return err
+		}
+		if _, err := file.mode(); err != nil {
+			return err
+		}
+		if file.Owner != "" && !ownerPattern.MatchString(file.Owner) {
+			return fmt.Errorf("dono inválido para o arquivo %s: %q", file.Path, file.Owner)
+		}
+		if !template.hasContainer(file.Container) {
+			return fmt.Errorf("arquivo %s usa contêiner inexistente: %s", file.Path, file.Container)
+		}
+	}
+	return nil
+}
+
+// data retorna o conteúdo do arquivo, decodificando base64 quando declarado
+func (f TemplateFile) data() ([]byte, error) {
+	switch f.Encoding {
+	case "":
+		return []byte(f.Content), nil
+	case "base64":
+		content, err := base64.StdEncoding.DecodeString(strings.TrimSpace(f.Content))
+		if err != nil {
+			return nil, fmt.Errorf("conteúdo base64 inválido no arquivo %s: %v", f.Path, err)
+		}
+		return content, nil
+	default:
+		return nil, fmt.Errorf("codificação desconhecida no arquivo %s: %s", f.Path, f.Encoding)
+	}
+}
+
+// mode retorna as permissões do arquivo em octal (padrão: 0644)
+func (f TemplateFile) mode() (string, error) {
+	if f.Mode == "" {
+		return "0644", nil
+	}
+	mode, err := strconv.ParseUint(f.Mode, 8, 32)
+	if err != nil || mode > 07777 {
+		return "", fmt.Errorf("permissões inválidas no arquivo %s: %q", f.Path, f.Mode)
+	}
+	return fmt.Sprintf("%04o", mode), nil
+}
+
+// fileCopyCommand gera o comando que grava a entrada padrão no destino do arquivo.
+// O destino é relativo a GIRUS_LAB_ROOT, definido pelo backend local.
+func fileCopyCommand(file TemplateFile, mode string) []string {
+	script := `cd "${GIRUS_LAB_ROOT:-/}" && mkdir -p "$(dirname "$1")" && cat > "$1" && chmod "$2" "$1" && { [ -z "$3" ] || chown "$3" "$1"; }`
+	return []string{"/bin/sh", "-c", script, "sh", strings.TrimPrefix(path.Clean(file.Path), "/"), mode, file.Owner}
+}
+
+// copyTemplateFiles grava os arquivos do template nos contêineres do pod
+func (lm *LabManager) copyTemplateFiles(pod *v1.Pod, template *LabTemplate) error {
+	for _, file := range template.Files {
+		content, err := file.data()
+		if err != nil {
+			return err
+		}
+		mode, err := file.mode()
+		if err != nil {
+			return err
+		}
+		container := file.Container
+		if container == "" {
+			container = labContainerName
+		}
+
+		var stderr strings.Builder
+		ctx, cancel := context.WithTimeout(context.Background(), prepareTimeout)
+		err = lm.backend.Exec(ctx, pod, ExecOptions{
+			Container: container,
+			Command:   fileCopyCommand(file, mode),
+			Stdin:     bytes.NewReader(content),
+			Stderr:    &stderr,
+		})
+		cancel()
+		if err != nil {
+			return fmt.Errorf("erro ao copiar o arquivo %s: %v %s", file.Path, err, strings.TrimSpace(stderr.String()))
+		}
+	}
+	if len(template.Files) > 0 {
+		log.Printf("[Preparação] %d arquivos do template %s copiados para %s/%s", len(template.Files), template.Name, pod.Namespace, pod.Name)
+	}
+	return nil
+}
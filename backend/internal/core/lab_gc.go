@@ -0,0 +1,359 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/utils/pointer"
+)
+
+// gcResource identifica a coleta de recursos órfãos nos erros no formato da API do Kubernetes
+var gcResource = schema.GroupResource{Group: "girus.io", Resource: "garbage-collector"}
+
+// OrphanResource é um namespace, ConfigMap ou pod do Girus sem laboratório ativo
+type OrphanResource struct {
+	Kind          string `json:"kind"`
+	Namespace     string `json:"namespace"`
+	Name          string `json:"name"`
+	Reason        string `json:"reason"`
+	OrphanedSince string `json:"orphanedSince"` // Primeira vez em que o recurso foi encontrado sem dono
+	DeleteAfter   string `json:"deleteAfter"`   // Fim do período de carência
+}
+
+// GCReport descreve uma execução da coleta de recursos órfãos
+type GCReport struct {
+	DryRun      bool             `json:"dryRun"`
+	StartedAt   string           `json:"startedAt"`
+	FinishedAt  string           `json:"finishedAt"`
+	GracePeriod string           `json:"gracePeriod"`
+	Removed     []OrphanResource `json:"removed"` // Removidos (ou que seriam removidos, em dry-run)
+	Pending     []OrphanResource `json:"pending"` // Ainda no período de carência
+	Errors      []string         `json:"errors"`
+}
+
+// GarbageCollector remove periodicamente os recursos deixados para trás pelos
+// laboratórios: namespaces sem pods, ConfigMaps de laboratórios encerrados e pods
+// finalizados ou sem namespace. Um recurso só é removido depois de permanecer
+// órfão durante todo o período de carência. O início da carência fica em memória:
+// após um reinício ela recomeça, o que apenas adia a remoção.
+type GarbageCollector struct {
+	lm          *LabManager
+	cfg         GCConfig
+	interval    time.Duration
+	gracePeriod time.Duration
+
+	mu        sync.Mutex           // Serializa as execuções
+	firstSeen map[string]time.Time // Recurso órfão -> primeira vez em que foi encontrado
+	last      *GCReport            // Última execução periódica
+}
+
+// NewGarbageCollector cria o coletor de recursos órfãos do LabManager
+func NewGarbageCollector(lm *LabManager, cfg GCConfig) *GarbageCollector {
+	interval, err := time.ParseDuration(cfg.Interval)
+	if err != nil || interval <= 0 {
+		interval = 10 * time.Minute
+	}
+	gracePeriod, err := time.ParseDuration(cfg.GracePeriod)
+	if err != nil || gracePeriod < 0 {
+		gracePeriod = 30 * time.Minute
+	}
+	return &GarbageCollector{
+		lm:          lm,
+		cfg:         cfg,
+		interval:    interval,
+		gracePeriod: gracePeriod,
+		firstSeen:   make(map[string]time.Time),
+	}
+}
+
+// Start executa a coleta periodicamente até o contexto ser cancelado
+func (gc *GarbageCollector) Start(ctx context.Context) {
+	log.Printf("[GC] Coleta de recursos órfãos a cada %s (carência: %s, dry-run: %v)", gc.interval, gc.gracePeriod, gc.cfg.DryRun)
+	go func() {
+		ticker := time.NewTicker(gc.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				report, err := gc.Run(gc.cfg.DryRun)
+				if err != nil {
+					log.Printf("[GC] Erro na coleta de recursos órfãos: %v", err)
+					continue
+				}
+				gc.mu.Lock()
+				gc.last = report
+				gc.mu.Unlock()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Last retorna o relatório da última execução periódica
+func (gc *GarbageCollector) Last() *GCReport {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+	return gc.last
+}
+
+// orphan é um recurso encontrado sem dono nesta execução
+type orphan struct {
+	OrphanResource
+	remove func() error
+}
+
+// Run encontra os recursos órfãos e remove os que passaram do período de carência.
+// Em dry-run nada é removido nem registrado: o relatório mostra o que seria feito.
+func (gc *GarbageCollector) Run(dryRun bool) (*GCReport, error) {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+
+	now := time.Now()
+	report := &GCReport{
+		DryRun:      dryRun,
+		StartedAt:   now.Format(time.RFC3339),
+		GracePeriod: gc.gracePeriod.String(),
+		Removed:     []OrphanResource{},
+		Pending:     []OrphanResource{},
+		Errors:      []string{},
+	}
+
+	orphans, err := gc.findOrphans()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(orphans))
+	for _, found := range orphans {
+		key := found.Kind + "/" + found.Namespace + "/" + found.Name
+		seen[key] = true
+		since, ok := gc.firstSeen[key]
+		if !ok {
+			since = now
+			if !dryRun {
+				gc.firstSeen[key] = since
+			}
+		}
+		found.OrphanedSince = since.Format(time.RFC3339)
+		found.DeleteAfter = since.Add(gc.gracePeriod).Format(time.RFC3339)
+
+		if now.Before(since.Add(gc.gracePeriod)) {
+			report.Pending = append(report.Pending, found.OrphanResource)
+			continue
+		}
+		if !dryRun {
+			if err := found.remove(); err != nil && !errors.IsNotFound(err) {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s %s/%s: %v", found.Kind, found.Namespace, found.Name, err))
+				continue
+			}
+			delete(gc.firstSeen, key)
+			log.Printf("[GC] %s %s/%s removido: %s", found.Kind, found.Namespace, found.Name, found.Reason)
+		}
+		report.Removed = append(report.Removed, found.OrphanResource)
+	}
+
+	// Recursos que voltaram a ter dono (ou já foram removidos) recomeçam a carência
+	if !dryRun {
+		for key := range gc.firstSeen {
+			if !seen[key] {
+				delete(gc.firstSeen, key)
+			}
+		}
+	}
+
+	report.FinishedAt = time.Now().Format(time.RFC3339)
+	if len(report.Removed) > 0 || len(report.Errors) > 0 {
+		log.Printf("[GC] Coleta concluída: %d removido(s), %d em carência, %d erro(s) (dry-run: %v)",
+			len(report.Removed), len(report.Pending), len(report.Errors), dryRun)
+	}
+	return report, nil
+}
+
+// findOrphans lista os namespaces, ConfigMaps e pods do Girus sem laboratório ativo
+func (gc *GarbageCollector) findOrphans() ([]orphan, error) {
+	lm := gc.lm
+	namespaces, err := lm.listLabNamespaces()
+	if err != nil {
+		return nil, fmt.Errorf("erro ao listar namespaces: %v", err)
+	}
+	pods, err := lm.listLabPods("", labPodSelector)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao listar pods de laboratório: %v", err)
+	}
+
+	// Pods ativos de cada namespace
+	activePods := make(map[string]int)
+	for i := range pods {
+		if labHealthy(&pods[i]) {
+			activePods[pods[i].Namespace]++
+		}
+	}
+
+	orphans := []orphan{}
+	girusNamespaces := make(map[string]*v1.Namespace, len(namespaces))
+	orphanNamespaces := make(map[string]bool)
+	for i := range namespaces {
+		ns := &namespaces[i]
+		girusNamespaces[ns.Name] = ns
+		if !strings.HasPrefix(ns.Name, "lab-") || ns.Status.Phase == v1.NamespaceTerminating || ns.DeletionTimestamp != nil {
+			continue
+		}
+		// Namespaces ociosos do warm pool são mantidos pelo próprio pool
+		if ns.Labels[poolLabel] == "idle" {
+			continue
+		}
+		if activePods[ns.Name] > 0 || lm.operations.Active(labUserID(ns)) {
+			continue
+		}
+		if lm.operator != nil && lm.operator.OwnsNamespace(ns.Name) {
+			continue
+		}
+
+		// Laboratórios pausados e workspaces persistentes mantêm o namespace,
+		// mas os ConfigMaps são recriados quando o laboratório volta a rodar
+		_, paused := ns.Annotations[pausedAtAnnotation]
+		hasWorkspace, err := gc.hasWorkspaces(ns.Name)
+		if err != nil {
+			return nil, err
+		}
+		if paused || hasWorkspace {
+			configMaps, err := gc.labConfigMaps(ns.Name)
+			if err != nil {
+				return nil, err
+			}
+			for _, configMap := range configMaps {
+				namespace, name := configMap.Namespace, configMap.Name
+				orphans = append(orphans, orphan{
+					OrphanResource: OrphanResource{Kind: "ConfigMap", Namespace: namespace, Name: name, Reason: "laboratório sem pod em execução"},
+					remove: func() error {
+						ctx, cancel := contextWithTimeout()
+						defer cancel()
+						return lm.clientset.CoreV1().ConfigMaps(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+					},
+				})
+			}
+			continue
+		}
+
+		name, userID, pooled := ns.Name, labUserID(ns), ns.Labels[poolLabel] == "assigned"
+		orphanNamespaces[name] = true
+		orphans = append(orphans, orphan{
+			OrphanResource: OrphanResource{Kind: "Namespace", Namespace: name, Name: name, Reason: "namespace sem laboratório"},
+			remove: func() error {
+				lm.deleteNamespace(name)
+				if pooled && lm.pool != nil {
+					lm.pool.Release(userID)
+				}
+				return nil
+			},
+		})
+	}
+
+	for i := range pods {
+		pod := &pods[i]
+		if pod.DeletionTimestamp != nil || orphanNamespaces[pod.Namespace] || pod.Labels[poolLabel] == "idle" {
+			continue
+		}
+		reason := ""
+		if !labHealthy(pod) {
+			reason = fmt.Sprintf("pod finalizado (%s)", pod.Status.Phase)
+		} else if _, ok := girusNamespaces[pod.Namespace]; !ok {
+			// Pods fora dos namespaces do Girus só são removidos quando o namespace não existe mais
+			missing, err := gc.namespaceMissing(pod.Namespace)
+			if err != nil {
+				return nil, err
+			}
+			if missing {
+				reason = "namespace do laboratório não existe"
+			}
+		}
+		if reason == "" {
+			continue
+		}
+		namespace, name := pod.Namespace, pod.Name
+		orphans = append(orphans, orphan{
+			OrphanResource: OrphanResource{Kind: "Pod", Namespace: namespace, Name: name, Reason: reason},
+			remove: func() error {
+				ctx, cancel := contextWithTimeout()
+				defer cancel()
+				return lm.backend.DeleteLab(ctx, namespace, name, metav1.DeleteOptions{GracePeriodSeconds: pointer.Int64(0)})
+			},
+		})
+	}
+	return orphans, nil
+}
+
+// hasWorkspaces indica se o namespace guarda PVCs de workspaces persistentes
+func (gc *GarbageCollector) hasWorkspaces(namespace string) (bool, error) {
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+	claims, err := gc.lm.clientset.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: "app=girus-workspace",
+	})
+	if err != nil {
+		return false, fmt.Errorf("erro ao listar workspaces do namespace %s: %v", namespace, err)
+	}
+	return len(claims.Items) > 0, nil
+}
+
+// labConfigMaps lista os ConfigMaps criados para o laboratório no namespace: os
+// marcados com createdBy=girus e, para laboratórios anteriores à marcação, o
+// lab-files e os scripts de inicialização
+func (gc *GarbageCollector) labConfigMaps(namespace string) ([]v1.ConfigMap, error) {
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+	list, err := gc.lm.clientset.CoreV1().ConfigMaps(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("erro ao listar ConfigMaps do namespace %s: %v", namespace, err)
+	}
+	configMaps := []v1.ConfigMap{}
+	for _, configMap := range list.Items {
+		if configMap.Labels["createdBy"] == "girus" || configMap.Name == "lab-files" || strings.HasSuffix(configMap.Name, "-init-script") {
+			configMaps = append(configMaps, configMap)
+		}
+	}
+	return configMaps, nil
+}
+
+// namespaceMissing consulta a API, já que o cache só guarda os namespaces do Girus
+func (gc *GarbageCollector) namespaceMissing(namespace string) (bool, error) {
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+	_, err := gc.lm.clientset.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return true, nil
+	}
+	return false, err
+}
+
+// StartGarbageCollector inicia a coleta periódica de recursos órfãos, quando habilitada
+func (lm *LabManager) StartGarbageCollector(ctx context.Context) {
+	if lm.gc != nil {
+		lm.gc.Start(ctx)
+	}
+}
+
+// CollectOrphans executa a coleta de recursos órfãos imediatamente
+func (lm *LabManager) CollectOrphans(dryRun bool) (*GCReport, error) {
+	if lm.gc == nil {
+		return nil, errors.NewNotFound(gcResource, "gc")
+	}
+	return lm.gc.Run(dryRun)
+}
+
+// LastGCReport retorna o relatório da última coleta periódica (nil antes da primeira)
+func (lm *LabManager) LastGCReport() (*GCReport, error) {
+	if lm.gc == nil {
+		return nil, errors.NewNotFound(gcResource, "gc")
+	}
+	return lm.gc.Last(), nil
+}
@@ -0,0 +1,255 @@
+package core
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGarbageCollectorGracePeriod(t *testing.T) {
+	const (
+		orphanKey = "Namespace/lab-ghost/lab-ghost"
+		staleKey  = "Namespace/lab-back/lab-back"
+	)
+	tests := []struct {
+		name        string
+		gracePeriod string
+		dryRun      bool
+		firstSeen   map[string]time.Duration // Há quanto tempo cada recurso foi encontrado órfão
+		wantPending int
+		wantRemoved int
+		wantTracked map[string]bool // Recursos que devem continuar com a carência registrada
+		wantExists  bool            // O namespace órfão ainda existe após a execução
+	}{
+		{
+			name:        "primeira detecção inicia a carência",
+			gracePeriod: "30m",
+			wantPending: 1,
+			wantTracked: map[string]bool{orphanKey: true},
+			wantExists:  true,
+		},
+		{
+			name:        "carência em andamento mantém o recurso",
+			gracePeriod: "30m",
+			firstSeen:   map[string]time.Duration{orphanKey: 10 * time.Minute},
+			wantPending: 1,
+			wantTracked: map[string]bool{orphanKey: true},
+			wantExists:  true,
+		},
+		{
+			name:        "carência vencida remove o recurso",
+			gracePeriod: "30m",
+			firstSeen:   map[string]time.Duration{orphanKey: time.Hour},
+			wantRemoved: 1,
+		},
+		{
+			name:        "carência zero remove na primeira detecção",
+			gracePeriod: "0s",
+			wantRemoved: 1,
+		},
+		{
+			name:        "dry-run não registra a carência",
+			gracePeriod: "30m",
+			dryRun:      true,
+			wantPending: 1,
+			wantExists:  true,
+		},
+		{
+			name:        "dry-run com carência vencida apenas relata",
+			gracePeriod: "30m",
+			dryRun:      true,
+			firstSeen:   map[string]time.Duration{orphanKey: time.Hour},
+			wantRemoved: 1,
+			wantTracked: map[string]bool{orphanKey: true},
+			wantExists:  true,
+		},
+		{
+			name:        "recurso que deixou de ser órfão recomeça a carência",
+			gracePeriod: "30m",
+			firstSeen:   map[string]time.Duration{orphanKey: 10 * time.Minute, staleKey: time.Hour},
+			wantPending: 1,
+			wantTracked: map[string]bool{orphanKey: true},
+			wantExists:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lm := newTestLabManager(t, []testLab{{"lab-active", "active", "linux", ""}})
+			ctx := context.Background()
+			ghost := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{
+				Name:   "lab-ghost",
+				Labels: map[string]string{"createdBy": "girus"},
+			}}
+			if _, err := lm.clientset.CoreV1().Namespaces().Create(ctx, ghost, metav1.CreateOptions{}); err != nil {
+				t.Fatal(err)
+			}
+
+			gc := NewGarbageCollector(lm, GCConfig{GracePeriod: tt.gracePeriod})
+			now := time.Now()
+			for key, age := range tt.firstSeen {
+				gc.firstSeen[key] = now.Add(-age)
+			}
+
+			report, err := gc.Run(tt.dryRun)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(report.Pending) != tt.wantPending || len(report.Removed) != tt.wantRemoved {
+				t.Fatalf("pendentes = %v, removidos = %v; esperado %d e %d", report.Pending, report.Removed, tt.wantPending, tt.wantRemoved)
+			}
+			for _, resource := range append(report.Pending, report.Removed...) {
+				if resource.Kind != "Namespace" || resource.Name != "lab-ghost" {
+					t.Errorf("recurso inesperado no relatório: %+v", resource)
+				}
+			}
+
+			if len(gc.firstSeen) != len(tt.wantTracked) {
+				t.Errorf("carências registradas = %v, esperado %v", gc.firstSeen, tt.wantTracked)
+			}
+			for key := range tt.wantTracked {
+				if _, ok := gc.firstSeen[key]; !ok {
+					t.Errorf("carência de %s não registrada", key)
+				}
+			}
+
+			_, err = lm.clientset.CoreV1().Namespaces().Get(ctx, "lab-ghost", metav1.GetOptions{})
+			if exists := err == nil; exists != tt.wantExists {
+				t.Errorf("namespace órfão existe = %v, esperado %v (%v)", exists, tt.wantExists, err)
+			} else if !exists && !errors.IsNotFound(err) {
+				t.Fatal(err)
+			}
+			if _, err := lm.clientset.CoreV1().Namespaces().Get(ctx, "lab-active", metav1.GetOptions{}); err != nil {
+				t.Errorf("namespace com laboratório ativo removido: %v", err)
+			}
+		})
+	}
+}
+
+func TestGarbageCollectorRetention(t *testing.T) {
+	tests := []struct {
+		name        string
+		setup       func(t *testing.T, lm *LabManager, ns *v1.Namespace)
+		wantRemoved []string // Recursos removidos, no formato Tipo/nome
+		wantExists  bool     // O namespace ainda existe após a execução
+	}{
+		{
+			name:        "namespace sem laboratório é removido",
+			wantRemoved: []string{"Namespace/lab-ghost"},
+		},
+		{
+			name: "laboratório pausado perde apenas os ConfigMaps",
+			setup: func(t *testing.T, lm *LabManager, ns *v1.Namespace) {
+				ns.Annotations = map[string]string{pausedAtAnnotation: time.Now().Format(time.RFC3339)}
+			},
+			wantRemoved: []string{"ConfigMap/lab-files", "ConfigMap/lab-init-script"},
+			wantExists:  true,
+		},
+		{
+			name: "workspace persistente perde apenas os ConfigMaps",
+			setup: func(t *testing.T, lm *LabManager, ns *v1.Namespace) {
+				claim := &v1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{
+					Name:   "workspace-default",
+					Labels: map[string]string{"app": "girus-workspace"},
+				}}
+				if _, err := lm.clientset.CoreV1().PersistentVolumeClaims(ns.Name).Create(context.Background(), claim, metav1.CreateOptions{}); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantRemoved: []string{"ConfigMap/lab-files", "ConfigMap/lab-init-script"},
+			wantExists:  true,
+		},
+		{
+			name: "namespace ocioso do warm pool é mantido",
+			setup: func(t *testing.T, lm *LabManager, ns *v1.Namespace) {
+				ns.Labels[poolLabel] = "idle"
+			},
+			wantExists: true,
+		},
+		{
+			name: "namespace controlado pelo operador é mantido",
+			setup: func(t *testing.T, lm *LabManager, ns *v1.Namespace) {
+				client, err := lm.backend.DynamicClient()
+				if err != nil {
+					t.Fatal(err)
+				}
+				lm.operator = NewLabOperator(lm, OperatorConfig{}, client)
+				lab := &GirusLab{
+					ObjectMeta: metav1.ObjectMeta{Name: "ghost", Namespace: "girus"},
+					Spec:       GirusLabSpec{User: "ghost"},
+					Status:     GirusLabStatus{Namespace: ns.Name, Phase: GirusLabReady},
+				}
+				obj, err := lab.toUnstructured()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := lm.operator.informer.GetIndexer().Add(obj); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantExists: true,
+		},
+		{
+			name: "usuário com operação em andamento é mantido",
+			setup: func(t *testing.T, lm *LabManager, ns *v1.Namespace) {
+				lm.operations.Create("create-lab", "ghost", "linux")
+			},
+			wantExists: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lm := newTestLabManager(t, nil)
+			ctx := context.Background()
+			ghost := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{
+				Name:   "lab-ghost",
+				Labels: map[string]string{"createdBy": "girus"},
+			}}
+			if tt.setup != nil {
+				tt.setup(t, lm, ghost)
+			}
+			if _, err := lm.clientset.CoreV1().Namespaces().Create(ctx, ghost, metav1.CreateOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			// ConfigMaps do laboratório (marcado e legado) e um criado pelo aluno
+			for _, configMap := range []*v1.ConfigMap{
+				{ObjectMeta: metav1.ObjectMeta{Name: "lab-files", Labels: map[string]string{"createdBy": "girus"}}},
+				{ObjectMeta: metav1.ObjectMeta{Name: "lab-init-script"}},
+				{ObjectMeta: metav1.ObjectMeta{Name: "app-config"}},
+			} {
+				if _, err := lm.clientset.CoreV1().ConfigMaps(ghost.Name).Create(ctx, configMap, metav1.CreateOptions{}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			report, err := NewGarbageCollector(lm, GCConfig{GracePeriod: "0s"}).Run(false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			removed := []string{}
+			for _, resource := range report.Removed {
+				removed = append(removed, resource.Kind+"/"+resource.Name)
+			}
+			sort.Strings(removed)
+			if !equalStrings(removed, tt.wantRemoved) {
+				t.Errorf("removidos = %v, esperado %v", removed, tt.wantRemoved)
+			}
+
+			_, err = lm.clientset.CoreV1().Namespaces().Get(ctx, ghost.Name, metav1.GetOptions{})
+			if exists := err == nil; exists != tt.wantExists {
+				t.Errorf("namespace existe = %v, esperado %v (%v)", exists, tt.wantExists, err)
+			}
+			if tt.wantExists {
+				if _, err := lm.clientset.CoreV1().ConfigMaps(ghost.Name).Get(ctx, "app-config", metav1.GetOptions{}); err != nil {
+					t.Errorf("ConfigMap do aluno removido: %v", err)
+				}
+			}
+		})
+	}
+}
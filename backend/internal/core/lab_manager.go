@@ -6,24 +6,18 @@ import (
 	"fmt"
 	"log"
 	"math/rand"
-	"os"
-	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
 
 	"encoding/base64"
-	"sync"
+	"sort"
 
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/kubernetes/scheme"
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/tools/remotecommand"
 	"k8s.io/utils/pointer"
 )
 
@@ -39,11 +33,19 @@ func init() {
 }
 
 type LabManager struct {
-	clientset  *kubernetes.Clientset
-	config     *rest.Config
+	clientset  kubernetes.Interface
+	backend    LabBackend
 	templates  *TemplateManager
-	mu         sync.RWMutex
-	userLabMap map[string]string
+	pool       *WarmPool         // nil quando o warm pool está desabilitado
+	workspaces *WorkspaceManager // nil quando os workspaces persistentes estão desabilitados
+	snapshots  SnapshotStore     // nil quando os snapshots estão desabilitados
+	operations *OperationTracker // Criações de laboratório em andamento
+	terminals  *TerminalRegistry // Terminais conectados a cada laboratório
+	prepull    *ImagePrepuller   // nil quando o pré-download de imagens está desabilitado
+	capacity   *CapacityManager  // nil quando não há limites de capacidade
+	cache      *LabCache         // nil quando o cache de informers está desabilitado
+	operator   *LabOperator      // nil quando o modo operador está desabilitado
+	gc         *GarbageCollector // nil quando a coleta de recursos órfãos está desabilitada
 }
 
 // contextWithTimeout cria um contexto com timeout para operações Kubernetes
@@ -51,78 +53,343 @@ func contextWithTimeout() (context.Context, context.CancelFunc) {
 	return context.WithTimeout(context.Background(), 30*time.Second)
 }
 
+// NewLabManager cria um LabManager usando o backend definido na configuração
 func NewLabManager() (*LabManager, error) {
+	return NewLabManagerFromConfig(config)
+}
+
+// NewLabManagerFromConfig cria um LabManager usando o backend definido em cfg,
+// recorrendo à configuração global quando cfg não define nenhum
+func NewLabManagerFromConfig(cfg *Config) (*LabManager, error) {
+	backendName := cfg.Lab.Backend
+	if backendName == "" {
+		backendName = config.Lab.Backend
+	}
+
+	backend, err := NewLabBackend(backendName)
+	if err != nil {
+		return nil, err
+	}
+	return NewLabManagerWithBackend(backend), nil
+}
+
+// NewLabManagerWithBackend cria um LabManager sobre um backend já inicializado
+func NewLabManagerWithBackend(backend LabBackend) *LabManager {
 	// Inicializar o gerador de números aleatórios
 	rand.Seed(time.Now().UnixNano())
 
-	// Configuração para acessar o cluster
-	config, err := rest.InClusterConfig()
-	if err != nil {
-		// Fallback para desenvolvimento local
-		kubeconfig := os.Getenv("KUBECONFIG")
-		if kubeconfig == "" {
-			kubeconfig = filepath.Join(os.Getenv("HOME"), ".kube", "config")
+	lm := &LabManager{
+		clientset:  backend.Clientset(),
+		backend:    backend,
+		templates:  NewTemplateManager(),
+		operations: NewOperationTracker(),
+		terminals:  NewTerminalRegistry(),
+	}
+	lm.templates.executor = lm.ExecuteCommandInContainer
+
+	// Carregar templates de laboratório
+	if err := lm.templates.LoadTemplates(lm.clientset); err != nil {
+		log.Printf("Aviso: Erro ao carregar templates: %v", err)
+	}
+	if err := lm.templates.LoadTemplatesFromDir(config.Lab.TemplatesDir); err != nil {
+		log.Printf("Aviso: Erro ao carregar templates de %s: %v", config.Lab.TemplatesDir, err)
+	}
+
+	if !config.Lab.DisableCache {
+		lm.cache = NewLabCache(lm.clientset)
+	}
+	if config.Lab.Operator.Enabled {
+		if client, err := backend.DynamicClient(); err != nil {
+			log.Printf("Aviso: modo operador desabilitado: %v", err)
+		} else {
+			lm.operator = NewLabOperator(lm, config.Lab.Operator, client)
 		}
-		config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+	}
+	if !config.Lab.GC.Disabled {
+		lm.gc = NewGarbageCollector(lm, config.Lab.GC)
+	}
+	if config.Lab.WarmPool.Enabled {
+		lm.pool = NewWarmPool(lm, config.Lab.WarmPool)
+	}
+	if config.Lab.Capacity.limited() {
+		lm.capacity = NewCapacityManager(lm, config.Lab.Capacity)
+	}
+	if config.Lab.Prepull.Enabled {
+		lm.prepull = NewImagePrepuller(lm, config.Lab.Prepull)
+	}
+	if config.Lab.Workspace.Enabled {
+		lm.workspaces = NewWorkspaceManager(lm, config.Lab.Workspace)
+	}
+	if config.Lab.Snapshot.Enabled {
+		maxSize := resource.MustParse(config.Lab.Snapshot.MaxSize)
+		store, err := NewFileSnapshotStore(config.Lab.Snapshot.Dir, maxSize.Value())
 		if err != nil {
-			log.Printf("Erro ao carregar kubeconfig: %v", err)
-			return nil, fmt.Errorf("falha ao obter configuração do cluster: %v", err)
+			log.Printf("Aviso: snapshots desabilitados: %v", err)
+		} else {
+			lm.snapshots = store
 		}
-		log.Printf("Usando kubeconfig: %s", kubeconfig)
 	}
 
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		log.Printf("Erro ao criar clientset: %v", err)
-		return nil, fmt.Errorf("falha ao criar cliente Kubernetes: %v", err)
+	log.Printf("Gerenciador de laboratórios iniciado com o backend %s", backend.Name())
+	return lm
+}
+
+// namespaceForUser retorna o namespace do laboratório do usuário: o namespace
+// entregue pelo warm pool, quando houver, ou lab-<userID>
+func (lm *LabManager) namespaceForUser(userID string) string {
+	if lm.pool != nil {
+		if namespace, ok := lm.pool.NamespaceFor(userID); ok {
+			return namespace
+		}
 	}
+	return fmt.Sprintf("lab-%s", userID)
+}
+
+// deleteNamespace exclui um namespace de laboratório e tudo o que ele contém
+func (lm *LabManager) deleteNamespace(namespace string) {
+	// O backend local mantém os pods fora do namespace, então eles são removidos antes
+	lm.deleteLabPods(namespace)
 
-	// Verificar conexão com o cluster
 	ctx, cancel := contextWithTimeout()
 	defer cancel()
-	_, err = clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	err := lm.clientset.CoreV1().Namespaces().Delete(ctx, namespace, metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		log.Printf("Erro ao excluir namespace %s: %v", namespace, err)
+	}
+}
+
+// deleteLabPods exclui imediatamente os pods de laboratório do namespace
+func (lm *LabManager) deleteLabPods(namespace string) {
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+	pods, err := lm.backend.ListLabs(ctx, namespace, metav1.ListOptions{})
 	if err != nil {
-		return nil, fmt.Errorf("erro ao conectar ao cluster Kubernetes: %v", err)
+		return
 	}
-	log.Printf("Conexão com o cluster estabelecida com sucesso")
+	for _, pod := range pods {
+		_ = lm.backend.DeleteLab(ctx, namespace, pod.Name, metav1.DeleteOptions{
+			GracePeriodSeconds: pointer.Int64(0),
+		})
+	}
+}
 
-	lm := &LabManager{
-		clientset:  clientset,
-		config:     config,
-		templates:  NewTemplateManager(),
-		userLabMap: make(map[string]string),
+// StartCache inicia os informers que servem as leituras de pods e namespaces, quando habilitados
+func (lm *LabManager) StartCache(ctx context.Context) {
+	if lm.cache != nil {
+		lm.cache.Start(ctx)
+	}
+}
+
+// StartOperator inicia a reconciliação dos recursos GirusLab, quando habilitada
+func (lm *LabManager) StartOperator(ctx context.Context) {
+	if lm.operator != nil {
+		lm.operator.Start(ctx)
 	}
+}
 
-	// Carregar templates de laboratório
-	if err := lm.templates.LoadTemplates(clientset); err != nil {
-		log.Printf("Aviso: Erro ao carregar templates: %v", err)
+// StartWarmPool inicia o warm pool, quando habilitado
+func (lm *LabManager) StartWarmPool(ctx context.Context) {
+	if lm.pool != nil {
+		lm.pool.Start(ctx)
+	}
+}
+
+// StartTemplateReload relê periodicamente os templates, aplicando as mudanças
+// sem reiniciar o servidor
+func (lm *LabManager) StartTemplateReload(ctx context.Context) {
+	interval, err := time.ParseDuration(config.Lab.TemplateReload)
+	if err != nil || interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := lm.templates.Reload(lm.clientset, config.Lab.TemplatesDir); err != nil {
+					log.Printf("Erro ao recarregar templates: %v", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// StartImagePrepull inicia o pré-download das imagens dos templates, quando habilitado
+func (lm *LabManager) StartImagePrepull(ctx context.Context) {
+	if lm.prepull != nil {
+		lm.prepull.Start(ctx)
 	}
+}
+
+// GetPrepullStatus retorna o estado do pré-download de imagens em cada nó
+func (lm *LabManager) GetPrepullStatus() (*PrepullStatus, error) {
+	if lm.prepull == nil {
+		return &PrepullStatus{Enabled: false, Images: []string{}, Nodes: []NodePrepullStatus{}, Templates: []TemplateWarmth{}}, nil
+	}
+	return lm.prepull.Status()
+}
+
+// StartWorkspaceCleanup inicia a remoção de workspaces expirados, quando habilitados
+func (lm *LabManager) StartWorkspaceCleanup(ctx context.Context) {
+	if lm.workspaces != nil {
+		lm.workspaces.Start(ctx)
+	}
+}
+
+// ListWorkspaces retorna os workspaces persistentes do usuário
+func (lm *LabManager) ListWorkspaces(userID string) ([]WorkspaceInfo, error) {
+	if lm.workspaces == nil {
+		return []WorkspaceInfo{}, nil
+	}
+	return lm.workspaces.List(userID)
+}
 
-	return lm, nil
+// DeleteWorkspace exclui um workspace persistente do usuário
+func (lm *LabManager) DeleteWorkspace(userID, name string) error {
+	if lm.workspaces == nil {
+		return fmt.Errorf("workspaces persistentes estão desabilitados")
+	}
+	return lm.workspaces.Delete(userID, name)
+}
+
+// usesWorkspace indica se os laboratórios do template montam o workspace persistente
+func (lm *LabManager) usesWorkspace(template *LabTemplate) bool {
+	return lm.workspaces != nil && lm.workspaces.AppliesTo(template)
+}
+
+// GetPoolStats retorna o estado do warm pool
+func (lm *LabManager) GetPoolStats() (PoolStats, error) {
+	if lm.pool == nil {
+		return PoolStats{Enabled: false, Templates: []PoolTemplateStats{}}, nil
+	}
+	return lm.pool.Stats()
 }
 
 func (lm *LabManager) CreateLabEnvironment(userId string, templateName string) error {
+	_, err := lm.createUserLab(userId, templateName, labCreateOptions{}, nil)
+	return err
+}
+
+// createUserLab cria o laboratório do usuário (ou o obtém do warm pool) e retorna seu pod.
+// As fases da criação são publicadas em progress, quando informado.
+func (lm *LabManager) createUserLab(userId string, templateName string, opts labCreateOptions, progress ProgressFunc) (*v1.Pod, error) {
 	// Obter o template do laboratório
 	template := lm.templates.GetTemplate(templateName)
 	if template == nil {
-		return fmt.Errorf("template %s não encontrado", templateName)
+		return nil, fmt.Errorf("template %s não encontrado", templateName)
+	}
+	return lm.createLabFromTemplate(userId, template, opts, progress)
+}
+
+// labCreateOptions ajusta a criação de um laboratório
+type labCreateOptions struct {
+	skipPool bool // O template foi ajustado (recursos de um GirusLab) e o warm pool não corresponde a ele
+	fresh    bool // Sempre cria um laboratório novo, sem reaproveitar o que o usuário já tem
+	admitted bool // A vaga já foi reservada pela fila de capacidade
+}
+
+// createLabFromTemplate cria o laboratório do usuário a partir de um template já resolvido
+func (lm *LabManager) createLabFromTemplate(userId string, template *LabTemplate, opts labCreateOptions, progress ProgressFunc) (*v1.Pod, error) {
+	templateName := template.Name
+
+	// Resolver o runtime declarado pelo template (ou o perfil embutido equivalente)
+	runtime, err := ResolveRuntime(template)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao resolver runtime do template %s: %v", templateName, err)
+	}
+
+	// Pedidos repetidos devolvem o laboratório que o usuário já tem
+	if !opts.fresh {
+		existing, err := lm.existingLab(userId, templateName)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			log.Printf("Laboratório existente reaproveitado: namespace=%s, pod=%s", existing.Namespace, existing.Name)
+			progress.report(PhaseReused, fmt.Sprintf("Laboratório %s reaproveitado", existing.Name))
+			return existing, nil
+		}
+	}
+
+	// Criações fora da fila também respeitam os limites de capacidade
+	if !opts.admitted {
+		release, err := lm.reserveCapacity(LabRequest{UserID: userId, Template: templateName})
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+
+	// Reaproveitar um laboratório pré-provisionado do warm pool, quando disponível.
+	// Laboratórios com workspace persistente precisam do PVC no namespace do
+	// usuário e por isso são sempre criados sob demanda.
+	if lm.pool != nil && !opts.skipPool {
+		if lm.usesWorkspace(template) {
+			lm.pool.Discard(userId)
+		} else if namespace, podName, ok := lm.pool.Claim(userId, templateName); ok {
+			log.Printf("Laboratório entregue a partir do warm pool: namespace=%s, pod=%s", namespace, podName)
+			// O token emitido ao abastecer o pool pode estar perto de expirar
+			if kubeAccessEnabled(template) {
+				if _, err := lm.writeLabKubeconfig(namespace, template); err != nil {
+					log.Printf("Erro ao renovar o kubeconfig do laboratório %s: %v", namespace, err)
+				}
+			}
+			progress.report(PhaseNamespaceReady, fmt.Sprintf("Laboratório %s entregue pelo warm pool", namespace))
+			pod, err := lm.GetPod(namespace, podName)
+			if err == nil {
+				lm.replaceUserLabs(userId, pod)
+			}
+			return pod, err
+		}
 	}
 
 	// Gerar nome do namespace e pod
-	namespace := fmt.Sprintf("lab-%s", userId)
+	namespace := lm.namespaceForUser(userId)
 	podName := generateUniquePodName("lab", userId)
 
 	// Criar namespace se não existir
+	err = lm.ensureNamespace(namespace, map[string]string{
+		"createdBy": "girus",
+		"userId":    userId,
+	})
+	if err != nil {
+		return nil, err
+	}
+	progress.report(PhaseNamespaceReady, fmt.Sprintf("Namespace %s pronto", namespace))
+
+	// Um novo laboratório descarta a pausa, as extensões e o histórico de tarefas do laboratório anterior
+	previousState := append(append(append([]string{}, pauseAnnotations...), extensionAnnotations...), resetAnnotations...)
+	if err := lm.clearNamespaceAnnotations(namespace, append(previousState, validatedTasksAnnotation)...); err != nil {
+		log.Printf("Erro ao descartar estado anterior do namespace %s: %v", namespace, err)
+	}
+
+	pod, err := lm.provisionLab(namespace, podName, template, runtime, map[string]string{
+		"app":      "girus-lab",
+		"user":     userId,
+		"template": templateName,
+	}, progress)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Laboratório criado com sucesso: namespace=%s, pod=%s", namespace, podName)
+	lm.replaceUserLabs(userId, pod)
+	return pod, nil
+}
+
+// ensureNamespace cria o namespace do laboratório caso ele ainda não exista
+func (lm *LabManager) ensureNamespace(namespace string, labels map[string]string) error {
 	ctx, cancel := contextWithTimeout()
 	defer cancel()
 	_, err := lm.clientset.CoreV1().Namespaces().Create(ctx,
 		&v1.Namespace{
 			ObjectMeta: metav1.ObjectMeta{
-				Name: namespace,
-				Labels: map[string]string{
-					"createdBy": "girus",
-					"userId":    userId,
-				},
+				Name:   namespace,
+				Labels: labels,
 			},
 		},
 		metav1.CreateOptions{},
@@ -130,21 +397,37 @@ func (lm *LabManager) CreateLabEnvironment(userId string, templateName string) e
 	if err != nil && !strings.Contains(err.Error(), "already exists") {
 		return fmt.Errorf("erro ao criar namespace: %v", err)
 	}
+	return nil
+}
+
+// provisionLab cria os ConfigMaps e o pod de um laboratório em um namespace existente
+func (lm *LabManager) provisionLab(namespace, podName string, template *LabTemplate, runtime *LabRuntime, labels map[string]string, progress ProgressFunc) (*v1.Pod, error) {
+	templateName := template.Name
+
+	// Aplicar a política de segurança antes de criar qualquer recurso
+	labSecurity, err := containerSecurityContext(labContainerName, template.Security, runtime.Privileged)
+	if err != nil {
+		return nil, err
+	}
+	sidecars, err := sidecarContainers(template)
+	if err != nil {
+		return nil, err
+	}
 
 	// Limpar recursos existentes se necessário
 	// Se um pod com o mesmo nome já existe, vamos excluí-lo primeiro
-	ctx, cancel = contextWithTimeout()
+	ctx, cancel := contextWithTimeout()
 	defer cancel()
-	_, err = lm.clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	_, err = lm.backend.GetLab(ctx, namespace, podName)
 	if err == nil {
 		// Pod existe, vamos excluí-lo
 		ctx, cancel = contextWithTimeout()
 		defer cancel()
-		err = lm.clientset.CoreV1().Pods(namespace).Delete(ctx, podName, metav1.DeleteOptions{
+		err = lm.backend.DeleteLab(ctx, namespace, podName, metav1.DeleteOptions{
 			GracePeriodSeconds: pointer.Int64(0), // Forçar exclusão imediata
 		})
 		if err != nil {
-			return fmt.Errorf("erro ao limpar pod existente: %v", err)
+			return nil, fmt.Errorf("erro ao limpar pod existente: %v", err)
 		}
 		log.Printf("Pod existente %s/%s excluído para recriação", namespace, podName)
 
@@ -152,342 +435,166 @@ func (lm *LabManager) CreateLabEnvironment(userId string, templateName string) e
 		time.Sleep(2 * time.Second)
 	}
 
-	// Verificar se ConfigMap de script já existe e excluir se necessário
-	configMapName := "lab-files"
-	ctx, cancel = contextWithTimeout()
-	defer cancel()
-	_, err = lm.clientset.CoreV1().ConfigMaps(namespace).Get(ctx, configMapName, metav1.GetOptions{})
-	if err == nil {
-		// ConfigMap existe, excluir
-		ctx, cancel = contextWithTimeout()
-		defer cancel()
-		err = lm.clientset.CoreV1().ConfigMaps(namespace).Delete(ctx, configMapName, metav1.DeleteOptions{})
-		if err != nil {
-			return fmt.Errorf("erro ao excluir ConfigMap existente: %v", err)
-		}
-	}
-
 	// Criar ConfigMap com arquivos do laboratório
 	fileData := make(map[string]string)
 	fileData["welcome.md"] = fmt.Sprintf("# Bem-vindo ao Laboratório %s\n\n%s\n\n## Tarefas\n\n%s",
 		template.Title, template.Description, formatTasks(template.Tasks))
 
-	ctx, cancel = contextWithTimeout()
-	defer cancel()
-	_, err = lm.clientset.CoreV1().ConfigMaps(namespace).Create(ctx,
-		&v1.ConfigMap{
-			ObjectMeta: metav1.ObjectMeta{
-				Name: configMapName,
-			},
-			Data: fileData,
+	err = lm.recreateConfigMap(namespace, &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "lab-files",
+			Labels: map[string]string{"createdBy": "girus"},
 		},
-		metav1.CreateOptions{},
-	)
+		Data: fileData,
+	})
 	if err != nil {
-		return fmt.Errorf("erro ao criar ConfigMap: %v", err)
+		return nil, fmt.Errorf("erro ao criar ConfigMap: %v", err)
 	}
 
-	// Verificar se é um lab de Kubernetes
-	isKubernetesLab := strings.Contains(templateName, "kubernetes")
-
-	// Verificar se é um lab de Docker
-	isDockerLab := strings.Contains(strings.ToLower(templateName), "docker")
-
-	// Verificar se é um lab de AWS/LocalStack
-	isLocalStackLab := strings.Contains(strings.ToLower(templateName), "aws") ||
-		strings.Contains(strings.ToLower(templateName), "localstack")
-
-	// Para labs que não são de Kubernetes, criar o script de inicialização
-	if !isKubernetesLab && !isDockerLab && !isLocalStackLab {
-		// Verificar se ConfigMap de inicialização já existe e excluir se necessário
-		k3sInitScriptName := "k3s-init-script"
-		ctx, cancel = contextWithTimeout()
-		defer cancel()
-		_, err = lm.clientset.CoreV1().ConfigMaps(namespace).Get(ctx, k3sInitScriptName, metav1.GetOptions{})
-		if err == nil {
-			// ConfigMap existe, excluir
-			ctx, cancel = contextWithTimeout()
-			defer cancel()
-			err = lm.clientset.CoreV1().ConfigMaps(namespace).Delete(ctx, k3sInitScriptName, metav1.DeleteOptions{})
-			if err != nil {
-				return fmt.Errorf("erro ao excluir ConfigMap de inicialização existente: %v", err)
-			}
-		}
-
-		// Criar ConfigMap com script de inicialização do K3s
-		ctx, cancel = contextWithTimeout()
-		defer cancel()
-		_, err = lm.clientset.CoreV1().ConfigMaps(namespace).Create(ctx,
-			&v1.ConfigMap{
-				ObjectMeta: metav1.ObjectMeta{
-					Name: k3sInitScriptName,
-				},
-				Data: map[string]string{
-					"init.sh": generateK3sInitScript(),
-				},
+	// Criar o ConfigMap com o script de inicialização, quando o runtime declarar um
+	if runtime.InitScript != nil {
+		err = lm.recreateConfigMap(namespace, &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   runtime.InitScript.Name,
+				Labels: map[string]string{"createdBy": "girus"},
 			},
-			metav1.CreateOptions{},
-		)
-		if err != nil && !strings.Contains(err.Error(), "already exists") {
-			return fmt.Errorf("erro ao criar ConfigMap de inicialização: %v", err)
+			Data: map[string]string{
+				runtime.InitScript.FileName: runtime.InitScript.Content,
+			},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("erro ao criar ConfigMap de inicialização %s: %v", runtime.InitScript.Name, err)
 		}
+		log.Printf("Script de inicialização %s criado para o laboratório %s", runtime.InitScript.Name, templateName)
 	} else {
-		log.Printf("Lab de Kubernetes, Docker ou AWS/LocalStack detectado, pulando criação do script de inicialização para %s", templateName)
+		log.Printf("Runtime %s não declara script de inicialização para %s", runtime.Profile, templateName)
 	}
+	progress.report(PhaseFilesCreated, "Arquivos do laboratório criados")
 
-	// Para labs Docker, criar e montar um script de inicialização Docker
-	if isDockerLab {
-		// Verificar se ConfigMap de inicialização já existe e excluir se necessário
-		dockerInitScriptName := "docker-init-script"
-		ctx, cancel = contextWithTimeout()
-		defer cancel()
-		_, err = lm.clientset.CoreV1().ConfigMaps(namespace).Get(ctx, dockerInitScriptName, metav1.GetOptions{})
-		if err == nil {
-			// ConfigMap existe, excluir
-			ctx, cancel = contextWithTimeout()
-			defer cancel()
-			err = lm.clientset.CoreV1().ConfigMaps(namespace).Delete(ctx, dockerInitScriptName, metav1.DeleteOptions{})
-			if err != nil {
-				return fmt.Errorf("erro ao excluir ConfigMap de inicialização Docker existente: %v", err)
-			}
+	// Isolar o namespace antes de o pod começar a rodar
+	if !config.Lab.Network.DisablePolicies {
+		if err := lm.applyNetworkPolicies(namespace, template); err != nil {
+			return nil, err
 		}
+	}
 
-		// Criar ConfigMap com script de inicialização do Docker
-		ctx, cancel = contextWithTimeout()
-		defer cancel()
-		_, err = lm.clientset.CoreV1().ConfigMaps(namespace).Create(ctx,
-			&v1.ConfigMap{
-				ObjectMeta: metav1.ObjectMeta{
-					Name: dockerInitScriptName,
-				},
-				Data: map[string]string{
-					"init-docker.sh": generateDockerInitScript(),
-				},
-			},
-			metav1.CreateOptions{},
-		)
-		if err != nil && !strings.Contains(err.Error(), "already exists") {
-			return fmt.Errorf("erro ao criar ConfigMap de inicialização Docker: %v", err)
+	// Limitar os recursos que o aluno pode criar no namespace
+	if !config.Lab.DisableQuotas {
+		if err := lm.applyNamespaceQuota(namespace, template); err != nil {
+			return nil, err
+		}
+	}
+
+	// Credencial própria do laboratório, restrita ao namespace
+	accessEnabled := kubeAccessEnabled(template)
+	if accessEnabled {
+		if err := lm.ensureLabAccess(namespace, template); err != nil {
+			return nil, err
 		}
-		log.Printf("Script de inicialização Docker criado para o laboratório %s", templateName)
 	}
 
 	// Criar o pod no Kubernetes
 	log.Printf("Criando pod %s no namespace %s", podName, namespace)
+	log.Printf("Usando imagem %s para o laboratório", runtime.Image)
 
-	// Obter a imagem correta para o template
-	var labImage string
+	volumes, volumeMounts := runtime.podVolumes()
 
-	// Verificar se o template tem uma imagem personalizada definida
-	if template != nil && template.Image != "" {
-		labImage = template.Image
-		log.Printf("Usando imagem personalizada do template: %s", labImage)
-	} else {
-		// Caso contrário, usar a lógica de seleção de imagem padrão
-		labImage = GetImageForTemplate(templateName, "")
+	// Montar o workspace persistente do usuário (laboratórios do warm pool ainda não têm usuário)
+	if userID := labels["user"]; userID != "" && lm.usesWorkspace(template) && namespace == workspaceNamespace(userID) {
+		volume, mount, err := lm.workspaces.Volume(userID, template)
+		if err != nil {
+			return nil, err
+		}
+		volumes = append(volumes, volume)
+		volumeMounts = append(volumeMounts, mount)
 	}
 
-	log.Printf("Usando imagem %s para o laboratório", labImage)
-
-	// Verificar se é um lab de Kubernetes
-	isKubernetesLab = strings.Contains(templateName, "kubernetes")
-
-	// Verificar se é um lab de Docker
-	isDockerLab = strings.Contains(strings.ToLower(templateName), "docker")
-
-	// Verificar se é um lab de AWS/LocalStack
-	isLocalStackLab = strings.Contains(strings.ToLower(templateName), "aws") ||
-		strings.Contains(strings.ToLower(templateName), "localstack")
-
-	// Definir comando com base no tipo de laboratório
-	var command []string
-	if isKubernetesLab {
-		command = []string{"/bin/bash", "-c", "tail -f /dev/null"}
-	} else if isDockerLab {
-		command = []string{"/bin/bash", "-c", "/scripts/init-docker.sh"}
-	} else if isLocalStackLab {
-		// Para LocalStack, usar o entrypoint da imagem
-		command = []string{"/bin/bash", "-c", "/entrypoint.sh"}
-	} else {
-		command = []string{"/bin/bash", "-c", "/scripts/init.sh"}
+	var labEnv []v1.EnvVar
+	if accessEnabled {
+		volume, mount, env := kubeconfigVolume(template)
+		volumes = append(volumes, volume)
+		volumeMounts = append(volumeMounts, mount)
+		labEnv = append(labEnv, env)
 	}
 
-	// Definir volumes e volume mounts com base no tipo de laboratório
-	var volumeMounts []v1.VolumeMount
-	var volumes []v1.Volume
-
-	if isKubernetesLab {
-		// Para labs de Kubernetes, não precisa montar scripts de inicialização
-		volumeMounts = []v1.VolumeMount{
-			{
-				Name:      "lab-files",
-				MountPath: "/lab-files",
-			},
-		}
-
-		volumes = []v1.Volume{
-			{
-				Name: "lab-files",
-				VolumeSource: v1.VolumeSource{
-					ConfigMap: &v1.ConfigMapVolumeSource{
-						LocalObjectReference: v1.LocalObjectReference{
-							Name: "lab-files",
-						},
-					},
-				},
-			},
-		}
-	} else if isDockerLab {
-		// Para labs Docker, montar apenas o script de inicialização Docker
-		volumeMounts = []v1.VolumeMount{
-			{
-				Name:      "docker-init-script",
-				MountPath: "/scripts",
-			},
-			{
-				Name:      "lab-files",
-				MountPath: "/lab-files",
-			},
-		}
-
-		volumes = []v1.Volume{
-			{
-				Name: "docker-init-script",
-				VolumeSource: v1.VolumeSource{
-					ConfigMap: &v1.ConfigMapVolumeSource{
-						LocalObjectReference: v1.LocalObjectReference{
-							Name: "docker-init-script",
-						},
-						DefaultMode: pointer.Int32(0755), // Tornar executável
-					},
-				},
-			},
-			{
-				Name: "lab-files",
-				VolumeSource: v1.VolumeSource{
-					ConfigMap: &v1.ConfigMapVolumeSource{
-						LocalObjectReference: v1.LocalObjectReference{
-							Name: "lab-files",
-						},
-					},
-				},
-			},
-		}
-	} else if isLocalStackLab {
-		// Para labs LocalStack, apenas montar os arquivos do laboratório
-		volumeMounts = []v1.VolumeMount{
-			{
-				Name:      "lab-files",
-				MountPath: "/lab-files",
-			},
-		}
-
-		volumes = []v1.Volume{
-			{
-				Name: "lab-files",
-				VolumeSource: v1.VolumeSource{
-					ConfigMap: &v1.ConfigMapVolumeSource{
-						LocalObjectReference: v1.LocalObjectReference{
-							Name: "lab-files",
-						},
-					},
-				},
-			},
-		}
-	} else {
-		// Para outros labs, montar os scripts de inicialização padrão
-		volumeMounts = []v1.VolumeMount{
-			{
-				Name:      "k3s-init-script",
-				MountPath: "/scripts",
-			},
-			{
-				Name:      "lab-files",
-				MountPath: "/lab-files",
-			},
-		}
-
-		volumes = []v1.Volume{
-			{
-				Name: "k3s-init-script",
-				VolumeSource: v1.VolumeSource{
-					ConfigMap: &v1.ConfigMapVolumeSource{
-						LocalObjectReference: v1.LocalObjectReference{
-							Name: "k3s-init-script",
-						},
-						DefaultMode: pointer.Int32(0755), // Tornar executável
-					},
-				},
-			},
-			{
-				Name: "lab-files",
-				VolumeSource: v1.VolumeSource{
-					ConfigMap: &v1.ConfigMapVolumeSource{
-						LocalObjectReference: v1.LocalObjectReference{
-							Name: "lab-files",
-						},
-					},
-				},
-			},
-		}
+	// Laboratórios com etapas de preparação ficam anotados até concluí-las
+	annotations := map[string]string{}
+	if needsPreparation(template) {
+		annotations[prepareStatusAnnotation] = prepareStatusPreparing
 	}
 
 	// Definir recursos do pod
 	pod := &v1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: podName,
-			Labels: map[string]string{
-				"app":      "girus-lab",
-				"user":     userId,
-				"template": templateName,
-			},
+			Name:        podName,
+			Namespace:   namespace,
+			Labels:      labels,
+			Annotations: annotations,
 		},
 		Spec: v1.PodSpec{
-			Containers: []v1.Container{
+			Containers: append([]v1.Container{
 				{
-					Name:    "lab",
-					Image:   labImage,
-					Command: command,
+					Name:    labContainerName,
+					Image:   runtime.Image,
+					Command: runtime.Command,
+					Env:     labEnv,
 					Ports: []v1.ContainerPort{
 						{
 							ContainerPort: 22,
 							Protocol:      "TCP",
 						},
 					},
-					SecurityContext: &v1.SecurityContext{
-						Privileged: pointer.Bool(true), // Necessário para Docker-in-Docker e Kubernetes
-					},
-					Resources: v1.ResourceRequirements{
-						Requests: v1.ResourceList{
-							v1.ResourceCPU:    resource.MustParse("200m"),
-							v1.ResourceMemory: resource.MustParse("512Mi"),
-						},
-						Limits: v1.ResourceList{
-							v1.ResourceCPU:    resource.MustParse("500m"),
-							v1.ResourceMemory: resource.MustParse("1Gi"),
-						},
-					},
-					VolumeMounts: volumeMounts,
+					SecurityContext: labSecurity,
+					Resources:       createResourceRequirements(resolveResources(template)),
+					VolumeMounts:    volumeMounts,
+					ReadinessProbe:  runtime.readinessProbe(),
 				},
-			},
-			Volumes: volumes,
+			}, sidecars...),
+			Volumes:          volumes,
+			SecurityContext:  podSecurityContext(),
+			RuntimeClassName: runtimeClassName(template.Security),
 		},
 	}
+	applyScheduling(&pod.Spec, template)
 
 	// Criar o pod
 	ctx, cancel = contextWithTimeout()
 	defer cancel()
-	_, err = lm.clientset.CoreV1().Pods(namespace).Create(ctx, pod, metav1.CreateOptions{})
+	created, err := lm.backend.CreateLab(ctx, pod)
+	for attempt := 0; attempt < 5 && quotaStatusUnknown(err); attempt++ {
+		// O controlador de cotas ainda não calculou o uso do ResourceQuota recém-criado
+		time.Sleep(time.Second)
+		created, err = lm.backend.CreateLab(ctx, pod)
+	}
 	if err != nil {
-		return fmt.Errorf("erro ao criar pod: %v", err)
+		return nil, fmt.Errorf("erro ao criar pod: %v", err)
 	}
 
-	log.Printf("Laboratório criado com sucesso: namespace=%s, pod=%s", namespace, podName)
-	return nil
+	if needsPreparation(template) {
+		go lm.prepareLab(created, template)
+	}
+
+	return created, nil
 }
 
-func (lm *LabManager) getKubeConfig() (*rest.Config, error) {
-	return lm.config, nil
+// recreateConfigMap exclui o ConfigMap, se existir, e o cria novamente com o conteúdo atual
+func (lm *LabManager) recreateConfigMap(namespace string, configMap *v1.ConfigMap) error {
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+	_, err := lm.clientset.CoreV1().ConfigMaps(namespace).Get(ctx, configMap.Name, metav1.GetOptions{})
+	if err == nil {
+		// ConfigMap existe, excluir
+		err = lm.clientset.CoreV1().ConfigMaps(namespace).Delete(ctx, configMap.Name, metav1.DeleteOptions{})
+		if err != nil {
+			return fmt.Errorf("erro ao excluir ConfigMap existente: %v", err)
+		}
+	}
+
+	_, err = lm.clientset.CoreV1().ConfigMaps(namespace).Create(ctx, configMap, metav1.CreateOptions{})
+	if err != nil && !errors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
 }
 
 // Função de utilidade para converter mapa em EnvVars do Kubernetes
@@ -517,12 +624,22 @@ func createEnvVarsFromMap(envMap map[string]string) []v1.EnvVar {
 	return envVars
 }
 
+// resolveResources calcula os recursos do contêiner do laboratório campo a campo:
+// template, depois LabConfig.PodResources e por fim os valores embutidos
+func resolveResources(template *LabTemplate) ResourceConfig {
+	resources := config.Lab.PodResources.merge(builtinPodResources)
+	if template.Resources != nil {
+		resources = template.Resources.merge(resources)
+	}
+	return resources
+}
+
 // Função de utilidade para criar requisitos de recursos
 func createResourceRequirements(resources ResourceConfig) v1.ResourceRequirements {
 	reqs := v1.ResourceRequirements{}
 
 	// Adicionar requisitos se configurados
-	if resources.CpuRequest != "" || resources.MemoryRequest != "" {
+	if resources.CpuRequest != "" || resources.MemoryRequest != "" || resources.EphemeralStorageRequest != "" {
 		reqs.Requests = v1.ResourceList{}
 		if resources.CpuRequest != "" {
 			quantity, err := resource.ParseQuantity(resources.CpuRequest)
@@ -536,10 +653,16 @@ func createResourceRequirements(resources ResourceConfig) v1.ResourceRequirement
 				reqs.Requests[v1.ResourceMemory] = quantity
 			}
 		}
+		if resources.EphemeralStorageRequest != "" {
+			quantity, err := resource.ParseQuantity(resources.EphemeralStorageRequest)
+			if err == nil {
+				reqs.Requests[v1.ResourceEphemeralStorage] = quantity
+			}
+		}
 	}
 
 	// Adicionar limites se configurados
-	if resources.CpuLimit != "" || resources.MemoryLimit != "" {
+	if resources.CpuLimit != "" || resources.MemoryLimit != "" || resources.EphemeralStorageLimit != "" {
 		reqs.Limits = v1.ResourceList{}
 		if resources.CpuLimit != "" {
 			quantity, err := resource.ParseQuantity(resources.CpuLimit)
@@ -553,6 +676,12 @@ func createResourceRequirements(resources ResourceConfig) v1.ResourceRequirement
 				reqs.Limits[v1.ResourceMemory] = quantity
 			}
 		}
+		if resources.EphemeralStorageLimit != "" {
+			quantity, err := resource.ParseQuantity(resources.EphemeralStorageLimit)
+			if err == nil {
+				reqs.Limits[v1.ResourceEphemeralStorage] = quantity
+			}
+		}
 	}
 
 	return reqs
@@ -563,39 +692,33 @@ func (lm *LabManager) GetAvailableTemplates() []*LabTemplate {
 	return lm.templates.ListTemplates()
 }
 
-// ExecuteCommandInPod executa um comando em um pod e retorna a saída
-func ExecuteCommandInPod(pod *v1.Pod, command []string) (string, string, error) {
-	// Garantir que o pod existe e está pronto
-	if pod == nil {
-		return "", "", fmt.Errorf("pod nulo fornecido para ExecuteCommandInPod")
-	}
-
-	log.Printf("Executando comando no pod %s/%s: %v", pod.Namespace, pod.Name, command)
+// ExecuteCommandInPod executa um comando no contêiner do laboratório e retorna a saída
+func (lm *LabManager) ExecuteCommandInPod(pod *v1.Pod, command []string) (string, string, error) {
+	return lm.ExecuteCommandInContainer(pod, labContainerName, command)
+}
 
-	config, err := rest.InClusterConfig()
-	if err != nil {
-		// Fallback para desenvolvimento local
-		kubeconfig := os.Getenv("KUBECONFIG")
-		if kubeconfig == "" {
-			kubeconfig = filepath.Join(os.Getenv("HOME"), ".kube", "config")
-		}
-		config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
-		if err != nil {
-			log.Printf("Erro ao obter configuração do Kubernetes: %v", err)
-			return "", "", fmt.Errorf("falha ao obter configuração do cluster: %v", err)
-		}
+// containerShell retorna o shell usado para comandos no contêiner.
+// Imagens de sidecars nem sempre possuem bash, então usam /bin/sh
+func containerShell(container string) string {
+	if container == "" || container == labContainerName {
+		return "/bin/bash"
 	}
+	return "/bin/sh"
+}
 
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		log.Printf("Erro ao criar cliente Kubernetes: %v", err)
-		return "", "", fmt.Errorf("falha ao criar cliente Kubernetes: %v", err)
+// ExecuteCommandInContainer executa um comando em um contêiner do pod e retorna a saída
+func (lm *LabManager) ExecuteCommandInContainer(pod *v1.Pod, container string, command []string) (string, string, error) {
+	// Garantir que o pod existe e está pronto
+	if pod == nil {
+		return "", "", fmt.Errorf("pod nulo fornecido para ExecuteCommandInContainer")
 	}
 
+	log.Printf("Executando comando no contêiner %s do pod %s/%s: %v", container, pod.Namespace, pod.Name, command)
+
 	// Verificar se o pod está em execução
 	ctx, cancel := contextWithTimeout()
 	defer cancel()
-	podStatus, err := clientset.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+	podStatus, err := lm.backend.GetLab(ctx, pod.Namespace, pod.Name)
 	if err != nil {
 		log.Printf("Erro ao obter status do pod %s/%s: %v", pod.Namespace, pod.Name, err)
 		return "", "", fmt.Errorf("falha ao obter status do pod: %v", err)
@@ -606,44 +729,25 @@ func ExecuteCommandInPod(pod *v1.Pod, command []string) (string, string, error)
 		return "", "", fmt.Errorf("pod não está em execução (status: %s)", podStatus.Status.Phase)
 	}
 
-	// Verificar se o pod tem contêineres prontos
-	if len(podStatus.Status.ContainerStatuses) == 0 || !podStatus.Status.ContainerStatuses[0].Ready {
-		log.Printf("Contêiner principal no pod %s/%s não está pronto", pod.Namespace, pod.Name)
-		return "", "", fmt.Errorf("contêiner principal não está pronto")
+	// Verificar se o contêiner alvo está pronto
+	containerStatus, found := findContainerStatus(podStatus, container)
+	if !found || !containerStatus.Ready {
+		log.Printf("Contêiner %s no pod %s/%s não está pronto", container, pod.Namespace, pod.Name)
+		return "", "", fmt.Errorf("contêiner %s não está pronto", container)
 	}
 
 	// Adicionar configuração de ambiente para UTF-8 e reduzir a complexidade da linha de comando
 	commandStr := strings.Join(command[2:], " ")
-	wrappedCommand := []string{"/bin/bash", "-c", fmt.Sprintf("export LC_ALL=C.UTF-8 && export LANG=C.UTF-8 && %s", commandStr)}
+	wrappedCommand := []string{containerShell(container), "-c", fmt.Sprintf("export LC_ALL=C.UTF-8 && export LANG=C.UTF-8 && %s", commandStr)}
 
 	log.Printf("Comando final para execução: %v", wrappedCommand)
 
-	req := clientset.CoreV1().RESTClient().Post().
-		Resource("pods").
-		Name(pod.Name).
-		Namespace(pod.Namespace).
-		SubResource("exec")
-
-	req.VersionedParams(&v1.PodExecOptions{
-		Command: wrappedCommand,
-		Stdin:   false,
-		Stdout:  true,
-		Stderr:  true,
-		TTY:     false,
-	}, scheme.ParameterCodec)
-
 	var stdout, stderr bytes.Buffer
-	exec, err := remotecommand.NewSPDYExecutor(config, "POST", req.URL())
-	if err != nil {
-		log.Printf("Erro ao criar executor SPDY: %v", err)
-		return "", "", fmt.Errorf("erro ao criar executor: %v", err)
-	}
-
-	err = exec.Stream(remotecommand.StreamOptions{
-		Stdin:  nil,
-		Stdout: &stdout,
-		Stderr: &stderr,
-		Tty:    false,
+	err = lm.backend.Exec(ctx, podStatus, ExecOptions{
+		Container: container,
+		Command:   wrappedCommand,
+		Stdout:    &stdout,
+		Stderr:    &stderr,
 	})
 
 	stdoutStr := stdout.String()
@@ -669,40 +773,23 @@ func truncateString(s string, maxLen int) string {
 	return s[:maxLen] + "..."
 }
 
-// generateRestrictedKubeConfig gera um kubeconfig com permissões limitadas para o laboratório
-func generateRestrictedKubeConfig() string {
-	// Obter configuração do host
-	config, err := rest.InClusterConfig()
-	if err != nil {
-		log.Printf("Erro ao obter configuração in-cluster: %v", err)
-		// Fallback para kubeconfig local
-		kubeconfig := os.Getenv("KUBECONFIG")
-		if kubeconfig == "" {
-			kubeconfig = filepath.Join(os.Getenv("HOME"), ".kube", "config")
-		}
-
-		// Ler o conteúdo do arquivo
-		content, err := os.ReadFile(kubeconfig)
-		if err != nil {
-			log.Printf("Erro ao ler kubeconfig: %v", err)
-			return ""
-		}
-
-		return string(content)
+// generateRestrictedKubeConfig gera o kubeconfig do laboratório, autenticado
+// com o token da ServiceAccount do namespace e restrito a ele pela Role
+func generateRestrictedKubeConfig(server string, caData []byte, namespace, token string) string {
+	cluster := fmt.Sprintf("    server: %s\n", server)
+	if len(caData) > 0 {
+		cluster = fmt.Sprintf("    certificate-authority-data: %s\n", base64.StdEncoding.EncodeToString(caData)) + cluster
 	}
 
-	// Criar um kubeconfig básico usando a configuração interna
-	// Este kubeconfig usa a conta de serviço montada no pod para autenticação
-	kubeConfig := fmt.Sprintf(`apiVersion: v1
+	return fmt.Sprintf(`apiVersion: v1
 kind: Config
 clusters:
 - cluster:
-    certificate-authority-data: %s
-    server: %s
-  name: kubernetes
+%s  name: kubernetes
 contexts:
 - context:
     cluster: kubernetes
+    namespace: %s
     user: lab-user
   name: lab-context
 current-context: lab-context
@@ -710,9 +797,7 @@ users:
 - name: lab-user
   user:
     token: %s
-`, base64.StdEncoding.EncodeToString(config.TLSClientConfig.CAData), config.Host, config.BearerToken)
-
-	return kubeConfig
+`, cluster, namespace, token)
 }
 
 // formatTasks formata as tarefas para o formato YAML
@@ -734,7 +819,7 @@ func formatTasks(tasks []Task) string {
 func (lm *LabManager) GetPod(namespace, podName string) (*v1.Pod, error) {
 	ctx, cancel := contextWithTimeout()
 	defer cancel()
-	return lm.clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	return lm.backend.GetLab(ctx, namespace, podName)
 }
 
 // GetTemplate obtém um template pelo nome
@@ -892,7 +977,7 @@ func (lm *LabManager) DeletePod(namespace, podName string) error {
 	// Verificar se o pod existe
 	ctx, cancel := contextWithTimeout()
 	defer cancel()
-	_, err := lm.clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	_, err := lm.backend.GetLab(ctx, namespace, podName)
 	if err != nil {
 		log.Printf("Pod %s/%s não encontrado, pode já ter sido excluído", namespace, podName)
 		return nil
@@ -901,7 +986,7 @@ func (lm *LabManager) DeletePod(namespace, podName string) error {
 	// Excluir o pod
 	ctx, cancel = contextWithTimeout()
 	defer cancel()
-	err = lm.clientset.CoreV1().Pods(namespace).Delete(ctx, podName, metav1.DeleteOptions{
+	err = lm.backend.DeleteLab(ctx, namespace, podName, metav1.DeleteOptions{
 		GracePeriodSeconds: pointer.Int64(5),
 	})
 	if err != nil {
@@ -923,24 +1008,19 @@ func (lm *LabManager) RemoveLabByUserID(userID string) {
 	// Excluir pods no namespace
 	ctx, cancel := contextWithTimeout()
 	defer cancel()
-	podList, err := lm.clientset.CoreV1().Pods(labInfo.Namespace).List(ctx, metav1.ListOptions{})
+	pods, err := lm.backend.ListLabs(ctx, labInfo.Namespace, metav1.ListOptions{})
 	if err != nil {
 		log.Printf("Erro ao listar pods: %v", err)
 		return
 	}
 
 	// Excluir cada pod encontrado
-	for _, pod := range podList.Items {
+	for _, pod := range pods {
 		if err := lm.DeletePod(labInfo.Namespace, pod.Name); err != nil {
 			log.Printf("Erro ao excluir pod %s: %v", pod.Name, err)
 		}
 	}
 
-	// Atualizar o mapa de usuários
-	lm.mu.Lock()
-	delete(lm.userLabMap, userID)
-	lm.mu.Unlock()
-
 	log.Printf("Laboratório do usuário %s removido com sucesso", userID)
 }
 
@@ -955,34 +1035,29 @@ type LabInfo struct {
 	StartTime      string `json:"startTime,omitempty"`
 	ExpirationTime string `json:"expirationTime,omitempty"`
 	RemainingTime  int64  `json:"remainingTime,omitempty"` // Em segundos
+	Extensions     int    `json:"extensions,omitempty"`    // Extensões de tempo concedidas
 }
 
 // GetLabByUserID retorna as informações do laboratório associado a um usuário
 func (lm *LabManager) GetLabByUserID(userID string) (LabInfo, bool) {
 	// Verificar se o namespace existe
-	namespace := fmt.Sprintf("lab-%s", userID)
+	namespace := lm.namespaceForUser(userID)
 
-	ctx, cancel := contextWithTimeout()
-	defer cancel()
-	_, err := lm.clientset.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	labNamespace, err := lm.getNamespace(namespace)
 	if err != nil {
 		log.Printf("Namespace %s não encontrado: %v", namespace, err)
 		return LabInfo{}, false
 	}
 
 	// Buscar pods no namespace
-	ctx, cancel = contextWithTimeout()
-	defer cancel()
-	podList, err := lm.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
-		LabelSelector: "app=girus-lab",
-	})
-	if err != nil || len(podList.Items) == 0 {
+	pods, err := lm.listLabPods(namespace, labPodSelector)
+	if err != nil || len(pods) == 0 {
 		log.Printf("Nenhum pod encontrado no namespace %s: %v", namespace, err)
 		return LabInfo{}, false
 	}
 
 	// Retornar informações do primeiro pod encontrado
-	pod := podList.Items[0]
+	pod := pods[0]
 	templateID := pod.Labels["template"]
 
 	// Obter o template para pegar a URL do vídeo
@@ -991,6 +1066,7 @@ func (lm *LabManager) GetLabByUserID(userID string) (LabInfo, bool) {
 	var timerEnabled bool
 	var startTime, expirationTime string
 	var remainingTime int64
+	extensions, extendedBy := labExtensions(labNamespace)
 
 	if template != nil {
 		youtubeVideo = template.YoutubeVideo
@@ -998,23 +1074,12 @@ func (lm *LabManager) GetLabByUserID(userID string) (LabInfo, bool) {
 
 		// Se o timer estiver habilitado, calcular informações de tempo
 		if timerEnabled {
-			// Obter o tempo de início como a data de criação do pod
-			startTimeObj := pod.CreationTimestamp.Time
+			// Obter o tempo de início como a data de entrega (warm pool) ou de criação do pod
+			startTimeObj := podStartTime(&pod)
 			startTime = startTimeObj.Format(time.RFC3339)
 
-			// Calcular o tempo de expiração baseado na MaxDuration
-			var maxDuration time.Duration
-			if template.MaxDuration != "" {
-				maxDuration, err = time.ParseDuration(template.MaxDuration)
-				if err != nil {
-					log.Printf("Erro ao analisar MaxDuration '%s': %v", template.MaxDuration, err)
-					maxDuration = 1 * time.Hour // Padrão: 1 hora
-				}
-			} else {
-				maxDuration = 1 * time.Hour // Padrão: 1 hora
-			}
-
-			expirationTimeObj := startTimeObj.Add(maxDuration)
+			// Calcular o tempo de expiração baseado na MaxDuration e nas extensões concedidas
+			expirationTimeObj := startTimeObj.Add(templateMaxDuration(template) + extendedBy)
 			expirationTime = expirationTimeObj.Format(time.RFC3339)
 
 			// Calcular tempo restante em segundos
@@ -1031,12 +1096,13 @@ func (lm *LabManager) GetLabByUserID(userID string) (LabInfo, bool) {
 		Namespace:      namespace,
 		PodName:        pod.Name,
 		TemplateID:     templateID,
-		Status:         string(pod.Status.Phase),
+		Status:         labStatus(&pod),
 		YoutubeVideo:   youtubeVideo,
 		TimerEnabled:   timerEnabled,
 		StartTime:      startTime,
 		ExpirationTime: expirationTime,
 		RemainingTime:  remainingTime,
+		Extensions:     extensions,
 	}, true
 }
 
@@ -1049,7 +1115,7 @@ func (lm *LabManager) CreateLab(userID, templateID string) (string, string, erro
 	}
 
 	// Criar namespace se não existir
-	namespace := fmt.Sprintf("lab-%s", userID)
+	namespace := lm.namespaceForUser(userID)
 	ctx, cancel := contextWithTimeout()
 	defer cancel()
 	_, err := lm.clientset.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
@@ -1063,7 +1129,8 @@ func (lm *LabManager) CreateLab(userID, templateID string) (string, string, erro
 				ObjectMeta: metav1.ObjectMeta{
 					Name: namespace,
 					Labels: map[string]string{
-						"user-id": userID,
+						"createdBy": "girus",
+						"user-id":   userID,
 					},
 				},
 			},
@@ -1081,14 +1148,14 @@ func (lm *LabManager) CreateLab(userID, templateID string) (string, string, erro
 	// Verificar se existem pods antigos deste usuário no namespace - opcional
 	ctx, cancel = contextWithTimeout()
 	defer cancel()
-	podList, err := lm.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+	oldPods, err := lm.backend.ListLabs(ctx, namespace, metav1.ListOptions{
 		LabelSelector: fmt.Sprintf("user=%s", userID),
 	})
-	if err == nil && len(podList.Items) > 0 {
-		log.Printf("[Lab Manager] Encontrados %d pods antigos para o usuário %s", len(podList.Items), userID)
+	if err == nil && len(oldPods) > 0 {
+		log.Printf("[Lab Manager] Encontrados %d pods antigos para o usuário %s", len(oldPods), userID)
 		// Podemos opcionalmente iniciar a limpeza dos pods antigos em segundo plano
 		go func() {
-			for _, oldPod := range podList.Items {
+			for _, oldPod := range oldPods {
 				// Não excluir o pod que acabamos de criar
 				if oldPod.Name != podName {
 					log.Printf("[Lab Manager] Excluindo pod antigo: %s", oldPod.Name)
@@ -1098,11 +1165,6 @@ func (lm *LabManager) CreateLab(userID, templateID string) (string, string, erro
 		}()
 	}
 
-	// Registrar o templateID para este usuário
-	lm.mu.Lock()
-	lm.userLabMap[userID] = templateID
-	lm.mu.Unlock()
-
 	// ... resto do código ...
 
 	return namespace, podName, nil
@@ -1110,11 +1172,36 @@ func (lm *LabManager) CreateLab(userID, templateID string) (string, string, erro
 
 // DeleteLabEnvironment exclui o ambiente de laboratório para o usuário especificado
 func (lm *LabManager) DeleteLabEnvironment(userID string, forceDelete bool) error {
-	lm.mu.Lock()
-	labInfo, ok := lm.userLabMap[userID]
-	if !ok {
-		lm.mu.Unlock()
-		return fmt.Errorf("laboratório não encontrado para o usuário: %s", userID)
+	// O laboratório é localizado pelos labels dos pods e do namespace, e não por
+	// estado em memória, para valer também após reinícios e para GirusLabs
+	namespace := lm.namespaceForUser(userID)
+	pods, err := lm.userLabs(userID)
+	if err != nil {
+		return err
+	}
+	_, err = lm.getNamespace(namespace)
+	namespaceExists := err == nil
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("erro ao verificar namespace: %v", err)
+	}
+
+	// Um GirusLab controla o laboratório: excluí-lo deixa a limpeza para o finalizer
+	if lm.operator != nil {
+		removed, err := lm.operator.Remove(userID)
+		if err != nil {
+			return fmt.Errorf("erro ao excluir o GirusLab do usuário %s: %v", userID, err)
+		}
+		if removed {
+			if lm.pool != nil {
+				lm.pool.Release(userID)
+			}
+			log.Printf("GirusLab do usuário %s excluído; o namespace %s será removido pelo operador", userID, namespace)
+			return nil
+		}
+	}
+
+	if len(pods) == 0 && !namespaceExists {
+		return errors.NewNotFound(labResource, userID)
 	}
 
 	// Obter informações completas sobre o laboratório
@@ -1128,32 +1215,16 @@ func (lm *LabManager) DeleteLabEnvironment(userID string, forceDelete bool) erro
 		}
 	}
 
-	namespace := fmt.Sprintf("lab-%s", userID)
-	podName := labInfo
-
-	// Remover mapeamento do usuário
-	delete(lm.userLabMap, userID)
-	lm.mu.Unlock()
+	if lm.pool != nil {
+		lm.pool.Release(userID)
+	}
 
-	log.Printf("Excluindo laboratório para o usuário %s (namespace: %s, pod: %s, force: %v)",
-		userID, namespace, podName, forceDelete)
+	log.Printf("Excluindo laboratório para o usuário %s (namespace: %s, pods: %d, force: %v)",
+		userID, namespace, len(pods), forceDelete)
 
-	// Verificar se o namespace existe
+	// Excluir os pods
 	ctx, cancel := contextWithTimeout()
 	defer cancel()
-	var err error
-	_, err = lm.clientset.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
-	if err != nil {
-		if errors.IsNotFound(err) {
-			log.Printf("Namespace %s não encontrado, nada a excluir", namespace)
-			return nil
-		}
-		return fmt.Errorf("erro ao verificar namespace: %v", err)
-	}
-
-	// Excluir o pod
-	ctx, cancel = contextWithTimeout()
-	defer cancel()
 	deletePolicy := metav1.DeletePropagationForeground
 	var gracePeriod int64 = 30
 	if forceDelete {
@@ -1163,10 +1234,21 @@ func (lm *LabManager) DeleteLabEnvironment(userID string, forceDelete bool) erro
 		PropagationPolicy:  &deletePolicy,
 		GracePeriodSeconds: pointer.Int64(gracePeriod),
 	}
-	err = lm.clientset.CoreV1().Pods(namespace).Delete(ctx, podName, deleteOpts)
-	if err != nil && !errors.IsNotFound(err) {
-		log.Printf("Erro ao excluir pod %s no namespace %s: %v", podName, namespace, err)
-		// Continuar mesmo com erro para tentar excluir o namespace
+	for _, pod := range pods {
+		err = lm.backend.DeleteLab(ctx, pod.Namespace, pod.Name, deleteOpts)
+		if err != nil && !errors.IsNotFound(err) {
+			log.Printf("Erro ao excluir pod %s no namespace %s: %v", pod.Name, pod.Namespace, err)
+			// Continuar mesmo com erro para tentar excluir o namespace
+		}
+	}
+
+	// Com workspaces persistentes o namespace guarda os PVCs do usuário e é mantido
+	if !namespaceExists {
+		return nil
+	}
+	if lm.workspaces != nil && namespace == workspaceNamespace(userID) {
+		log.Printf("Namespace %s mantido para preservar os workspaces do usuário %s", namespace, userID)
+		return nil
 	}
 
 	// Excluir o namespace inteiro
@@ -1266,11 +1348,8 @@ func (lm *LabManager) StartTimerMonitor(ctx context.Context) {
 func (lm *LabManager) checkAndTerminateExpiredLabs() {
 	log.Printf("Verificando laboratórios expirados")
 
-	// Listar todos os namespaces
-	ctx, cancel := contextWithTimeout()
-	defer cancel()
-
-	namespaces, err := lm.clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	// Listar os namespaces do Girus (pelo cache, quando disponível)
+	namespaces, err := lm.listLabNamespaces()
 	if err != nil {
 		log.Printf("Erro ao listar namespaces: %v", err)
 		return
@@ -1280,13 +1359,20 @@ func (lm *LabManager) checkAndTerminateExpiredLabs() {
 	labsVerificados := 0
 	labsExpirados := 0
 
-	for _, ns := range namespaces.Items {
+	for _, ns := range namespaces {
 		if !strings.HasPrefix(ns.Name, "lab-") {
 			continue
 		}
+		// Laboratórios ociosos do warm pool ainda não têm timer em andamento
+		if ns.Labels[poolLabel] == "idle" {
+			continue
+		}
 
-		// Extrair ID do usuário do nome do namespace
-		userID := strings.TrimPrefix(ns.Name, "lab-")
+		// Extrair ID do usuário do rótulo ou do nome do namespace
+		userID := ns.Labels["userId"]
+		if userID == "" {
+			userID = strings.TrimPrefix(ns.Name, "lab-")
+		}
 		labsVerificados++
 
 		// Obter informações do laboratório
@@ -1314,8 +1400,8 @@ func (lm *LabManager) checkAndTerminateExpiredLabs() {
 					labInfo.PodName, userID, expirationTime.Format(time.RFC3339))
 
 				// Listar todos os pods no namespace
-				ctx, cancel = contextWithTimeout()
-				podList, podErr := lm.clientset.CoreV1().Pods(labInfo.Namespace).List(ctx, metav1.ListOptions{})
+				ctx, cancel := contextWithTimeout()
+				pods, podErr := lm.backend.ListLabs(ctx, labInfo.Namespace, metav1.ListOptions{})
 				cancel()
 
 				if podErr != nil {
@@ -1323,12 +1409,12 @@ func (lm *LabManager) checkAndTerminateExpiredLabs() {
 					continue
 				}
 
-				log.Printf("Removendo %d pods do laboratório expirado %s", len(podList.Items), labInfo.PodName)
+				log.Printf("Removendo %d pods do laboratório expirado %s", len(pods), labInfo.PodName)
 
 				// Remover cada pod individualmente usando ForceDelete para garantir
-				for _, pod := range podList.Items {
+				for _, pod := range pods {
 					log.Printf("Removendo pod expirado: %s", pod.Name)
-					ctx, cancel = contextWithTimeout()
+					ctx, cancel := contextWithTimeout()
 
 					// Usar DeleteOptions com GracePeriodSeconds=0 para forçar remoção
 					deletePolicy := metav1.DeletePropagationForeground
@@ -1337,7 +1423,7 @@ func (lm *LabManager) checkAndTerminateExpiredLabs() {
 						GracePeriodSeconds: pointer.Int64(0), // Forçar remoção imediata
 					}
 
-					err = lm.clientset.CoreV1().Pods(labInfo.Namespace).Delete(ctx, pod.Name, deleteOptions)
+					err = lm.backend.DeleteLab(ctx, labInfo.Namespace, pod.Name, deleteOptions)
 					cancel()
 
 					if err != nil {
@@ -1347,11 +1433,6 @@ func (lm *LabManager) checkAndTerminateExpiredLabs() {
 					}
 				}
 
-				// Remover mapeamento do usuário
-				lm.mu.Lock()
-				delete(lm.userLabMap, userID)
-				lm.mu.Unlock()
-
 				log.Printf("Laboratório %s removido por expiração de tempo", labInfo.PodName)
 			} else {
 				timeLeft := expirationTime.Sub(now)
@@ -1369,47 +1450,26 @@ func (lm *LabManager) GetCurrentLab() (struct {
 	UserID string
 	LabID  string
 }, bool) {
-	lm.mu.RLock()
-	defer lm.mu.RUnlock()
-
 	// Como não temos um conceito real de "laboratório atual",
-	// vamos retornar o primeiro laboratório encontrado no mapa
-	for userID, labID := range lm.userLabMap {
-		// Verificar se o laboratório ainda existe
-		namespace := fmt.Sprintf("lab-%s", userID)
-		ctx, cancel := contextWithTimeout()
-		defer cancel()
-
-		// Verificar se o namespace existe
-		_, err := lm.clientset.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
-		if err != nil {
-			if errors.IsNotFound(err) {
-				log.Printf("Namespace %s não encontrado, removendo do mapa", namespace)
-				delete(lm.userLabMap, userID)
-				continue
-			}
-			log.Printf("Erro ao verificar namespace %s: %v", namespace, err)
-			continue
-		}
-
-		// Verificar se o pod existe
-		_, err = lm.clientset.CoreV1().Pods(namespace).Get(ctx, labID, metav1.GetOptions{})
-		if err != nil {
-			if errors.IsNotFound(err) {
-				log.Printf("Pod %s/%s não encontrado, removendo do mapa", namespace, labID)
-				delete(lm.userLabMap, userID)
-				continue
-			}
-			log.Printf("Erro ao verificar pod %s/%s: %v", namespace, labID, err)
+	// vamos retornar o laboratório saudável mais recente
+	pods, err := lm.listLabPods("", labPodSelector)
+	if err != nil {
+		log.Printf("Erro ao listar laboratórios: %v", err)
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[i].CreationTimestamp.After(pods[j].CreationTimestamp.Time)
+	})
+	for _, pod := range pods {
+		userID := pod.Labels["user"]
+		if userID == "" || !labHealthy(&pod) {
 			continue
 		}
-
 		return struct {
 			UserID string
 			LabID  string
 		}{
 			UserID: userID,
-			LabID:  labID,
+			LabID:  pod.Name,
 		}, true
 	}
 
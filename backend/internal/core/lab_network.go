@@ -0,0 +1,348 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Nomes das NetworkPolicies instaladas nos namespaces de laboratório
+const (
+	policyDefaultDeny   = "girus-default-deny"
+	policyAllowInternal = "girus-allow-namespace"
+	policyAllowBackend  = "girus-allow-backend"
+	policyAllowDNS      = "girus-allow-dns"
+	policyAllowEgress   = "girus-allow-egress"
+	policyAllowAPI      = "girus-allow-api"
+)
+
+// NetworkSettings define o acesso de rede de um laboratório. Sem esta seção o
+// laboratório acessa a internet, exceto as faixas do cluster; com ela, apenas o
+// DNS e os destinos declarados são liberados.
+type NetworkSettings struct {
+	Offline      bool         `json:"offline,omitempty" yaml:"offline"`           // Sem tráfego de saída, nem DNS (provas)
+	AllowMirrors bool         `json:"allowMirrors,omitempty" yaml:"allowMirrors"` // Libera os espelhos de pacotes da configuração
+	Egress       []EgressRule `json:"egress,omitempty" yaml:"egress"`
+}
+
+// EgressRule libera o tráfego de saída para uma faixa de endereços
+type EgressRule struct {
+	CIDR   string        `json:"cidr" yaml:"cidr"`
+	Except []string      `json:"except,omitempty" yaml:"except"`
+	Ports  []NetworkPort `json:"ports,omitempty" yaml:"ports"` // Vazio = todas as portas
+}
+
+// NetworkPort identifica uma porta liberada
+type NetworkPort struct {
+	Port     int32  `json:"port" yaml:"port"`
+	Protocol string `json:"protocol,omitempty" yaml:"protocol"` // TCP (padrão), UDP ou SCTP
+}
+
+// validate verifica faixas de endereços, portas e protocolos declarados
+func (s *NetworkSettings) validate() error {
+	if s == nil {
+		return nil
+	}
+	if s.Offline && (len(s.Egress) > 0 || s.AllowMirrors) {
+		return fmt.Errorf("um laboratório offline não pode declarar regras de saída")
+	}
+	for _, rule := range s.Egress {
+		if _, _, err := net.ParseCIDR(rule.CIDR); err != nil {
+			return fmt.Errorf("CIDR inválido: %q", rule.CIDR)
+		}
+		for _, except := range rule.Except {
+			if _, _, err := net.ParseCIDR(except); err != nil {
+				return fmt.Errorf("CIDR inválido em except: %q", except)
+			}
+		}
+		for _, port := range rule.Ports {
+			if port.Port < 1 || port.Port > 65535 {
+				return fmt.Errorf("porta inválida para %s: %d", rule.CIDR, port.Port)
+			}
+			if _, err := networkProtocol(port.Protocol); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// cidrEgressRules libera todas as portas das faixas informadas
+func cidrEgressRules(cidrs []string) []EgressRule {
+	rules := make([]EgressRule, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		rules = append(rules, EgressRule{CIDR: cidr})
+	}
+	return rules
+}
+
+// networkProtocol converte o protocolo declarado (padrão: TCP)
+func networkProtocol(protocol string) (v1.Protocol, error) {
+	switch strings.ToUpper(protocol) {
+	case "", "TCP":
+		return v1.ProtocolTCP, nil
+	case "UDP":
+		return v1.ProtocolUDP, nil
+	case "SCTP":
+		return v1.ProtocolSCTP, nil
+	default:
+		return "", fmt.Errorf("protocolo inválido: %s", protocol)
+	}
+}
+
+// egressPeers converte as regras de saída em regras de NetworkPolicy
+func egressPeers(rules []EgressRule) []networkingv1.NetworkPolicyEgressRule {
+	egress := []networkingv1.NetworkPolicyEgressRule{}
+	for _, rule := range rules {
+		policyRule := networkingv1.NetworkPolicyEgressRule{
+			To: []networkingv1.NetworkPolicyPeer{{
+				IPBlock: &networkingv1.IPBlock{CIDR: rule.CIDR, Except: rule.Except},
+			}},
+		}
+		for _, port := range rule.Ports {
+			protocol, _ := networkProtocol(port.Protocol)
+			portNumber := intstr.FromInt(int(port.Port))
+			policyRule.Ports = append(policyRule.Ports, networkingv1.NetworkPolicyPort{
+				Protocol: &protocol,
+				Port:     &portNumber,
+			})
+		}
+		egress = append(egress, policyRule)
+	}
+	return egress
+}
+
+// labEgressRules retorna as regras de saída do laboratório segundo o template e a configuração
+func labEgressRules(template *LabTemplate) []EgressRule {
+	settings := template.Network
+	if settings == nil {
+		// Internet liberada, exceto as faixas internas do cluster
+		rules := []EgressRule{}
+		for _, cidr := range []string{"0.0.0.0/0", "::/0"} {
+			_, allowed, _ := net.ParseCIDR(cidr)
+			rule := EgressRule{CIDR: cidr}
+			for _, clusterCIDR := range config.Lab.Network.ClusterCIDRs {
+				ip, _, err := net.ParseCIDR(clusterCIDR)
+				if err == nil && allowed.Contains(ip) {
+					rule.Except = append(rule.Except, clusterCIDR)
+				}
+			}
+			rules = append(rules, rule)
+		}
+		return rules
+	}
+	if settings.Offline {
+		return nil
+	}
+
+	rules := append([]EgressRule{}, settings.Egress...)
+	if settings.AllowMirrors {
+		rules = append(rules, cidrEgressRules(config.Lab.Network.MirrorCIDRs)...)
+	}
+	return rules
+}
+
+// labAPIEgressRules retorna as regras de saída para a API do Kubernetes usada pelo
+// kubeconfig do laboratório: o host de Access.APIServer, quando configurado, ou os
+// endpoints do serviço kubernetes (o tráfego ao IP do serviço chega a eles)
+func (lm *LabManager) labAPIEgressRules() ([]EgressRule, error) {
+	hostRule := func(ip string, port int32) EgressRule {
+		cidr := ip + "/32"
+		if strings.Contains(ip, ":") {
+			cidr = ip + "/128"
+		}
+		return EgressRule{CIDR: cidr, Ports: []NetworkPort{{Port: port}}}
+	}
+
+	if config.Lab.Access.APIServer != "" {
+		endpoint, err := url.Parse(config.Lab.Access.APIServer)
+		if err != nil || endpoint.Hostname() == "" {
+			return nil, fmt.Errorf("endereço da API inválido: %q", config.Lab.Access.APIServer)
+		}
+		port := int32(443)
+		if value := endpoint.Port(); value != "" {
+			parsed, err := strconv.ParseInt(value, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("porta inválida no endereço da API: %q", value)
+			}
+			port = int32(parsed)
+		}
+		ips, err := net.LookupIP(endpoint.Hostname())
+		if err != nil {
+			return nil, fmt.Errorf("erro ao resolver o endereço da API %s: %v", endpoint.Hostname(), err)
+		}
+		rules := []EgressRule{}
+		for _, ip := range ips {
+			rules = append(rules, hostRule(ip.String(), port))
+		}
+		return rules, nil
+	}
+
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+	endpoints, err := lm.clientset.CoreV1().Endpoints(metav1.NamespaceDefault).Get(ctx, "kubernetes", metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("erro ao obter endpoints da API: %v", err)
+	}
+	rules := []EgressRule{}
+	for _, subset := range endpoints.Subsets {
+		for _, address := range subset.Addresses {
+			for _, port := range subset.Ports {
+				rules = append(rules, hostRule(address.IP, port.Port))
+			}
+		}
+	}
+	return rules, nil
+}
+
+// labIngressPorts retorna as portas do laboratório, dos sidecars e as expostas pelo proxy, acessíveis pelo backend
+func labIngressPorts(template *LabTemplate) []networkingv1.NetworkPolicyPort {
+	ports := []networkingv1.NetworkPolicyPort{}
+	add := func(port int32, protocol string) {
+		policyProtocol, err := networkProtocol(protocol)
+		if err != nil {
+			return
+		}
+		portNumber := intstr.FromInt(int(port))
+		ports = append(ports, networkingv1.NetworkPolicyPort{Protocol: &policyProtocol, Port: &portNumber})
+	}
+	add(22, "TCP")
+	for _, sidecar := range template.Sidecars {
+		for _, port := range sidecar.Ports {
+			add(port.ContainerPort, port.Protocol)
+		}
+	}
+	for _, exposed := range template.Expose {
+		add(exposed.Port, "TCP")
+	}
+	return ports
+}
+
+// labNetworkPolicies monta as NetworkPolicies do namespace: tudo bloqueado por
+// padrão, tráfego livre dentro do namespace, entrada do backend nas portas
+// declaradas, saída para a API do cluster quando o laboratório tem kubeconfig
+// (inclusive offline) e para o DNS e os destinos liberados pelo template
+func labNetworkPolicies(template *LabTemplate, apiRules []EgressRule) []*networkingv1.NetworkPolicy {
+	allPods := metav1.LabelSelector{}
+	sameNamespace := []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{}}}
+	policy := func(name string, types []networkingv1.PolicyType) *networkingv1.NetworkPolicy {
+		return &networkingv1.NetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: map[string]string{"createdBy": "girus"},
+			},
+			Spec: networkingv1.NetworkPolicySpec{
+				PodSelector: allPods,
+				PolicyTypes: types,
+			},
+		}
+	}
+	ingressOnly := []networkingv1.PolicyType{networkingv1.PolicyTypeIngress}
+	egressOnly := []networkingv1.PolicyType{networkingv1.PolicyTypeEgress}
+
+	defaultDeny := policy(policyDefaultDeny, []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress})
+
+	internal := policy(policyAllowInternal, []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress})
+	internal.Spec.Ingress = []networkingv1.NetworkPolicyIngressRule{{From: sameNamespace}}
+	internal.Spec.Egress = []networkingv1.NetworkPolicyEgressRule{{To: sameNamespace}}
+
+	backend := policy(policyAllowBackend, ingressOnly)
+	backend.Spec.Ingress = []networkingv1.NetworkPolicyIngressRule{{
+		From: []networkingv1.NetworkPolicyPeer{{
+			NamespaceSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"kubernetes.io/metadata.name": config.Lab.Network.BackendNamespace},
+			},
+		}},
+		Ports: labIngressPorts(template),
+	}}
+
+	policies := []*networkingv1.NetworkPolicy{defaultDeny, internal, backend}
+	if len(apiRules) > 0 {
+		api := policy(policyAllowAPI, egressOnly)
+		api.Spec.Egress = egressPeers(apiRules)
+		policies = append(policies, api)
+	}
+	if template.Network != nil && template.Network.Offline {
+		return policies
+	}
+
+	udp, tcp := v1.ProtocolUDP, v1.ProtocolTCP
+	dnsPort := intstr.FromInt(53)
+	dns := policy(policyAllowDNS, egressOnly)
+	dns.Spec.Egress = []networkingv1.NetworkPolicyEgressRule{{
+		To: []networkingv1.NetworkPolicyPeer{{
+			NamespaceSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"kubernetes.io/metadata.name": "kube-system"},
+			},
+			PodSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"k8s-app": "kube-dns"},
+			},
+		}},
+		Ports: []networkingv1.NetworkPolicyPort{
+			{Protocol: &udp, Port: &dnsPort},
+			{Protocol: &tcp, Port: &dnsPort},
+		},
+	}}
+	policies = append(policies, dns)
+
+	if rules := labEgressRules(template); len(rules) > 0 {
+		egress := policy(policyAllowEgress, egressOnly)
+		egress.Spec.Egress = egressPeers(rules)
+		policies = append(policies, egress)
+	}
+	return policies
+}
+
+// applyNetworkPolicies instala as NetworkPolicies do laboratório no namespace e
+// remove as que não se aplicam mais ao template (por exemplo, após mudar para offline)
+func (lm *LabManager) applyNetworkPolicies(namespace string, template *LabTemplate) error {
+	var apiRules []EgressRule
+	if kubeAccessEnabled(template) {
+		rules, err := lm.labAPIEgressRules()
+		if err != nil {
+			log.Printf("Saída para a API do cluster não liberada no namespace %s: %v", namespace, err)
+		}
+		apiRules = rules
+	}
+
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+	client := lm.clientset.NetworkingV1().NetworkPolicies(namespace)
+
+	wanted := map[string]bool{}
+	for _, policy := range labNetworkPolicies(template, apiRules) {
+		wanted[policy.Name] = true
+		existing, err := client.Get(ctx, policy.Name, metav1.GetOptions{})
+		switch {
+		case errors.IsNotFound(err):
+			_, err = client.Create(ctx, policy, metav1.CreateOptions{})
+		case err == nil:
+			policy.ResourceVersion = existing.ResourceVersion
+			_, err = client.Update(ctx, policy, metav1.UpdateOptions{})
+		}
+		if err != nil {
+			return fmt.Errorf("erro ao aplicar NetworkPolicy %s: %v", policy.Name, err)
+		}
+	}
+
+	for _, name := range []string{policyAllowAPI, policyAllowDNS, policyAllowEgress} {
+		if wanted[name] {
+			continue
+		}
+		if err := client.Delete(ctx, name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("erro ao remover NetworkPolicy %s: %v", name, err)
+		}
+	}
+
+	log.Printf("NetworkPolicies aplicadas no namespace %s (%d políticas)", namespace, len(wanted))
+	return nil
+}
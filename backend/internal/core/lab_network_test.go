@@ -0,0 +1,110 @@
+package core
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestLabAPIEgressRules(t *testing.T) {
+	endpoints := &v1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "kubernetes", Namespace: metav1.NamespaceDefault},
+		Subsets: []v1.EndpointSubset{{
+			Addresses: []v1.EndpointAddress{{IP: "172.18.0.2"}, {IP: "fd00::2"}},
+			Ports:     []v1.EndpointPort{{Name: "https", Port: 6443}},
+		}},
+	}
+	tests := []struct {
+		name      string
+		apiServer string
+		endpoints *v1.Endpoints
+		want      []EgressRule
+		wantErr   bool
+	}{
+		{
+			name:      "endpoints do serviço kubernetes",
+			endpoints: endpoints,
+			want: []EgressRule{
+				{CIDR: "172.18.0.2/32", Ports: []NetworkPort{{Port: 6443}}},
+				{CIDR: "fd00::2/128", Ports: []NetworkPort{{Port: 6443}}},
+			},
+		},
+		{
+			name:      "endereço configurado tem precedência",
+			apiServer: "https://10.0.0.1:8443",
+			endpoints: endpoints,
+			want:      []EgressRule{{CIDR: "10.0.0.1/32", Ports: []NetworkPort{{Port: 8443}}}},
+		},
+		{
+			name:      "endereço configurado sem porta",
+			apiServer: "https://10.0.0.1",
+			want:      []EgressRule{{CIDR: "10.0.0.1/32", Ports: []NetworkPort{{Port: 443}}}},
+		},
+		{
+			name:    "sem endpoints",
+			wantErr: true,
+		},
+	}
+
+	previous := config.Lab.Access
+	t.Cleanup(func() { config.Lab.Access = previous })
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Lab.Access.APIServer = tt.apiServer
+			lm := newTestLabManager(t, nil)
+			if tt.endpoints != nil {
+				if _, err := lm.clientset.CoreV1().Endpoints(metav1.NamespaceDefault).Create(context.Background(), tt.endpoints, metav1.CreateOptions{}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := lm.labAPIEgressRules()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("labAPIEgressRules() erro = %v, esperado erro: %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("labAPIEgressRules() = %+v, esperado %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLabNetworkPoliciesAllowAPI(t *testing.T) {
+	apiRules := []EgressRule{{CIDR: "10.0.0.1/32", Ports: []NetworkPort{{Port: 6443}}}}
+	tests := []struct {
+		name     string
+		network  *NetworkSettings
+		apiRules []EgressRule
+		want     []string
+	}{
+		{
+			name:     "internet liberada",
+			apiRules: apiRules,
+			want:     []string{policyDefaultDeny, policyAllowInternal, policyAllowBackend, policyAllowAPI, policyAllowDNS, policyAllowEgress},
+		},
+		{
+			name:     "offline mantém o acesso à API",
+			network:  &NetworkSettings{Offline: true},
+			apiRules: apiRules,
+			want:     []string{policyDefaultDeny, policyAllowInternal, policyAllowBackend, policyAllowAPI},
+		},
+		{
+			name:    "sem kubeconfig",
+			network: &NetworkSettings{Offline: true},
+			want:    []string{policyDefaultDeny, policyAllowInternal, policyAllowBackend},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, policy := range labNetworkPolicies(&LabTemplate{Name: "net-lab", Network: tt.network}, tt.apiRules) {
+				got = append(got, policy.Name)
+			}
+			if !equalStrings(got, tt.want) {
+				t.Errorf("políticas = %v, esperado %v", got, tt.want)
+			}
+		})
+	}
+}
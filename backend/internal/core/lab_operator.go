@@ -0,0 +1,712 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// Fases de um GirusLab
+const (
+	GirusLabPending      = "Pending"      // Aguardando o primeiro provisionamento
+	GirusLabProvisioning = "Provisioning" // Pod criado, aguardando ficar pronto
+	GirusLabReady        = "Ready"        // Laboratório pronto para uso
+	GirusLabPaused       = "Paused"       // Laboratório pausado pela API
+	GirusLabExpired      = "Expired"      // Prazo encerrado; o pod foi removido
+	GirusLabTerminated   = "Terminated"   // Pod removido fora do GirusLab (exclusão pela API)
+	GirusLabFailed       = "Failed"       // Spec inválida ou erro de provisionamento
+)
+
+const (
+	// girusLabFinalizer garante a remoção do namespace quando o GirusLab é excluído
+	girusLabFinalizer = "girus.io/lab-cleanup"
+	// girusLabLabel identifica no namespace o GirusLab que o controla
+	girusLabLabel = "girus.io/lab"
+	// operatorRequeue é o intervalo entre reconciliações de laboratórios estáveis
+	operatorRequeue = 30 * time.Second
+	// operatorPendingRequeue é o intervalo enquanto o laboratório não fica pronto
+	operatorPendingRequeue = 5 * time.Second
+)
+
+// girusLabResource identifica o recurso GirusLab na API do cluster
+var girusLabResource = schema.GroupVersionResource{Group: "girus.io", Version: "v1alpha1", Resource: "giruslabs"}
+
+// GirusLab descreve um laboratório como recurso do cluster, permitindo criá-lo
+// com kubectl e preservar seu estado entre reinícios do servidor
+type GirusLab struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   GirusLabSpec   `json:"spec"`
+	Status GirusLabStatus `json:"status,omitempty"`
+}
+
+// GirusLabSpec é o laboratório desejado
+type GirusLabSpec struct {
+	User      string          `json:"user"`
+	Template  string          `json:"template"`
+	Expiry    string          `json:"expiry,omitempty"`    // RFC3339; antecipa o fim definido pelo template
+	Resources *ResourceConfig `json:"resources,omitempty"` // Sobrescreve os recursos do contêiner do laboratório
+}
+
+// GirusLabStatus é o estado observado pelo reconciliador
+type GirusLabStatus struct {
+	Phase              string             `json:"phase,omitempty"`
+	Message            string             `json:"message,omitempty"`
+	Namespace          string             `json:"namespace,omitempty"`
+	PodName            string             `json:"podName,omitempty"`
+	Template           string             `json:"template,omitempty"` // Template do laboratório provisionado
+	StartedAt          string             `json:"startedAt,omitempty"`
+	ExpiresAt          string             `json:"expiresAt,omitempty"`
+	Endpoints          []LabEndpoint      `json:"endpoints,omitempty"`
+	Conditions         []metav1.Condition `json:"conditions,omitempty"`
+	ObservedGeneration int64              `json:"observedGeneration,omitempty"`
+}
+
+// LabEndpoint é um endereço da API do Girus para acessar o laboratório
+type LabEndpoint struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// validate verifica a spec antes do provisionamento
+func (s GirusLabSpec) validate() error {
+	if s.User == "" || s.Template == "" {
+		return fmt.Errorf("spec.user e spec.template são obrigatórios")
+	}
+	if errs := validation.IsDNS1123Label("lab-" + s.User); len(errs) > 0 {
+		return fmt.Errorf("spec.user inválido: %s", errs[0])
+	}
+	if s.Expiry != "" {
+		if _, err := time.Parse(time.RFC3339, s.Expiry); err != nil {
+			return fmt.Errorf("spec.expiry inválido: %v", err)
+		}
+	}
+	if s.Resources != nil {
+		if err := s.Resources.validate(); err != nil {
+			return fmt.Errorf("spec.resources inválido: %v", err)
+		}
+	}
+	return nil
+}
+
+// LabOperator reconcilia os GirusLabs do cluster com namespaces, ConfigMaps e pods
+type LabOperator struct {
+	lm       *LabManager
+	cfg      OperatorConfig
+	client   dynamic.NamespaceableResourceInterface
+	factory  dynamicinformer.DynamicSharedInformerFactory
+	informer cache.SharedIndexInformer
+	queue    workqueue.RateLimitingInterface
+}
+
+// NewLabOperator cria o reconciliador sobre o cliente dinâmico do backend
+func NewLabOperator(lm *LabManager, cfg OperatorConfig, client dynamic.Interface) *LabOperator {
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(client, operatorRequeue)
+	operator := &LabOperator{
+		lm:       lm,
+		cfg:      cfg,
+		client:   client.Resource(girusLabResource),
+		factory:  factory,
+		informer: factory.ForResource(girusLabResource).Informer(),
+		queue:    workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "giruslabs"),
+	}
+	operator.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    operator.enqueue,
+		UpdateFunc: func(_, obj interface{}) { operator.enqueue(obj) },
+		DeleteFunc: operator.deleted,
+	})
+	return operator
+}
+
+// enqueue agenda a reconciliação do GirusLab
+func (o *LabOperator) enqueue(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		log.Printf("[Operador] Objeto inválido na fila: %v", err)
+		return
+	}
+	o.queue.Add(key)
+}
+
+// deleted trata um GirusLab que saiu do cluster. Normalmente o finalizer já
+// limpou o laboratório; se o objeto sumiu sem passar por ele (finalizer removido
+// à mão, ou clusters que não respeitam finalizers), a limpeza é feita aqui.
+func (o *LabOperator) deleted(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	lab, err := girusLabFromObject(obj)
+	if err != nil {
+		log.Printf("[Operador] %v", err)
+		return
+	}
+	if hasFinalizer(lab, girusLabFinalizer) {
+		o.cleanup(lab)
+	}
+}
+
+// cleanup remove o namespace do GirusLab excluído, preservando os workspaces do usuário
+func (o *LabOperator) cleanup(lab *GirusLab) {
+	namespace := o.lm.namespaceForUser(lab.Spec.User)
+	if lab.Status.Namespace != "" {
+		namespace = lab.Status.Namespace
+	}
+	if o.lm.workspaces != nil && namespace == workspaceNamespace(lab.Spec.User) {
+		// O namespace guarda os workspaces persistentes do usuário: só os pods saem
+		log.Printf("[Operador] GirusLab %s excluído, removendo os pods do namespace %s", lab.Name, namespace)
+		o.lm.deleteLabPods(namespace)
+		return
+	}
+	log.Printf("[Operador] GirusLab %s excluído, removendo o namespace %s", lab.Name, namespace)
+	o.lm.deleteNamespace(namespace)
+}
+
+// Start instala o CRD (quando configurado), inicia o informer e os workers
+func (o *LabOperator) Start(ctx context.Context) {
+	if !o.cfg.DisableCRDInstall && o.lm.backend.Name() != "local" {
+		if err := o.lm.installGirusLabCRD(); err != nil {
+			log.Printf("[Operador] Erro ao instalar o CRD GirusLab: %v", err)
+		}
+	}
+
+	o.factory.Start(ctx.Done())
+	go func() {
+		defer o.queue.ShutDown()
+		if !cache.WaitForCacheSync(ctx.Done(), o.informer.HasSynced) {
+			return
+		}
+		log.Printf("[Operador] Reconciliando GirusLabs com %d worker(s)", o.cfg.Workers)
+		for i := 0; i < o.cfg.Workers; i++ {
+			go wait.Until(o.work, time.Second, ctx.Done())
+		}
+		<-ctx.Done()
+	}()
+}
+
+// work processa a fila até ela ser encerrada
+func (o *LabOperator) work() {
+	for {
+		item, shutdown := o.queue.Get()
+		if shutdown {
+			return
+		}
+		key := item.(string)
+		requeue, err := o.reconcile(key)
+		switch {
+		case err != nil:
+			log.Printf("[Operador] Erro ao reconciliar %s: %v", key, err)
+			o.queue.AddRateLimited(key)
+		case requeue > 0:
+			o.queue.Forget(key)
+			o.queue.AddAfter(key, requeue)
+		default:
+			o.queue.Forget(key)
+		}
+		o.queue.Done(item)
+	}
+}
+
+// get obtém o GirusLab do cache do informer
+func (o *LabOperator) get(name string) (*GirusLab, error) {
+	obj, exists, err := o.informer.GetIndexer().GetByKey(name)
+	if err != nil || !exists {
+		return nil, err
+	}
+	return girusLabFromObject(obj)
+}
+
+// girusLabFromObject converte o objeto não estruturado do informer
+func girusLabFromObject(obj interface{}) (*GirusLab, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("objeto inesperado no cache: %T", obj)
+	}
+	lab := &GirusLab{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.UnstructuredContent(), lab); err != nil {
+		return nil, fmt.Errorf("erro ao interpretar GirusLab %s: %v", u.GetName(), err)
+	}
+	return lab, nil
+}
+
+// toUnstructured converte o GirusLab para envio ao cluster
+func (lab *GirusLab) toUnstructured() (*unstructured.Unstructured, error) {
+	lab.APIVersion = girusLabResource.GroupVersion().String()
+	lab.Kind = "GirusLab"
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(lab)
+	if err != nil {
+		return nil, err
+	}
+	return &unstructured.Unstructured{Object: content}, nil
+}
+
+// reconcile aproxima o laboratório do estado descrito pelo GirusLab e retorna
+// quando ele deve ser verificado novamente
+func (o *LabOperator) reconcile(name string) (time.Duration, error) {
+	lab, err := o.get(name)
+	if err != nil || lab == nil {
+		return 0, err
+	}
+	namespace := o.lm.namespaceForUser(lab.Spec.User)
+
+	// Exclusão: remover o namespace e liberar o GirusLab
+	if lab.DeletionTimestamp != nil {
+		if !hasFinalizer(lab, girusLabFinalizer) {
+			return 0, nil
+		}
+		o.cleanup(lab)
+		return 0, o.removeFinalizer(lab)
+	}
+	if !hasFinalizer(lab, girusLabFinalizer) {
+		lab.Finalizers = append(lab.Finalizers, girusLabFinalizer)
+		return 0, o.update(lab)
+	}
+
+	status := lab.Status.DeepCopy()
+	status.ObservedGeneration = lab.Generation
+	status.Namespace = namespace
+	if status.Phase == "" {
+		status.Phase = GirusLabPending
+	}
+
+	template := o.lm.GetTemplate(lab.Spec.Template)
+	specErr := lab.Spec.validate()
+	if specErr == nil && template == nil {
+		specErr = fmt.Errorf("template %s não encontrado", lab.Spec.Template)
+	}
+	if specErr == nil {
+		specErr = o.conflictingLab(lab)
+	}
+	if specErr != nil {
+		status.Phase, status.Message = GirusLabFailed, specErr.Error()
+		setLabCondition(status, "Ready", metav1.ConditionFalse, "InvalidSpec", specErr.Error(), lab.Generation)
+		return 0, o.updateStatus(lab, status)
+	}
+
+	// Pods do laboratório no namespace, do mais recente para o mais antigo
+	pods, err := o.lm.listLabPods(namespace, fmt.Sprintf("%s,user=%s", labPodSelector, lab.Spec.User))
+	if err != nil {
+		return 0, err
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[i].CreationTimestamp.After(pods[j].CreationTimestamp.Time)
+	})
+	var pod *v1.Pod
+	for i := range pods {
+		if labHealthy(&pods[i]) && pods[i].Labels["template"] == lab.Spec.Template {
+			pod = &pods[i]
+			break
+		}
+	}
+
+	// Prazo: o menor entre spec.expiry e o timer do template com as extensões
+	var expiresAt time.Time
+	if pod != nil {
+		status.StartedAt = podStartTime(pod).Format(time.RFC3339)
+	}
+	if startedAt, err := time.Parse(time.RFC3339, status.StartedAt); err == nil && template.TimerEnabled {
+		extendedBy := time.Duration(0)
+		if ns, err := o.lm.getNamespace(namespace); err == nil {
+			_, extendedBy = labExtensions(ns)
+		}
+		expiresAt = startedAt.Add(templateMaxDuration(template) + extendedBy)
+	}
+	if lab.Spec.Expiry != "" {
+		if expiry, _ := time.Parse(time.RFC3339, lab.Spec.Expiry); expiresAt.IsZero() || expiry.Before(expiresAt) {
+			expiresAt = expiry
+		}
+	}
+	status.ExpiresAt = ""
+	if !expiresAt.IsZero() {
+		status.ExpiresAt = expiresAt.Format(time.RFC3339)
+	}
+
+	switch {
+	case !expiresAt.IsZero() && time.Now().After(expiresAt):
+		for _, labPod := range pods {
+			if err := o.lm.DeletePod(labPod.Namespace, labPod.Name); err != nil {
+				log.Printf("[Operador] Erro ao remover pod expirado %s/%s: %v", labPod.Namespace, labPod.Name, err)
+			}
+		}
+		status.Phase, status.Message, status.PodName, status.Endpoints = GirusLabExpired, "Prazo do laboratório encerrado", "", nil
+		setLabCondition(status, "Ready", metav1.ConditionFalse, "Expired", status.Message, lab.Generation)
+		return 0, o.updateStatus(lab, status)
+
+	case pod != nil:
+		status.PodName, status.Template = pod.Name, lab.Spec.Template
+		status.Endpoints = labEndpoints(template, pod)
+		setLabCondition(status, "Provisioned", metav1.ConditionTrue, "PodCreated", "Pod "+pod.Name+" criado", lab.Generation)
+		if labStatus(pod) == "Running" && podIsReady(pod) && prepared(pod) && !restorePending(pod) {
+			status.Phase, status.Message = GirusLabReady, ""
+			setLabCondition(status, "Ready", metav1.ConditionTrue, "LabReady", "Laboratório pronto", lab.Generation)
+			requeue := operatorRequeue
+			if !expiresAt.IsZero() && time.Until(expiresAt) < requeue {
+				requeue = time.Until(expiresAt) + time.Second
+			}
+			return requeue, o.updateStatus(lab, status)
+		}
+		status.Phase, status.Message = GirusLabProvisioning, labStatus(pod)
+		setLabCondition(status, "Ready", metav1.ConditionFalse, "Provisioning", "Aguardando o laboratório ficar pronto", lab.Generation)
+		return operatorPendingRequeue, o.updateStatus(lab, status)
+
+	case o.lm.isPaused(namespace):
+		status.Phase, status.Message, status.Endpoints = GirusLabPaused, "Laboratório pausado", nil
+		setLabCondition(status, "Ready", metav1.ConditionFalse, "Paused", status.Message, lab.Generation)
+		return operatorRequeue, o.updateStatus(lab, status)
+
+	case o.lm.operations.Active(lab.Spec.User):
+		// Uma criação ou reinício pela API está em andamento para o usuário
+		return operatorPendingRequeue, nil
+
+	case status.Template == lab.Spec.Template && (status.Phase == GirusLabReady || status.Phase == GirusLabTerminated):
+		// O pod foi removido fora do GirusLab: o registro é mantido sem recriar o laboratório
+		status.Phase, status.Message, status.PodName, status.Endpoints = GirusLabTerminated, "O pod do laboratório foi removido", "", nil
+		setLabCondition(status, "Ready", metav1.ConditionFalse, "PodDeleted", status.Message, lab.Generation)
+		return 0, o.updateStatus(lab, status)
+	}
+
+	// Primeiro provisionamento, troca de template ou provisionamento interrompido
+	labTemplate := template
+	if lab.Spec.Resources != nil {
+		custom := *template
+		resources := lab.Spec.Resources.merge(resolveResources(template))
+		custom.Resources = &resources
+		labTemplate = &custom
+	}
+	log.Printf("[Operador] Provisionando o laboratório %s (usuário %s, template %s)", name, lab.Spec.User, lab.Spec.Template)
+	created, err := o.lm.createLabFromTemplate(lab.Spec.User, labTemplate, labCreateOptions{skipPool: lab.Spec.Resources != nil}, nil)
+	if errors.IsTooManyRequests(err) {
+		// Sem vaga: o GirusLab aguarda como um pedido na fila e é verificado novamente
+		status.Phase, status.Message = GirusLabPending, err.Error()
+		setLabCondition(status, "Provisioned", metav1.ConditionFalse, "CapacityExceeded", err.Error(), lab.Generation)
+		return capacityRetryAfter, o.updateStatus(lab, status)
+	}
+	if err != nil {
+		status.Phase, status.Message = GirusLabFailed, err.Error()
+		setLabCondition(status, "Provisioned", metav1.ConditionFalse, "ProvisioningFailed", err.Error(), lab.Generation)
+		if statusErr := o.updateStatus(lab, status); statusErr != nil {
+			log.Printf("[Operador] Erro ao atualizar status de %s: %v", name, statusErr)
+		}
+		return 0, err
+	}
+	if err := o.lm.setNamespaceLabel(created.Namespace, girusLabLabel, name); err != nil {
+		log.Printf("[Operador] Erro ao associar o namespace %s ao GirusLab %s: %v", created.Namespace, name, err)
+	}
+	status.Phase, status.Message = GirusLabProvisioning, ""
+	status.Namespace, status.PodName, status.Template = created.Namespace, created.Name, lab.Spec.Template
+	status.StartedAt = podStartTime(created).Format(time.RFC3339)
+	setLabCondition(status, "Provisioned", metav1.ConditionTrue, "PodCreated", "Pod "+created.Name+" criado", lab.Generation)
+	return operatorPendingRequeue, o.updateStatus(lab, status)
+}
+
+// conflictingLab impede que dois GirusLabs ativos controlem o laboratório do mesmo usuário
+func (o *LabOperator) conflictingLab(lab *GirusLab) error {
+	for _, obj := range o.informer.GetIndexer().List() {
+		other, err := girusLabFromObject(obj)
+		if err != nil || other.Name == lab.Name || other.Spec.User != lab.Spec.User || other.DeletionTimestamp != nil {
+			continue
+		}
+		switch other.Status.Phase {
+		case GirusLabFailed, GirusLabExpired, GirusLabTerminated:
+			continue
+		}
+		if other.CreationTimestamp.Before(&lab.CreationTimestamp) {
+			return fmt.Errorf("o usuário %s já tem o laboratório controlado pelo GirusLab %s", lab.Spec.User, other.Name)
+		}
+	}
+	return nil
+}
+
+// labEndpoints lista os endereços do terminal e das portas expostas do laboratório
+func labEndpoints(template *LabTemplate, pod *v1.Pod) []LabEndpoint {
+	endpoints := []LabEndpoint{
+		{Name: "terminal", Path: fmt.Sprintf("/ws/terminal/%s/%s", pod.Namespace, pod.Name)},
+	}
+	for _, exposed := range template.Expose {
+		name := exposed.Name
+		if name == "" {
+			name = "port-" + strconv.Itoa(int(exposed.Port))
+		}
+		endpoints = append(endpoints, LabEndpoint{
+			Name: name,
+			Path: fmt.Sprintf("/api/v1/labs/%s/proxy/%d/", pod.Namespace, exposed.Port),
+		})
+	}
+	return endpoints
+}
+
+// setLabCondition registra uma condição no status
+func setLabCondition(status *GirusLabStatus, conditionType string, value metav1.ConditionStatus, reason, message string, generation int64) {
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             value,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: generation,
+	})
+}
+
+// hasFinalizer indica se o GirusLab tem o finalizer
+func hasFinalizer(lab *GirusLab, finalizer string) bool {
+	for _, existing := range lab.Finalizers {
+		if existing == finalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// removeFinalizer libera o GirusLab para ser removido do cluster
+func (o *LabOperator) removeFinalizer(lab *GirusLab) error {
+	finalizers := []string{}
+	for _, existing := range lab.Finalizers {
+		if existing != girusLabFinalizer {
+			finalizers = append(finalizers, existing)
+		}
+	}
+	lab.Finalizers = finalizers
+	err := o.update(lab)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// update grava metadados e spec do GirusLab
+func (o *LabOperator) update(lab *GirusLab) error {
+	obj, err := lab.toUnstructured()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+	_, err = o.client.Update(ctx, obj, metav1.UpdateOptions{})
+	return err
+}
+
+// updateStatus grava o status quando ele mudou
+func (o *LabOperator) updateStatus(lab *GirusLab, status *GirusLabStatus) error {
+	if equalLabStatus(&lab.Status, status) {
+		return nil
+	}
+	lab.Status = *status
+	obj, err := lab.toUnstructured()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+	_, err = o.client.UpdateStatus(ctx, obj, metav1.UpdateOptions{})
+	return err
+}
+
+// equalLabStatus compara dois status ignorando os horários das condições
+func equalLabStatus(a, b *GirusLabStatus) bool {
+	left, right := a.DeepCopy(), b.DeepCopy()
+	for i := range left.Conditions {
+		left.Conditions[i].LastTransitionTime = metav1.Time{}
+	}
+	for i := range right.Conditions {
+		right.Conditions[i].LastTransitionTime = metav1.Time{}
+	}
+	l, _ := runtime.DefaultUnstructuredConverter.ToUnstructured(left)
+	r, _ := runtime.DefaultUnstructuredConverter.ToUnstructured(right)
+	return fmt.Sprint(l) == fmt.Sprint(r)
+}
+
+// DeepCopy copia o status, inclusive as listas
+func (s *GirusLabStatus) DeepCopy() *GirusLabStatus {
+	c := *s
+	c.Endpoints = append([]LabEndpoint(nil), s.Endpoints...)
+	c.Conditions = append([]metav1.Condition(nil), s.Conditions...)
+	return &c
+}
+
+// Record registra como GirusLab um laboratório criado pela API, para que ele
+// continue acompanhado após reinícios do servidor
+func (o *LabOperator) Record(userID, templateName string, pod *v1.Pod) {
+	for _, obj := range o.informer.GetIndexer().List() {
+		lab, err := girusLabFromObject(obj)
+		if err != nil || lab.Spec.User != userID || lab.DeletionTimestamp != nil {
+			continue
+		}
+		if lab.Spec.Template != templateName || lab.Spec.Expiry != "" || lab.Spec.Resources != nil {
+			lab.Spec = GirusLabSpec{User: userID, Template: templateName}
+			if err := o.update(lab); err != nil {
+				log.Printf("[Operador] Erro ao atualizar o GirusLab %s: %v", lab.Name, err)
+			}
+		}
+		return
+	}
+
+	lab := &GirusLab{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   pod.Namespace,
+			Labels: map[string]string{"createdBy": "girus"},
+		},
+		Spec: GirusLabSpec{User: userID, Template: templateName},
+	}
+	obj, err := lab.toUnstructured()
+	if err != nil {
+		log.Printf("[Operador] Erro ao converter GirusLab %s: %v", lab.Name, err)
+		return
+	}
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+	if _, err := o.client.Create(ctx, obj, metav1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+		log.Printf("[Operador] Erro ao registrar o GirusLab %s: %v", lab.Name, err)
+		return
+	}
+	if err := o.lm.setNamespaceLabel(pod.Namespace, girusLabLabel, lab.Name); err != nil {
+		log.Printf("[Operador] Erro ao associar o namespace %s ao GirusLab %s: %v", pod.Namespace, lab.Name, err)
+	}
+}
+
+// OwnsNamespace indica se um GirusLab ainda ativo controla o namespace. Laboratórios
+// expirados ou encerrados mantêm o registro, mas não o namespace.
+func (o *LabOperator) OwnsNamespace(namespace string) bool {
+	for _, obj := range o.informer.GetIndexer().List() {
+		lab, err := girusLabFromObject(obj)
+		if err != nil || (lab.Status.Namespace != namespace && o.lm.namespaceForUser(lab.Spec.User) != namespace) {
+			continue
+		}
+		if lab.Status.Phase != GirusLabExpired && lab.Status.Phase != GirusLabTerminated {
+			return true
+		}
+	}
+	return false
+}
+
+// Remove exclui o GirusLab do usuário; a remoção do namespace fica para o
+// finalizer. Retorna false quando nenhum GirusLab controla o laboratório.
+func (o *LabOperator) Remove(userID string) (bool, error) {
+	for _, obj := range o.informer.GetIndexer().List() {
+		lab, err := girusLabFromObject(obj)
+		if err != nil || lab.Spec.User != userID {
+			continue
+		}
+		if lab.DeletionTimestamp != nil {
+			return true, nil
+		}
+		ctx, cancel := contextWithTimeout()
+		defer cancel()
+		if err := o.client.Delete(ctx, lab.Name, metav1.DeleteOptions{}); err != nil {
+			if errors.IsNotFound(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		log.Printf("[Operador] GirusLab %s excluído a pedido da API", lab.Name)
+		return true, nil
+	}
+	return false, nil
+}
+
+// isPaused indica se o laboratório do namespace está pausado
+func (lm *LabManager) isPaused(namespace string) bool {
+	ns, err := lm.getNamespace(namespace)
+	if err != nil {
+		return false
+	}
+	_, paused := ns.Annotations[pausedAtAnnotation]
+	return paused
+}
+
+// girusLabCRD é a definição do recurso GirusLab instalada no modo operador
+func girusLabCRD() *unstructured.Unstructured {
+	str := map[string]interface{}{"type": "string"}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apiextensions.k8s.io/v1",
+		"kind":       "CustomResourceDefinition",
+		"metadata": map[string]interface{}{
+			"name":   "giruslabs.girus.io",
+			"labels": map[string]interface{}{"createdBy": "girus"},
+		},
+		"spec": map[string]interface{}{
+			"group": "girus.io",
+			"scope": "Cluster",
+			"names": map[string]interface{}{
+				"kind":       "GirusLab",
+				"listKind":   "GirusLabList",
+				"plural":     "giruslabs",
+				"singular":   "giruslab",
+				"shortNames": []interface{}{"glab"},
+			},
+			"versions": []interface{}{map[string]interface{}{
+				"name":         "v1alpha1",
+				"served":       true,
+				"storage":      true,
+				"subresources": map[string]interface{}{"status": map[string]interface{}{}},
+				"additionalPrinterColumns": []interface{}{
+					map[string]interface{}{"name": "User", "type": "string", "jsonPath": ".spec.user"},
+					map[string]interface{}{"name": "Template", "type": "string", "jsonPath": ".spec.template"},
+					map[string]interface{}{"name": "Phase", "type": "string", "jsonPath": ".status.phase"},
+					map[string]interface{}{"name": "Expires", "type": "string", "jsonPath": ".status.expiresAt"},
+					map[string]interface{}{"name": "Age", "type": "date", "jsonPath": ".metadata.creationTimestamp"},
+				},
+				"schema": map[string]interface{}{"openAPIV3Schema": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"spec": map[string]interface{}{
+							"type":     "object",
+							"required": []interface{}{"user", "template"},
+							"properties": map[string]interface{}{
+								"user":     str,
+								"template": str,
+								"expiry":   map[string]interface{}{"type": "string", "format": "date-time"},
+								"resources": map[string]interface{}{
+									"type": "object",
+									"properties": map[string]interface{}{
+										"cpuRequest": str, "cpuLimit": str,
+										"memoryRequest": str, "memoryLimit": str,
+										"ephemeralStorageRequest": str, "ephemeralStorageLimit": str,
+									},
+								},
+							},
+						},
+						"status": map[string]interface{}{
+							"type":                                 "object",
+							"x-kubernetes-preserve-unknown-fields": true,
+						},
+					},
+				}},
+			}},
+		},
+	}}
+}
+
+// installGirusLabCRD cria o CRD GirusLab no cluster, caso ainda não exista
+func (lm *LabManager) installGirusLabCRD() error {
+	client, err := lm.backend.DynamicClient()
+	if err != nil {
+		return err
+	}
+	crds := client.Resource(schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"})
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+	_, err = crds.Create(ctx, girusLabCRD(), metav1.CreateOptions{})
+	if errors.IsAlreadyExists(err) {
+		return nil
+	}
+	if err == nil {
+		log.Printf("[Operador] CRD giruslabs.girus.io instalado")
+	}
+	return err
+}
@@ -0,0 +1,314 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// pausedAtAnnotation marca no namespace um laboratório pausado e quando a pausa começou
+	pausedAtAnnotation = "girus.io/paused-at"
+	// pausedTemplateAnnotation registra o template do laboratório pausado
+	pausedTemplateAnnotation = "girus.io/paused-template"
+	// pausedSnapshotAnnotation registra o snapshot com o estado do laboratório pausado
+	pausedSnapshotAnnotation = "girus.io/paused-snapshot"
+	// labStartedAtAnnotation preserva no namespace o início do timer do laboratório pausado
+	labStartedAtAnnotation = "girus.io/lab-started-at"
+)
+
+// pauseAnnotations são as anotações de pausa removidas na retomada
+var pauseAnnotations = []string{pausedAtAnnotation, pausedTemplateAnnotation, pausedSnapshotAnnotation, labStartedAtAnnotation}
+
+// labResource identifica laboratórios nos erros no formato da API do Kubernetes
+var labResource = schema.GroupResource{Group: "girus.io", Resource: "labs"}
+
+// PauseResult descreve um laboratório pausado
+type PauseResult struct {
+	LabID      string `json:"labId"`
+	Template   string `json:"templateId"`
+	PausedAt   string `json:"pausedAt"`
+	SnapshotID string `json:"snapshotId,omitempty"`
+	Workspace  bool   `json:"workspace"`  // O estado também está preservado no workspace persistente
+	StateSaved bool   `json:"stateSaved"` // Falso quando não há snapshot nem workspace para preservar o estado
+}
+
+// labUserID identifica o dono de um namespace de laboratório
+func labUserID(namespace *v1.Namespace) string {
+	if userID := namespace.Labels["userId"]; userID != "" {
+		return userID
+	}
+	if userID := namespace.Labels["user-id"]; userID != "" {
+		return userID
+	}
+	return strings.TrimPrefix(namespace.Name, "lab-")
+}
+
+// podStartTime retorna o início do timer do laboratório: a entrega ao usuário ou a criação do pod
+func podStartTime(pod *v1.Pod) time.Time {
+	if startedAt, ok := pod.Annotations[startedAtAnnotation]; ok {
+		if parsed, err := time.Parse(time.RFC3339, startedAt); err == nil {
+			return parsed
+		}
+	}
+	return pod.CreationTimestamp.Time
+}
+
+// getLabNamespace obtém o namespace de um laboratório (o ID do laboratório é o namespace)
+func (lm *LabManager) getLabNamespace(labID string) (*v1.Namespace, error) {
+	if !strings.HasPrefix(labID, "lab-") {
+		return nil, errors.NewNotFound(labResource, labID)
+	}
+	namespace, err := lm.getNamespace(labID)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, errors.NewNotFound(labResource, labID)
+		}
+		return nil, err
+	}
+	return namespace, nil
+}
+
+// authorizeLab obtém o namespace do laboratório verificando que ele pertence ao
+// usuário informado; instrutores podem agir sobre qualquer laboratório
+func (lm *LabManager) authorizeLab(labID, userID string, instructor bool) (*v1.Namespace, error) {
+	namespace, err := lm.getLabNamespace(labID)
+	if err != nil {
+		return nil, err
+	}
+	if !instructor && labUserID(namespace) != userID {
+		return nil, errors.NewForbidden(labResource, labID, fmt.Errorf("o laboratório pertence a outro usuário"))
+	}
+	return namespace, nil
+}
+
+// PauseLab interrompe o laboratório liberando seus recursos. O estado é preservado
+// em um snapshot (quando habilitados) e no workspace persistente (quando montado),
+// e o timer deixa de contar até a retomada.
+func (lm *LabManager) PauseLab(labID string) (*PauseResult, error) {
+	namespace, err := lm.getLabNamespace(labID)
+	if err != nil {
+		return nil, err
+	}
+	if _, paused := namespace.Annotations[pausedAtAnnotation]; paused {
+		return nil, errors.NewConflict(labResource, labID, fmt.Errorf("o laboratório já está pausado"))
+	}
+
+	pods, err := lm.listLabPods(labID, "app=girus-lab")
+	if err != nil {
+		return nil, fmt.Errorf("erro ao listar pods do laboratório: %v", err)
+	}
+	if len(pods) == 0 {
+		return nil, errors.NewNotFound(labResource, labID)
+	}
+	pod := &pods[0]
+	if restorePending(pod) || preparing(pod) {
+		return nil, errors.NewConflict(labResource, labID, fmt.Errorf("o laboratório ainda está sendo preparado"))
+	}
+
+	templateName := pod.Labels["template"]
+	template := lm.GetTemplate(templateName)
+	if template == nil {
+		return nil, fmt.Errorf("template %s do laboratório não encontrado", templateName)
+	}
+
+	result := &PauseResult{
+		LabID:     labID,
+		Template:  templateName,
+		PausedAt:  time.Now().Format(time.RFC3339),
+		Workspace: lm.usesWorkspace(template) && labID == workspaceNamespace(labUserID(namespace)),
+	}
+
+	// Salvar o estado antes de remover o pod; uma falha cancela a pausa
+	if lm.snapshots != nil && (template.Snapshot == nil || !template.Snapshot.Disabled) {
+		snapshot, err := lm.CreateSnapshot(labID, pod.Name, nil)
+		if err != nil {
+			return nil, fmt.Errorf("erro ao salvar o estado do laboratório: %v", err)
+		}
+		result.SnapshotID = snapshot.ID
+	}
+	result.StateSaved = result.SnapshotID != "" || result.Workspace
+	if !result.StateSaved {
+		log.Printf("[Pause] Laboratório %s pausado sem snapshot nem workspace: o estado do contêiner será perdido", labID)
+	}
+
+	err = lm.updateNamespace(labID, func(namespace *v1.Namespace) bool {
+		if namespace.Annotations == nil {
+			namespace.Annotations = map[string]string{}
+		}
+		namespace.Annotations[pausedAtAnnotation] = result.PausedAt
+		namespace.Annotations[pausedTemplateAnnotation] = templateName
+		namespace.Annotations[labStartedAtAnnotation] = podStartTime(pod).Format(time.RFC3339)
+		if result.SnapshotID != "" {
+			namespace.Annotations[pausedSnapshotAnnotation] = result.SnapshotID
+		} else {
+			delete(namespace.Annotations, pausedSnapshotAnnotation)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("erro ao registrar pausa do laboratório: %v", err)
+	}
+
+	for _, labPod := range pods {
+		if err := lm.DeletePod(labID, labPod.Name); err != nil {
+			log.Printf("[Pause] Erro ao remover pod %s/%s: %v", labID, labPod.Name, err)
+		}
+	}
+
+	log.Printf("[Pause] Laboratório %s pausado (snapshot: %q, workspace: %v)", labID, result.SnapshotID, result.Workspace)
+	return result, nil
+}
+
+// ResumeLab recria o pod de um laboratório pausado, restaura o snapshot salvo na
+// pausa e desloca o início do timer pelo tempo em que o laboratório ficou pausado
+func (lm *LabManager) ResumeLab(labID string) (pod *v1.Pod, err error) {
+	namespace, err := lm.getLabNamespace(labID)
+	if err != nil {
+		return nil, err
+	}
+	pausedAtValue, paused := namespace.Annotations[pausedAtAnnotation]
+	if !paused {
+		return nil, errors.NewConflict(labResource, labID, fmt.Errorf("o laboratório não está pausado"))
+	}
+
+	templateName := namespace.Annotations[pausedTemplateAnnotation]
+	template := lm.GetTemplate(templateName)
+	if template == nil {
+		return nil, fmt.Errorf("template %s do laboratório não encontrado", templateName)
+	}
+	runtime, err := ResolveRuntime(template)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao resolver runtime do template %s: %v", templateName, err)
+	}
+
+	// Retomadas simultâneas nesta réplica são recusadas enquanto a primeira não
+	// termina; entre réplicas, a remoção da marcação de pausa abaixo decide
+	userID := labUserID(namespace)
+	operation, created := lm.operations.CreateOnce("resume-lab", userID, templateName, "")
+	if !created {
+		return nil, errors.NewConflict(labResource, labID, fmt.Errorf("o laboratório já está sendo retomado"))
+	}
+	defer func() { lm.operations.Finish(operation.ID, err) }()
+
+	var snapshot *Snapshot
+	if snapshotID := namespace.Annotations[pausedSnapshotAnnotation]; snapshotID != "" {
+		if lm.snapshots == nil {
+			return nil, fmt.Errorf("snapshots desabilitados: não é possível restaurar o estado do laboratório")
+		}
+		snapshot, err = lm.snapshots.Get(userID, snapshotID)
+		if err != nil {
+			return nil, fmt.Errorf("erro ao obter snapshot da pausa: %v", err)
+		}
+	}
+
+	// A retomada volta a ocupar uma vaga liberada na pausa
+	release, err := lm.reserveCapacity(LabRequest{UserID: userID, Template: templateName, Org: namespace.Labels[orgLabel]})
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	// Remover a marcação de pausa antes de provisionar garante que apenas uma
+	// retomada prossiga: as demais encontram o laboratório já retomado
+	claimed := false
+	err = lm.updateNamespace(labID, func(namespace *v1.Namespace) bool {
+		_, claimed = namespace.Annotations[pausedAtAnnotation]
+		delete(namespace.Annotations, pausedAtAnnotation)
+		return claimed
+	})
+	if err != nil {
+		return nil, fmt.Errorf("erro ao registrar retomada do laboratório: %v", err)
+	}
+	if !claimed {
+		return nil, errors.NewConflict(labResource, labID, fmt.Errorf("o laboratório não está pausado"))
+	}
+
+	podName := generateUniquePodName("lab", userID)
+	pod, err = lm.provisionLab(labID, podName, template, runtime, map[string]string{
+		"app":      "girus-lab",
+		"user":     userID,
+		"template": templateName,
+	}, nil)
+	if err != nil {
+		// O laboratório continua pausado e pode ser retomado novamente
+		if restoreErr := lm.updateNamespace(labID, func(namespace *v1.Namespace) bool {
+			if namespace.Annotations == nil {
+				namespace.Annotations = map[string]string{}
+			}
+			namespace.Annotations[pausedAtAnnotation] = pausedAtValue
+			return true
+		}); restoreErr != nil {
+			log.Printf("[Pause] Erro ao restaurar marcação de pausa do namespace %s: %v", labID, restoreErr)
+		}
+		return nil, err
+	}
+
+	// O timer continua de onde parou: o início é deslocado pela duração da pausa
+	startedAt := pod.CreationTimestamp.Time
+	pausedAt, errPaused := time.Parse(time.RFC3339, pausedAtValue)
+	labStart, errStart := time.Parse(time.RFC3339, namespace.Annotations[labStartedAtAnnotation])
+	if errPaused == nil && errStart == nil {
+		startedAt = labStart.Add(time.Since(pausedAt))
+	}
+	if updated, err := lm.setLabStartTime(pod, startedAt); err != nil {
+		log.Printf("[Pause] Erro ao ajustar o timer do laboratório %s: %v", labID, err)
+	} else {
+		pod = updated
+	}
+
+	if snapshot != nil {
+		if err := lm.setRestoreStatus(pod, snapshot.ID, "pending", ""); err != nil {
+			return nil, fmt.Errorf("erro ao marcar restauração do snapshot: %v", err)
+		}
+		go lm.restoreSnapshot(pod, snapshot)
+	}
+
+	if err := lm.clearNamespaceAnnotations(labID, pauseAnnotations...); err != nil {
+		log.Printf("[Pause] Erro ao remover marcação de pausa do namespace %s: %v", labID, err)
+	}
+
+	log.Printf("[Pause] Laboratório %s retomado com o pod %s", labID, podName)
+	return pod, nil
+}
+
+// clearNamespaceAnnotations remove do namespace as anotações indicadas, se houver
+func (lm *LabManager) clearNamespaceAnnotations(labID string, keys ...string) error {
+	err := lm.updateNamespace(labID, func(namespace *v1.Namespace) bool {
+		changed := false
+		for _, key := range keys {
+			if _, ok := namespace.Annotations[key]; ok {
+				delete(namespace.Annotations, key)
+				changed = true
+			}
+		}
+		return changed
+	})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// PausedLab retorna os dados de pausa do laboratório, caso ele esteja pausado
+func (lm *LabManager) PausedLab(labID string) (*PauseResult, bool) {
+	namespace, err := lm.getLabNamespace(labID)
+	if err != nil {
+		return nil, false
+	}
+	pausedAt, paused := namespace.Annotations[pausedAtAnnotation]
+	if !paused {
+		return nil, false
+	}
+	return &PauseResult{
+		LabID:      labID,
+		Template:   namespace.Annotations[pausedTemplateAnnotation],
+		PausedAt:   pausedAt,
+		SnapshotID: namespace.Annotations[pausedSnapshotAnnotation],
+	}, true
+}
@@ -0,0 +1,118 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// prepareStatusAnnotation indica o andamento da preparação do laboratório após o pod ficar pronto
+	prepareStatusAnnotation = "girus.io/prepare-status"
+	// prepareMessageAnnotation detalha a etapa em andamento ou a falha da preparação
+	prepareMessageAnnotation = "girus.io/prepare-message"
+
+	prepareStatusPreparing = "preparing"
+	prepareStatusReady     = "ready"
+	prepareStatusFailed    = "failed"
+
+	// prepareTimeout limita a espera pelo pod e a execução das etapas de preparação
+	prepareTimeout = 10 * time.Minute
+)
+
+// needsPreparation indica se o laboratório tem etapas a executar depois que o pod fica pronto
+func needsPreparation(template *LabTemplate) bool {
+	return len(template.Files) > 0 || len(template.Setup) > 0
+}
+
+// prepareLab aguarda o pod ficar pronto, copia os arquivos e executa as etapas de
+// setup do template. Até a conclusão o pod fica anotado como "preparing"; uma
+// falha fica registrada no pod e o laboratório não é liberado ao usuário.
+func (lm *LabManager) prepareLab(pod *v1.Pod, template *LabTemplate) {
+	fail := func(err error) {
+		log.Printf("[Preparação] Falha ao preparar o laboratório %s/%s: %v", pod.Namespace, pod.Name, err)
+		if err := lm.setPrepareStatus(pod, prepareStatusFailed, err.Error()); err != nil {
+			log.Printf("[Preparação] Erro ao registrar falha da preparação: %v", err)
+		}
+	}
+
+	if err := WaitForPodReady(lm.clientset, pod, prepareTimeout); err != nil {
+		fail(err)
+		return
+	}
+
+	if err := lm.copyTemplateFiles(pod, template); err != nil {
+		fail(err)
+		return
+	}
+
+	if err := lm.runSetupSteps(pod, template); err != nil {
+		fail(err)
+		return
+	}
+
+	if err := lm.setPrepareStatus(pod, prepareStatusReady, ""); err != nil {
+		log.Printf("[Preparação] Erro ao registrar conclusão da preparação: %v", err)
+		return
+	}
+	log.Printf("[Preparação] Laboratório %s/%s preparado", pod.Namespace, pod.Name)
+}
+
+// setPrepareStatus atualiza as anotações de preparação do pod
+func (lm *LabManager) setPrepareStatus(pod *v1.Pod, status, message string) error {
+	_, err := lm.updateLabPod(pod.Namespace, pod.Name, func(current *v1.Pod) {
+		if current.Annotations == nil {
+			current.Annotations = map[string]string{}
+		}
+		current.Annotations[prepareStatusAnnotation] = status
+		if message != "" {
+			current.Annotations[prepareMessageAnnotation] = message
+		} else {
+			delete(current.Annotations, prepareMessageAnnotation)
+		}
+	})
+	return err
+}
+
+// preparing indica se o pod ainda executa as etapas de preparação
+func preparing(pod *v1.Pod) bool {
+	return pod.Annotations[prepareStatusAnnotation] == prepareStatusPreparing
+}
+
+// labStatus retorna o status do laboratório exibido ao usuário: o estado da
+// preparação enquanto ela não termina com sucesso, senão a fase do pod
+func labStatus(pod *v1.Pod) string {
+	if !prepared(pod) {
+		return pod.Annotations[prepareStatusAnnotation]
+	}
+	return string(pod.Status.Phase)
+}
+
+// prepared indica se a preparação do pod terminou com sucesso (ou não era necessária)
+func prepared(pod *v1.Pod) bool {
+	status := pod.Annotations[prepareStatusAnnotation]
+	return status == "" || status == prepareStatusReady
+}
+
+// waitForPrepared aguarda o fim da preparação do pod, com sucesso ou falha
+func (lm *LabManager) waitForPrepared(pod *v1.Pod, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		ctx, cancel := contextWithTimeout()
+		current, err := lm.clientset.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+		cancel()
+		if err != nil {
+			return fmt.Errorf("erro ao verificar preparação do pod: %v", err)
+		}
+		if !preparing(current) {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timeout esperando a preparação do laboratório")
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
@@ -0,0 +1,83 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+// ExposedPort declara uma porta do laboratório acessível pelo proxy HTTP do
+// backend, por exemplo uma aplicação web criada pelo aluno
+type ExposedPort struct {
+	Name      string `json:"name,omitempty" yaml:"name"`
+	Port      int32  `json:"port" yaml:"port"`
+	Container string `json:"container,omitempty" yaml:"container"` // Contêiner que escuta na porta (padrão: lab)
+}
+
+// validateExposedPorts verifica as portas expostas pelo template
+func validateExposedPorts(template *LabTemplate) error {
+	seen := map[int32]bool{}
+	for _, exposed := range template.Expose {
+		if exposed.Port < 1 || exposed.Port > 65535 {
+			return fmt.Errorf("porta exposta inválida: %d", exposed.Port)
+		}
+		if seen[exposed.Port] {
+			return fmt.Errorf("porta exposta duplicada: %d", exposed.Port)
+		}
+		seen[exposed.Port] = true
+		if !template.hasContainer(exposed.Container) {
+			return fmt.Errorf("porta exposta %d usa contêiner inexistente: %s", exposed.Port, exposed.Container)
+		}
+	}
+	return nil
+}
+
+// exposedPort retorna a declaração da porta no template, se ela for exposta
+func (t *LabTemplate) exposedPort(port int32) (ExposedPort, bool) {
+	for _, exposed := range t.Expose {
+		if exposed.Port == port {
+			return exposed, true
+		}
+	}
+	return ExposedPort{}, false
+}
+
+// ProxyTarget resolve o endereço de uma porta exposta do laboratório. Apenas o
+// dono do laboratório (ou um instrutor) pode acessá-la, e apenas depois que o
+// laboratório termina de ser preparado.
+func (lm *LabManager) ProxyTarget(labID, userID string, port int32, instructor bool) (*url.URL, error) {
+	if _, err := lm.authorizeLab(labID, userID, instructor); err != nil {
+		return nil, err
+	}
+
+	pods, err := lm.listLabPods(labID, "app=girus-lab")
+	if err != nil {
+		return nil, fmt.Errorf("erro ao listar pods do laboratório: %v", err)
+	}
+	if len(pods) == 0 {
+		return nil, errors.NewNotFound(labResource, labID)
+	}
+	pod := &pods[0]
+	if pod.DeletionTimestamp != nil || preparing(pod) || restorePending(pod) {
+		return nil, errors.NewConflict(labResource, labID, fmt.Errorf("o laboratório ainda não está pronto"))
+	}
+
+	template := lm.GetTemplate(pod.Labels["template"])
+	if template == nil {
+		return nil, errors.NewNotFound(labResource, labID)
+	}
+	if _, ok := template.exposedPort(port); !ok {
+		return nil, errors.NewForbidden(labResource, labID, fmt.Errorf("a porta %d não é exposta pelo laboratório", port))
+	}
+	if pod.Status.PodIP == "" {
+		return nil, errors.NewConflict(labResource, labID, fmt.Errorf("o pod do laboratório ainda não tem endereço"))
+	}
+
+	return &url.URL{
+		Scheme: "http",
+		Host:   net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(int(port))),
+	}, nil
+}
@@ -0,0 +1,324 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// labQuotaName é o nome do ResourceQuota e do LimitRange dos namespaces de laboratório
+	labQuotaName = "girus-lab"
+)
+
+// QuotaConfig define os limites de um namespace de laboratório. Os totais vão
+// para o ResourceQuota e os padrões por contêiner para o LimitRange. Valores
+// vazios usam a configuração do servidor e, por fim, os valores embutidos.
+type QuotaConfig struct {
+	Pods                   string `json:"pods,omitempty" yaml:"pods"`
+	CPU                    string `json:"cpu,omitempty" yaml:"cpu"`       // Soma dos limites de CPU
+	Memory                 string `json:"memory,omitempty" yaml:"memory"` // Soma dos limites de memória
+	PersistentVolumeClaims string `json:"persistentVolumeClaims,omitempty" yaml:"persistentVolumeClaims"`
+	Storage                string `json:"storage,omitempty" yaml:"storage"` // Soma dos pedidos de armazenamento
+	LoadBalancers          string `json:"loadBalancers,omitempty" yaml:"loadBalancers"`
+	NodePorts              string `json:"nodePorts,omitempty" yaml:"nodePorts"`
+	DefaultCPU             string `json:"defaultCpu,omitempty" yaml:"defaultCpu"` // Limite aplicado a contêineres sem limite declarado
+	DefaultMemory          string `json:"defaultMemory,omitempty" yaml:"defaultMemory"`
+	DefaultRequestCPU      string `json:"defaultRequestCpu,omitempty" yaml:"defaultRequestCpu"` // Pedido aplicado a contêineres sem pedido declarado
+	DefaultRequestMemory   string `json:"defaultRequestMemory,omitempty" yaml:"defaultRequestMemory"`
+	MaxCPU                 string `json:"maxCpu,omitempty" yaml:"maxCpu"` // Máximo por contêiner (vazio = sem máximo)
+	MaxMemory              string `json:"maxMemory,omitempty" yaml:"maxMemory"`
+}
+
+// builtinQuota são os limites usados quando nem o template nem a configuração os definem
+var builtinQuota = QuotaConfig{
+	Pods:                   "20",
+	CPU:                    "4",
+	Memory:                 "8Gi",
+	PersistentVolumeClaims: "5",
+	Storage:                "20Gi",
+	LoadBalancers:          "0",
+	NodePorts:              "0",
+	DefaultCPU:             "500m",
+	DefaultMemory:          "512Mi",
+	DefaultRequestCPU:      "100m",
+	DefaultRequestMemory:   "128Mi",
+}
+
+// quotaField associa um campo da configuração ao recurso do Kubernetes
+type quotaField struct {
+	name     string
+	value    string
+	resource v1.ResourceName
+}
+
+// totals retorna os campos que compõem o ResourceQuota
+func (q QuotaConfig) totals() []quotaField {
+	return []quotaField{
+		{"pods", q.Pods, v1.ResourcePods},
+		{"cpu", q.CPU, v1.ResourceLimitsCPU},
+		{"memory", q.Memory, v1.ResourceLimitsMemory},
+		{"persistentVolumeClaims", q.PersistentVolumeClaims, v1.ResourcePersistentVolumeClaims},
+		{"storage", q.Storage, v1.ResourceRequestsStorage},
+		{"loadBalancers", q.LoadBalancers, v1.ResourceServicesLoadBalancers},
+		{"nodePorts", q.NodePorts, v1.ResourceServicesNodePorts},
+	}
+}
+
+// containerLimits retorna os campos que compõem o LimitRange
+func (q QuotaConfig) containerLimits() []quotaField {
+	return []quotaField{
+		{"defaultCpu", q.DefaultCPU, v1.ResourceCPU},
+		{"defaultMemory", q.DefaultMemory, v1.ResourceMemory},
+		{"defaultRequestCpu", q.DefaultRequestCPU, v1.ResourceCPU},
+		{"defaultRequestMemory", q.DefaultRequestMemory, v1.ResourceMemory},
+		{"maxCpu", q.MaxCPU, v1.ResourceCPU},
+		{"maxMemory", q.MaxMemory, v1.ResourceMemory},
+	}
+}
+
+// validate verifica se todas as quantidades definidas podem ser interpretadas
+func (q QuotaConfig) validate() error {
+	for _, field := range append(q.totals(), q.containerLimits()...) {
+		if field.value == "" {
+			continue
+		}
+		if _, err := resource.ParseQuantity(field.value); err != nil {
+			return fmt.Errorf("quantidade inválida em %s (%q): %v", field.name, field.value, err)
+		}
+	}
+	return nil
+}
+
+// merge completa os campos vazios de q com os valores de defaults
+func (q QuotaConfig) merge(defaults QuotaConfig) QuotaConfig {
+	pick := func(value, fallback string) string {
+		if value != "" {
+			return value
+		}
+		return fallback
+	}
+	return QuotaConfig{
+		Pods:                   pick(q.Pods, defaults.Pods),
+		CPU:                    pick(q.CPU, defaults.CPU),
+		Memory:                 pick(q.Memory, defaults.Memory),
+		PersistentVolumeClaims: pick(q.PersistentVolumeClaims, defaults.PersistentVolumeClaims),
+		Storage:                pick(q.Storage, defaults.Storage),
+		LoadBalancers:          pick(q.LoadBalancers, defaults.LoadBalancers),
+		NodePorts:              pick(q.NodePorts, defaults.NodePorts),
+		DefaultCPU:             pick(q.DefaultCPU, defaults.DefaultCPU),
+		DefaultMemory:          pick(q.DefaultMemory, defaults.DefaultMemory),
+		DefaultRequestCPU:      pick(q.DefaultRequestCPU, defaults.DefaultRequestCPU),
+		DefaultRequestMemory:   pick(q.DefaultRequestMemory, defaults.DefaultRequestMemory),
+		MaxCPU:                 pick(q.MaxCPU, defaults.MaxCPU),
+		MaxMemory:              pick(q.MaxMemory, defaults.MaxMemory),
+	}
+}
+
+// resolveQuota combina os limites do template, da configuração e os embutidos
+func resolveQuota(template *LabTemplate) QuotaConfig {
+	quota := config.Lab.Quota.merge(builtinQuota)
+	if template.Quota != nil {
+		quota = template.Quota.merge(quota)
+	}
+	return quota
+}
+
+// quantityList converte os campos definidos em uma lista de recursos
+func quantityList(fields []quotaField) v1.ResourceList {
+	list := v1.ResourceList{}
+	for _, field := range fields {
+		if field.value == "" {
+			continue
+		}
+		if quantity, err := resource.ParseQuantity(field.value); err == nil {
+			list[field.resource] = quantity
+		}
+	}
+	return list
+}
+
+// labResourceQuota monta o ResourceQuota do namespace do laboratório
+func labResourceQuota(quota QuotaConfig) *v1.ResourceQuota {
+	return &v1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   labQuotaName,
+			Labels: map[string]string{"createdBy": "girus"},
+		},
+		Spec: v1.ResourceQuotaSpec{
+			Hard: quantityList(quota.totals()),
+		},
+	}
+}
+
+// labLimitRange monta o LimitRange com os padrões e máximos por contêiner
+func labLimitRange(quota QuotaConfig) *v1.LimitRange {
+	limits := quota.containerLimits()
+	item := v1.LimitRangeItem{
+		Type:           v1.LimitTypeContainer,
+		Default:        quantityList(limits[0:2]),
+		DefaultRequest: quantityList(limits[2:4]),
+	}
+	if max := quantityList(limits[4:6]); len(max) > 0 {
+		item.Max = max
+	}
+	return &v1.LimitRange{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   labQuotaName,
+			Labels: map[string]string{"createdBy": "girus"},
+		},
+		Spec: v1.LimitRangeSpec{
+			Limits: []v1.LimitRangeItem{item},
+		},
+	}
+}
+
+// applyNamespaceQuota instala ou atualiza o ResourceQuota e o LimitRange do namespace
+func (lm *LabManager) applyNamespaceQuota(namespace string, template *LabTemplate) error {
+	quota := resolveQuota(template)
+
+	// O próprio pod do laboratório precisa caber na cota
+	labLimits := createResourceRequirements(resolveResources(template)).Limits
+	for _, field := range []quotaField{{"cpu", quota.CPU, v1.ResourceCPU}, {"memory", quota.Memory, v1.ResourceMemory}} {
+		limit, hasLimit := labLimits[field.resource]
+		total, err := resource.ParseQuantity(field.value)
+		if hasLimit && err == nil && limit.Cmp(total) > 0 {
+			log.Printf("Aviso: o limite de %s do laboratório %s (%s) excede a cota do namespace (%s)", field.name, template.Name, limit.String(), total.String())
+		}
+	}
+
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+
+	quotas := lm.clientset.CoreV1().ResourceQuotas(namespace)
+	wantedQuota := labResourceQuota(quota)
+	existingQuota, err := quotas.Get(ctx, labQuotaName, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		_, err = quotas.Create(ctx, wantedQuota, metav1.CreateOptions{})
+	case err == nil:
+		existingQuota.Spec = wantedQuota.Spec
+		_, err = quotas.Update(ctx, existingQuota, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("erro ao aplicar ResourceQuota: %v", err)
+	}
+
+	limitRanges := lm.clientset.CoreV1().LimitRanges(namespace)
+	wantedLimits := labLimitRange(quota)
+	existingLimits, err := limitRanges.Get(ctx, labQuotaName, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		_, err = limitRanges.Create(ctx, wantedLimits, metav1.CreateOptions{})
+	case err == nil:
+		existingLimits.Spec = wantedLimits.Spec
+		_, err = limitRanges.Update(ctx, existingLimits, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("erro ao aplicar LimitRange: %v", err)
+	}
+
+	log.Printf("Cota aplicada no namespace %s (cpu=%s, memória=%s, pods=%s)", namespace, quota.CPU, quota.Memory, quota.Pods)
+	return nil
+}
+
+// quotaStatusUnknown indica que o pod foi recusado porque o controlador ainda
+// não calculou o uso inicial de um ResourceQuota recém-criado
+func quotaStatusUnknown(err error) bool {
+	return errors.IsForbidden(err) && strings.Contains(err.Error(), "status unknown for quota")
+}
+
+// QuotaResourceUsage é o uso de um recurso limitado pela cota do namespace
+type QuotaResourceUsage struct {
+	Resource string `json:"resource"`
+	Hard     string `json:"hard"`
+	Used     string `json:"used"`
+	Percent  int    `json:"percent"`
+}
+
+// QuotaUsage resume a cota de um laboratório e os bloqueios recentes causados por ela
+type QuotaUsage struct {
+	LabID          string               `json:"labId"`
+	Resources      []QuotaResourceUsage `json:"resources"`
+	Defaults       map[string]string    `json:"containerDefaults,omitempty"`
+	DefaultRequest map[string]string    `json:"containerDefaultRequests,omitempty"`
+	Max            map[string]string    `json:"containerMax,omitempty"`
+	Exceeded       []string             `json:"exceeded"` // Recursos sem capacidade restante
+	Warnings       []string             `json:"warnings"` // Criações recusadas pela cota
+}
+
+// GetQuotaUsage retorna o uso da cota do namespace do laboratório
+func (lm *LabManager) GetQuotaUsage(labID string) (*QuotaUsage, error) {
+	if _, err := lm.getLabNamespace(labID); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+	quota, err := lm.clientset.CoreV1().ResourceQuotas(labID).Get(ctx, labQuotaName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &QuotaUsage{LabID: labID, Resources: []QuotaResourceUsage{}, Exceeded: []string{}, Warnings: []string{}}
+	for name, hard := range quota.Spec.Hard {
+		used := quota.Status.Used[name]
+		item := QuotaResourceUsage{Resource: string(name), Hard: hard.String(), Used: used.String()}
+		if hard.MilliValue() > 0 {
+			item.Percent = int(used.MilliValue() * 100 / hard.MilliValue())
+		}
+		if !hard.IsZero() && used.Cmp(hard) >= 0 {
+			usage.Exceeded = append(usage.Exceeded, string(name))
+		}
+		usage.Resources = append(usage.Resources, item)
+	}
+	sort.Slice(usage.Resources, func(i, j int) bool { return usage.Resources[i].Resource < usage.Resources[j].Resource })
+	sort.Strings(usage.Exceeded)
+
+	if limitRange, err := lm.clientset.CoreV1().LimitRanges(labID).Get(ctx, labQuotaName, metav1.GetOptions{}); err == nil {
+		toMap := func(list v1.ResourceList) map[string]string {
+			values := map[string]string{}
+			for name, quantity := range list {
+				values[string(name)] = quantity.String()
+			}
+			return values
+		}
+		for _, item := range limitRange.Spec.Limits {
+			if item.Type == v1.LimitTypeContainer {
+				usage.Defaults = toMap(item.Default)
+				usage.DefaultRequest = toMap(item.DefaultRequest)
+				if len(item.Max) > 0 {
+					usage.Max = toMap(item.Max)
+				}
+			}
+		}
+	}
+
+	// Eventos recentes de criações recusadas explicam por que um deployment não sobe
+	events, err := lm.clientset.CoreV1().Events(labID).List(ctx, metav1.ListOptions{})
+	if err == nil {
+		sort.Slice(events.Items, func(i, j int) bool {
+			return events.Items[i].LastTimestamp.After(events.Items[j].LastTimestamp.Time)
+		})
+		for _, event := range events.Items {
+			if !strings.Contains(event.Message, "exceeded quota") && !strings.Contains(event.Message, "must specify limits") {
+				continue
+			}
+			if time.Since(event.LastTimestamp.Time) > time.Hour {
+				continue
+			}
+			usage.Warnings = append(usage.Warnings, fmt.Sprintf("%s/%s: %s", event.InvolvedObject.Kind, event.InvolvedObject.Name, event.Message))
+			if len(usage.Warnings) == 10 {
+				break
+			}
+		}
+	}
+	return usage, nil
+}
@@ -0,0 +1,160 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	// resetCountAnnotation registra no namespace quantas vezes o laboratório foi reiniciado
+	resetCountAnnotation = "girus.io/reset-count"
+	// lastResetAnnotation registra no namespace quando o último reinício aconteceu
+	lastResetAnnotation = "girus.io/last-reset-at"
+)
+
+// resetAnnotations são as anotações descartadas quando um novo laboratório é criado no namespace
+var resetAnnotations = []string{resetCountAnnotation, lastResetAnnotation}
+
+// Políticas de timer aplicadas ao reiniciar um laboratório
+const (
+	ResetTimerKeep    = "keep"    // O timer continua contando desde o início original
+	ResetTimerRestart = "restart" // O timer recomeça e as extensões são descartadas
+)
+
+// resetTimerPolicy retorna a política de timer configurada, recorrendo a "keep"
+func resetTimerPolicy() string {
+	if config.Lab.Reset.Timer == ResetTimerRestart {
+		return ResetTimerRestart
+	}
+	return ResetTimerKeep
+}
+
+// StartResetLab recria do zero o pod, os ConfigMaps e o setup de um laboratório
+// com o mesmo template, em segundo plano. O namespace (a identidade do
+// laboratório), o histórico de tarefas validadas e o workspace persistente são
+// preservados; o timer segue a política configurada. Os terminais conectados
+// são encerrados com um código que pede a reconexão.
+func (lm *LabManager) StartResetLab(labID string) (*Operation, error) {
+	if config.Lab.Reset.Disabled {
+		return nil, errors.NewForbidden(labResource, labID, fmt.Errorf("o reinício de laboratórios está desabilitado"))
+	}
+	namespace, err := lm.getLabNamespace(labID)
+	if err != nil {
+		return nil, err
+	}
+	if _, paused := namespace.Annotations[pausedAtAnnotation]; paused {
+		return nil, errors.NewConflict(labResource, labID, fmt.Errorf("o laboratório está pausado; retome-o antes de reiniciar"))
+	}
+
+	pods, err := lm.listLabPods(labID, "app=girus-lab")
+	if err != nil {
+		return nil, fmt.Errorf("erro ao listar pods do laboratório: %v", err)
+	}
+	if len(pods) == 0 {
+		return nil, errors.NewNotFound(labResource, labID)
+	}
+	pod := &pods[0]
+	if pod.DeletionTimestamp != nil {
+		return nil, errors.NewConflict(labResource, labID, fmt.Errorf("o laboratório está sendo encerrado"))
+	}
+
+	templateName := pod.Labels["template"]
+	template := lm.GetTemplate(templateName)
+	if template == nil {
+		return nil, fmt.Errorf("template %s do laboratório não encontrado", templateName)
+	}
+	runtime, err := ResolveRuntime(template)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao resolver runtime do template %s: %v", templateName, err)
+	}
+
+	// Cliques repetidos acompanham o reinício já em andamento
+	operation, created := lm.operations.CreateOnce("reset-lab", labUserID(namespace), templateName, "")
+	if !created {
+		return operation, nil
+	}
+	lm.operations.Publish(operation.ID, PhaseAccepted, "Reinício do laboratório iniciado", 0)
+
+	go lm.runResetLab(operation.ID, labID, pods, template, runtime)
+	return lm.operations.Get(operation.ID)
+}
+
+// runResetLab remove os pods do laboratório, provisiona um novo e acompanha a operação
+func (lm *LabManager) runResetLab(operationID, labID string, pods []v1.Pod, template *LabTemplate, runtime *LabRuntime) {
+	previous := &pods[0]
+	startedAt := podStartTime(previous)
+
+	// O cliente recebe o ID da operação para acompanhar o reinício antes de reconectar
+	if count := lm.terminals.Disconnect(labID, terminalResetCode, "lab-reset:"+operationID); count > 0 {
+		log.Printf("[Reset] %d terminal(is) do laboratório %s avisado(s) para reconectar", count, labID)
+	}
+	for _, labPod := range pods {
+		if err := lm.DeletePod(labID, labPod.Name); err != nil {
+			log.Printf("[Reset] Erro ao remover pod %s/%s: %v", labID, labPod.Name, err)
+		}
+	}
+
+	// Os labels preservam o dono, o template e a entrega pelo warm pool
+	labels := map[string]string{}
+	for key, value := range previous.Labels {
+		labels[key] = value
+	}
+	progress := func(phase, message string) {
+		lm.operations.Publish(operationID, phase, message, 0)
+	}
+	pod, err := lm.provisionLab(labID, generateUniquePodName("lab", labels["user"]), template, runtime, labels, progress)
+	if err != nil {
+		log.Printf("[Reset] Falha ao recriar o laboratório %s: %v", labID, err)
+		lm.operations.Finish(operationID, err)
+		return
+	}
+
+	if resetTimerPolicy() == ResetTimerKeep {
+		if updated, err := lm.setLabStartTime(pod, startedAt); err != nil {
+			log.Printf("[Reset] Erro ao preservar o timer do laboratório %s: %v", labID, err)
+		} else {
+			pod = updated
+		}
+	} else if err := lm.clearNamespaceAnnotations(labID, extensionAnnotations...); err != nil {
+		log.Printf("[Reset] Erro ao descartar as extensões do laboratório %s: %v", labID, err)
+	}
+	if err := lm.recordReset(labID); err != nil {
+		log.Printf("[Reset] Erro ao registrar o reinício do laboratório %s: %v", labID, err)
+	}
+
+	log.Printf("[Reset] Laboratório %s recriado com o pod %s (timer: %s)", labID, pod.Name, resetTimerPolicy())
+	lm.operations.SetLab(operationID, pod.Namespace, pod.Name)
+	lm.operations.Finish(operationID, lm.watchLabProgress(operationID, pod))
+}
+
+// setLabStartTime registra no pod o início do timer do laboratório
+func (lm *LabManager) setLabStartTime(pod *v1.Pod, startedAt time.Time) (*v1.Pod, error) {
+	updated, err := lm.updateLabPod(pod.Namespace, pod.Name, func(current *v1.Pod) {
+		if current.Annotations == nil {
+			current.Annotations = map[string]string{}
+		}
+		current.Annotations[startedAtAnnotation] = startedAt.Format(time.RFC3339)
+	})
+	if err != nil {
+		return pod, err
+	}
+	return updated, nil
+}
+
+// recordReset incrementa o contador de reinícios do namespace
+func (lm *LabManager) recordReset(labID string) error {
+	return lm.updateNamespace(labID, func(namespace *v1.Namespace) bool {
+		if namespace.Annotations == nil {
+			namespace.Annotations = map[string]string{}
+		}
+		count, _ := strconv.Atoi(namespace.Annotations[resetCountAnnotation])
+		namespace.Annotations[resetCountAnnotation] = strconv.Itoa(count + 1)
+		namespace.Annotations[lastResetAnnotation] = time.Now().Format(time.RFC3339)
+		return true
+	})
+}
@@ -0,0 +1,338 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/pointer"
+)
+
+// LabRuntime declara explicitamente o ambiente de execução de um laboratório
+type LabRuntime struct {
+	Profile    string             `json:"profile,omitempty" yaml:"profile"`
+	Image      string             `json:"image,omitempty" yaml:"image"`
+	Command    []string           `json:"command,omitempty" yaml:"command"`
+	InitScript *RuntimeInitScript `json:"initScript,omitempty" yaml:"initScript"`
+	Volumes    []RuntimeVolume    `json:"volumes,omitempty" yaml:"volumes"`
+	Readiness  *RuntimeReadiness  `json:"readiness,omitempty" yaml:"readiness"`
+	// Privileged indica que o perfil embutido só funciona em modo privilegiado.
+	// Não é lido do template: templates pedem privilégios pela seção security.
+	Privileged bool `json:"privileged,omitempty" yaml:"-"`
+}
+
+// RuntimeInitScript define um script de inicialização entregue via ConfigMap
+type RuntimeInitScript struct {
+	Name      string `json:"name" yaml:"name"`           // Nome do ConfigMap e do volume
+	FileName  string `json:"fileName" yaml:"fileName"`   // Nome do arquivo dentro do ConfigMap
+	MountPath string `json:"mountPath" yaml:"mountPath"` // Diretório onde o script é montado
+	Content   string `json:"content" yaml:"content"`
+}
+
+// RuntimeVolume define um volume adicional montado no contêiner do laboratório
+type RuntimeVolume struct {
+	Name        string `json:"name" yaml:"name"`
+	MountPath   string `json:"mountPath" yaml:"mountPath"`
+	ConfigMap   string `json:"configMap,omitempty" yaml:"configMap"`
+	Secret      string `json:"secret,omitempty" yaml:"secret"`
+	EmptyDir    bool   `json:"emptyDir,omitempty" yaml:"emptyDir"`
+	SizeLimit   string `json:"sizeLimit,omitempty" yaml:"sizeLimit"`
+	ReadOnly    bool   `json:"readOnly,omitempty" yaml:"readOnly"`
+	DefaultMode *int32 `json:"defaultMode,omitempty" yaml:"defaultMode"`
+}
+
+// RuntimeReadiness define as condições para considerar o laboratório pronto
+type RuntimeReadiness struct {
+	Command             []string `json:"command,omitempty" yaml:"command"`
+	TCPPort             int32    `json:"tcpPort,omitempty" yaml:"tcpPort"`
+	InitialDelaySeconds int32    `json:"initialDelaySeconds,omitempty" yaml:"initialDelaySeconds"`
+	PeriodSeconds       int32    `json:"periodSeconds,omitempty" yaml:"periodSeconds"`
+	TimeoutSeconds      int32    `json:"timeoutSeconds,omitempty" yaml:"timeoutSeconds"`
+	FailureThreshold    int32    `json:"failureThreshold,omitempty" yaml:"failureThreshold"`
+}
+
+// builtinRuntimeProfile retorna uma cópia de um perfil de runtime embutido
+func builtinRuntimeProfile(name string) (*LabRuntime, bool) {
+	switch name {
+	case "kubernetes":
+		// A imagem já traz o cluster configurado, não precisa de script de inicialização
+		return &LabRuntime{
+			Profile:    "kubernetes",
+			Image:      "linuxtips/girus-kind-multi-node:0.1",
+			Command:    []string{"/bin/bash", "-c", "tail -f /dev/null"},
+			Privileged: true, // kind executa containerd e nós do cluster dentro do contêiner
+		}, true
+	case "docker":
+		return &LabRuntime{
+			Profile: "docker",
+			Image:   "linuxtips/girus-devops:0.1",
+			Command: []string{"/bin/bash", "-c", "/scripts/init-docker.sh"},
+			InitScript: &RuntimeInitScript{
+				Name:      "docker-init-script",
+				FileName:  "init-docker.sh",
+				MountPath: "/scripts",
+				Content:   generateDockerInitScript(),
+			},
+			Privileged: true, // Docker-in-Docker
+		}, true
+	case "localstack":
+		// Para LocalStack, usar o entrypoint da imagem do Girus
+		return &LabRuntime{
+			Profile: "localstack",
+			Image:   "linuxtips/girus-localstack:0.1",
+			Command: []string{"/bin/bash", "-c", "/entrypoint.sh"},
+		}, true
+	case "linux":
+		return &LabRuntime{
+			Profile: "linux",
+			Image:   "linuxtips/girus-devops:0.1",
+			Command: []string{"/bin/bash", "-c", "/scripts/init.sh"},
+			InitScript: &RuntimeInitScript{
+				Name:      "k3s-init-script",
+				FileName:  "init.sh",
+				MountPath: "/scripts",
+				Content:   generateK3sInitScript(),
+			},
+		}, true
+	}
+	return nil, false
+}
+
+// BuiltinRuntimeProfiles retorna os nomes dos perfis de runtime embutidos
+func BuiltinRuntimeProfiles() []string {
+	return []string{"kubernetes", "docker", "localstack", "linux"}
+}
+
+// legacyRuntimeProfile detecta o perfil pelo nome do template.
+// Usado apenas para templates que não declaram a seção runtime.
+func legacyRuntimeProfile(templateName string) string {
+	lowerName := strings.ToLower(templateName)
+	switch {
+	case strings.Contains(lowerName, "kubernetes"):
+		return "kubernetes"
+	case strings.Contains(lowerName, "docker"):
+		return "docker"
+	case strings.Contains(lowerName, "aws") || strings.Contains(lowerName, "localstack"):
+		return "localstack"
+	default:
+		return "linux"
+	}
+}
+
+// ResolveRuntime calcula o runtime efetivo de um template, aplicando as
+// declarações do template sobre o perfil embutido referenciado
+func ResolveRuntime(template *LabTemplate) (*LabRuntime, error) {
+	if template.Runtime == nil {
+		// O aviso de obsolescência é emitido uma vez, ao carregar o template
+		runtime, _ := builtinRuntimeProfile(legacyRuntimeProfile(template.Name))
+		if template.Image != "" {
+			runtime.Image = template.Image
+		}
+		return runtime, nil
+	}
+
+	declared := template.Runtime
+	runtime := &LabRuntime{}
+	if declared.Profile != "" {
+		profile, ok := builtinRuntimeProfile(declared.Profile)
+		if !ok {
+			return nil, fmt.Errorf("perfil de runtime desconhecido: %s (disponíveis: %s)",
+				declared.Profile, strings.Join(BuiltinRuntimeProfiles(), ", "))
+		}
+		runtime = profile
+	}
+
+	// Ordem de precedência da imagem: runtime do template, campo image do template, perfil, padrão
+	switch {
+	case declared.Image != "":
+		runtime.Image = declared.Image
+	case template.Image != "":
+		runtime.Image = template.Image
+	case runtime.Image == "":
+		runtime.Image = GetLabImage()
+	}
+
+	if len(declared.Command) > 0 {
+		runtime.Command = declared.Command
+	}
+	if declared.InitScript != nil {
+		initScript := *declared.InitScript
+		if runtime.InitScript != nil {
+			// Completar campos omitidos com os valores do perfil
+			if initScript.Name == "" {
+				initScript.Name = runtime.InitScript.Name
+			}
+			if initScript.FileName == "" {
+				initScript.FileName = runtime.InitScript.FileName
+			}
+			if initScript.MountPath == "" {
+				initScript.MountPath = runtime.InitScript.MountPath
+			}
+			if initScript.Content == "" {
+				initScript.Content = runtime.InitScript.Content
+			}
+		}
+		runtime.InitScript = &initScript
+	}
+	runtime.Volumes = append(runtime.Volumes, declared.Volumes...)
+	if declared.Readiness != nil {
+		runtime.Readiness = declared.Readiness
+	}
+
+	if err := runtime.validate(); err != nil {
+		return nil, err
+	}
+	return runtime, nil
+}
+
+// validate verifica se o runtime resolvido pode ser usado para criar um pod
+func (r *LabRuntime) validate() error {
+	if len(r.Command) == 0 {
+		return fmt.Errorf("runtime sem comando definido (declare runtime.command ou runtime.profile)")
+	}
+
+	if r.InitScript != nil {
+		if r.InitScript.Name == "" || r.InitScript.FileName == "" || r.InitScript.MountPath == "" {
+			return fmt.Errorf("initScript requer name, fileName e mountPath")
+		}
+		if r.InitScript.Content == "" {
+			return fmt.Errorf("initScript %s sem conteúdo", r.InitScript.Name)
+		}
+	}
+
+	names := map[string]bool{"lab-files": true}
+	if r.InitScript != nil {
+		names[r.InitScript.Name] = true
+	}
+	for _, volume := range r.Volumes {
+		if volume.Name == "" || volume.MountPath == "" {
+			return fmt.Errorf("volumes do runtime requerem name e mountPath")
+		}
+		if names[volume.Name] {
+			return fmt.Errorf("volume %s declarado mais de uma vez", volume.Name)
+		}
+		names[volume.Name] = true
+
+		sources := 0
+		if volume.ConfigMap != "" {
+			sources++
+		}
+		if volume.Secret != "" {
+			sources++
+		}
+		if volume.EmptyDir {
+			sources++
+		}
+		if sources > 1 {
+			return fmt.Errorf("volume %s deve declarar apenas uma origem (configMap, secret ou emptyDir)", volume.Name)
+		}
+		if volume.SizeLimit != "" {
+			if _, err := resource.ParseQuantity(volume.SizeLimit); err != nil {
+				return fmt.Errorf("sizeLimit inválido no volume %s: %v", volume.Name, err)
+			}
+		}
+	}
+
+	if r.Readiness != nil && len(r.Readiness.Command) == 0 && r.Readiness.TCPPort == 0 {
+		return fmt.Errorf("readiness requer command ou tcpPort")
+	}
+	return nil
+}
+
+// podVolumes monta os volumes e pontos de montagem do contêiner do laboratório
+func (r *LabRuntime) podVolumes() ([]v1.Volume, []v1.VolumeMount) {
+	volumes := []v1.Volume{}
+	volumeMounts := []v1.VolumeMount{}
+
+	if r.InitScript != nil {
+		volumes = append(volumes, v1.Volume{
+			Name: r.InitScript.Name,
+			VolumeSource: v1.VolumeSource{
+				ConfigMap: &v1.ConfigMapVolumeSource{
+					LocalObjectReference: v1.LocalObjectReference{
+						Name: r.InitScript.Name,
+					},
+					DefaultMode: pointer.Int32(0755), // Tornar executável
+				},
+			},
+		})
+		volumeMounts = append(volumeMounts, v1.VolumeMount{
+			Name:      r.InitScript.Name,
+			MountPath: r.InitScript.MountPath,
+		})
+	}
+
+	// Arquivos do laboratório estão presentes em todos os runtimes
+	volumes = append(volumes, v1.Volume{
+		Name: "lab-files",
+		VolumeSource: v1.VolumeSource{
+			ConfigMap: &v1.ConfigMapVolumeSource{
+				LocalObjectReference: v1.LocalObjectReference{
+					Name: "lab-files",
+				},
+			},
+		},
+	})
+	volumeMounts = append(volumeMounts, v1.VolumeMount{
+		Name:      "lab-files",
+		MountPath: "/lab-files",
+	})
+
+	for _, declared := range r.Volumes {
+		volume := v1.Volume{Name: declared.Name}
+		switch {
+		case declared.ConfigMap != "":
+			volume.ConfigMap = &v1.ConfigMapVolumeSource{
+				LocalObjectReference: v1.LocalObjectReference{Name: declared.ConfigMap},
+				DefaultMode:          declared.DefaultMode,
+			}
+		case declared.Secret != "":
+			volume.Secret = &v1.SecretVolumeSource{
+				SecretName:  declared.Secret,
+				DefaultMode: declared.DefaultMode,
+			}
+		default:
+			emptyDir := &v1.EmptyDirVolumeSource{}
+			if declared.SizeLimit != "" {
+				sizeLimit := resource.MustParse(declared.SizeLimit)
+				emptyDir.SizeLimit = &sizeLimit
+			}
+			volume.EmptyDir = emptyDir
+		}
+		volumes = append(volumes, volume)
+		volumeMounts = append(volumeMounts, v1.VolumeMount{
+			Name:      declared.Name,
+			MountPath: declared.MountPath,
+			ReadOnly:  declared.ReadOnly,
+		})
+	}
+
+	return volumes, volumeMounts
+}
+
+// readinessProbe converte as condições de prontidão em uma probe do Kubernetes
+func (r *LabRuntime) readinessProbe() *v1.Probe {
+	return probeFromReadiness(r.Readiness)
+}
+
+// probeFromReadiness converte condições de prontidão (do runtime ou de um sidecar) em uma probe
+func probeFromReadiness(readiness *RuntimeReadiness) *v1.Probe {
+	if readiness == nil {
+		return nil
+	}
+
+	probe := &v1.Probe{
+		InitialDelaySeconds: readiness.InitialDelaySeconds,
+		PeriodSeconds:       readiness.PeriodSeconds,
+		TimeoutSeconds:      readiness.TimeoutSeconds,
+		FailureThreshold:    readiness.FailureThreshold,
+	}
+	if len(readiness.Command) > 0 {
+		probe.Exec = &v1.ExecAction{Command: readiness.Command}
+	} else {
+		probe.TCPSocket = &v1.TCPSocketAction{Port: intstr.FromInt(int(readiness.TCPPort))}
+	}
+	return probe
+}
@@ -0,0 +1,277 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Modos de anti-afinidade entre pods de laboratório do mesmo template
+const (
+	antiAffinityPreferred = "preferred" // Espalha os laboratórios entre os nós quando possível
+	antiAffinityRequired  = "required"  // Nunca coloca dois laboratórios do template no mesmo nó
+)
+
+// SchedulingSettings define em quais nós os pods de laboratório podem rodar. A
+// configuração do servidor traz os padrões e o template os sobrescreve: o
+// nodeSelector é combinado por chave, as tolerations são somadas e os demais
+// campos do template substituem os da configuração.
+type SchedulingSettings struct {
+	NodeSelector      map[string]string  `json:"nodeSelector,omitempty" yaml:"nodeSelector"`
+	Tolerations       []TolerationRule   `json:"tolerations,omitempty" yaml:"tolerations"`
+	NodeAffinity      []NodeAffinityRule `json:"nodeAffinity,omitempty" yaml:"nodeAffinity"`
+	AntiAffinity      string             `json:"antiAffinity,omitempty" yaml:"antiAffinity"` // "preferred" ou "required"
+	PriorityClassName string             `json:"priorityClassName,omitempty" yaml:"priorityClassName"`
+}
+
+// TolerationRule permite que o laboratório rode em nós com o taint correspondente
+type TolerationRule struct {
+	Key               string `json:"key,omitempty" yaml:"key"`
+	Operator          string `json:"operator,omitempty" yaml:"operator"` // Equal (padrão) ou Exists
+	Value             string `json:"value,omitempty" yaml:"value"`
+	Effect            string `json:"effect,omitempty" yaml:"effect"` // Vazio = todos os efeitos
+	TolerationSeconds *int64 `json:"tolerationSeconds,omitempty" yaml:"tolerationSeconds"`
+}
+
+// NodeAffinityRule restringe ou favorece nós pelo valor de um label
+type NodeAffinityRule struct {
+	Key      string   `json:"key" yaml:"key"`
+	Operator string   `json:"operator" yaml:"operator"` // In, NotIn, Exists, DoesNotExist, Gt ou Lt
+	Values   []string `json:"values,omitempty" yaml:"values"`
+	Weight   int32    `json:"weight,omitempty" yaml:"weight"` // 0 = obrigatória; 1-100 = preferência
+}
+
+// validate verifica operadores, efeitos e pesos declarados
+func (s *SchedulingSettings) validate() error {
+	if s == nil {
+		return nil
+	}
+	for _, toleration := range s.Tolerations {
+		switch v1.TolerationOperator(toleration.Operator) {
+		case "", v1.TolerationOpEqual:
+			if toleration.Key == "" {
+				return fmt.Errorf("toleration com operador Equal precisa de key")
+			}
+		case v1.TolerationOpExists:
+			if toleration.Value != "" {
+				return fmt.Errorf("toleration %s com operador Exists não pode ter value", toleration.Key)
+			}
+		default:
+			return fmt.Errorf("operador de toleration inválido: %s", toleration.Operator)
+		}
+		switch v1.TaintEffect(toleration.Effect) {
+		case "", v1.TaintEffectNoSchedule, v1.TaintEffectPreferNoSchedule, v1.TaintEffectNoExecute:
+		default:
+			return fmt.Errorf("efeito de toleration inválido: %s", toleration.Effect)
+		}
+	}
+	for _, rule := range s.NodeAffinity {
+		if rule.Key == "" {
+			return fmt.Errorf("regra de afinidade sem key")
+		}
+		switch v1.NodeSelectorOperator(rule.Operator) {
+		case v1.NodeSelectorOpIn, v1.NodeSelectorOpNotIn:
+			if len(rule.Values) == 0 {
+				return fmt.Errorf("regra de afinidade %s precisa de values", rule.Key)
+			}
+		case v1.NodeSelectorOpExists, v1.NodeSelectorOpDoesNotExist:
+			if len(rule.Values) > 0 {
+				return fmt.Errorf("regra de afinidade %s com operador %s não pode ter values", rule.Key, rule.Operator)
+			}
+		case v1.NodeSelectorOpGt, v1.NodeSelectorOpLt:
+			if len(rule.Values) != 1 {
+				return fmt.Errorf("regra de afinidade %s com operador %s precisa de um único valor", rule.Key, rule.Operator)
+			}
+		default:
+			return fmt.Errorf("operador de afinidade inválido: %s", rule.Operator)
+		}
+		if rule.Weight < 0 || rule.Weight > 100 {
+			return fmt.Errorf("peso da regra de afinidade %s deve estar entre 0 e 100", rule.Key)
+		}
+	}
+	switch s.AntiAffinity {
+	case "", antiAffinityPreferred, antiAffinityRequired:
+	default:
+		return fmt.Errorf("antiAffinity inválido: %s", s.AntiAffinity)
+	}
+	if strings.ContainsAny(s.PriorityClassName, " /") {
+		return fmt.Errorf("priorityClassName inválido: %s", s.PriorityClassName)
+	}
+	return nil
+}
+
+// mergeScheduling combina os padrões da configuração com as definições do template
+func mergeScheduling(defaults SchedulingSettings, template *SchedulingSettings) SchedulingSettings {
+	merged := SchedulingSettings{
+		NodeSelector:      map[string]string{},
+		Tolerations:       append([]TolerationRule{}, defaults.Tolerations...),
+		NodeAffinity:      defaults.NodeAffinity,
+		AntiAffinity:      defaults.AntiAffinity,
+		PriorityClassName: defaults.PriorityClassName,
+	}
+	for key, value := range defaults.NodeSelector {
+		merged.NodeSelector[key] = value
+	}
+	if template == nil {
+		return merged
+	}
+
+	for key, value := range template.NodeSelector {
+		merged.NodeSelector[key] = value
+	}
+	for _, toleration := range template.Tolerations {
+		duplicate := false
+		for _, existing := range merged.Tolerations {
+			if existing.Key == toleration.Key && existing.Operator == toleration.Operator &&
+				existing.Value == toleration.Value && existing.Effect == toleration.Effect {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			merged.Tolerations = append(merged.Tolerations, toleration)
+		}
+	}
+	if len(template.NodeAffinity) > 0 {
+		merged.NodeAffinity = template.NodeAffinity
+	}
+	if template.AntiAffinity != "" {
+		merged.AntiAffinity = template.AntiAffinity
+	}
+	if template.PriorityClassName != "" {
+		merged.PriorityClassName = template.PriorityClassName
+	}
+	return merged
+}
+
+// tolerations converte as tolerations declaradas para o pod
+func (s SchedulingSettings) tolerations() []v1.Toleration {
+	tolerations := make([]v1.Toleration, 0, len(s.Tolerations))
+	for _, rule := range s.Tolerations {
+		operator := v1.TolerationOperator(rule.Operator)
+		if operator == "" {
+			operator = v1.TolerationOpEqual
+		}
+		tolerations = append(tolerations, v1.Toleration{
+			Key:               rule.Key,
+			Operator:          operator,
+			Value:             rule.Value,
+			Effect:            v1.TaintEffect(rule.Effect),
+			TolerationSeconds: rule.TolerationSeconds,
+		})
+	}
+	return tolerations
+}
+
+// affinity monta a afinidade de nós e a anti-afinidade entre laboratórios do template
+func (s SchedulingSettings) affinity(templateName string) *v1.Affinity {
+	affinity := &v1.Affinity{}
+
+	var required []v1.NodeSelectorRequirement
+	var preferred []v1.PreferredSchedulingTerm
+	for _, rule := range s.NodeAffinity {
+		requirement := v1.NodeSelectorRequirement{
+			Key:      rule.Key,
+			Operator: v1.NodeSelectorOperator(rule.Operator),
+			Values:   rule.Values,
+		}
+		if rule.Weight == 0 {
+			required = append(required, requirement)
+			continue
+		}
+		preferred = append(preferred, v1.PreferredSchedulingTerm{
+			Weight:     rule.Weight,
+			Preference: v1.NodeSelectorTerm{MatchExpressions: []v1.NodeSelectorRequirement{requirement}},
+		})
+	}
+	if len(required) > 0 || len(preferred) > 0 {
+		affinity.NodeAffinity = &v1.NodeAffinity{PreferredDuringSchedulingIgnoredDuringExecution: preferred}
+		if len(required) > 0 {
+			affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = &v1.NodeSelector{
+				NodeSelectorTerms: []v1.NodeSelectorTerm{{MatchExpressions: required}},
+			}
+		}
+	}
+
+	if s.AntiAffinity != "" {
+		// Os laboratórios ficam em namespaces diferentes, por isso o seletor de namespaces é vazio
+		term := v1.PodAffinityTerm{
+			LabelSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": "girus-lab", "template": templateName},
+			},
+			NamespaceSelector: &metav1.LabelSelector{},
+			TopologyKey:       "kubernetes.io/hostname",
+		}
+		affinity.PodAntiAffinity = &v1.PodAntiAffinity{}
+		if s.AntiAffinity == antiAffinityRequired {
+			affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution = []v1.PodAffinityTerm{term}
+		} else {
+			affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution = []v1.WeightedPodAffinityTerm{
+				{Weight: 100, PodAffinityTerm: term},
+			}
+		}
+	}
+
+	if affinity.NodeAffinity == nil && affinity.PodAntiAffinity == nil {
+		return nil
+	}
+	return affinity
+}
+
+// applyScheduling aplica ao pod as restrições de agendamento do template e da configuração
+func applyScheduling(spec *v1.PodSpec, template *LabTemplate) {
+	scheduling := mergeScheduling(config.Lab.Scheduling, template.Scheduling)
+	if len(scheduling.NodeSelector) > 0 {
+		spec.NodeSelector = scheduling.NodeSelector
+	}
+	spec.Tolerations = scheduling.tolerations()
+	spec.Affinity = scheduling.affinity(template.Name)
+	spec.PriorityClassName = scheduling.PriorityClassName
+
+	if len(scheduling.NodeSelector) > 0 || scheduling.PriorityClassName != "" {
+		keys := make([]string, 0, len(scheduling.NodeSelector))
+		for key, value := range scheduling.NodeSelector {
+			keys = append(keys, key+"="+value)
+		}
+		sort.Strings(keys)
+		log.Printf("Agendamento do laboratório %s: nodeSelector=[%s], priorityClass=%q", template.Name, strings.Join(keys, ","), scheduling.PriorityClassName)
+	}
+}
+
+// parseNodeSelector interpreta uma lista "chave=valor,chave=valor"
+func parseNodeSelector(value string) map[string]string {
+	selector := map[string]string{}
+	for _, entry := range splitList(value) {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			log.Printf("Entrada inválida no nodeSelector: %s", entry)
+			continue
+		}
+		selector[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return selector
+}
+
+// parseTolerations interpreta uma lista "chave=valor:Efeito,chave:Efeito". Sem
+// valor, a toleration usa o operador Exists.
+func parseTolerations(value string) []TolerationRule {
+	tolerations := []TolerationRule{}
+	for _, entry := range splitList(value) {
+		rule := TolerationRule{}
+		if idx := strings.LastIndex(entry, ":"); idx >= 0 {
+			rule.Effect = entry[idx+1:]
+			entry = entry[:idx]
+		}
+		if parts := strings.SplitN(entry, "=", 2); len(parts) == 2 {
+			rule.Key, rule.Value = parts[0], parts[1]
+		} else {
+			rule.Key, rule.Operator = entry, string(v1.TolerationOpExists)
+		}
+		tolerations = append(tolerations, rule)
+	}
+	return tolerations
+}
@@ -0,0 +1,101 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/utils/pointer"
+)
+
+// SecuritySettings declara as permissões adicionais que um contêiner do
+// laboratório precisa. Sem declaração, o contêiner roda sem privilégios, sem
+// capabilities e sem escalonamento de privilégios.
+type SecuritySettings struct {
+	Privileged       bool     `json:"privileged,omitempty" yaml:"privileged"`
+	Capabilities     []string `json:"capabilities,omitempty" yaml:"capabilities"`         // Ex.: NET_ADMIN, SYS_PTRACE
+	RuntimeClassName string   `json:"runtimeClassName,omitempty" yaml:"runtimeClassName"` // Sobrescreve o padrão da configuração
+}
+
+var capabilityPattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+// validate verifica se as capabilities declaradas são nomes válidos
+func (s *SecuritySettings) validate() error {
+	if s == nil {
+		return nil
+	}
+	for _, capability := range s.Capabilities {
+		if !capabilityPattern.MatchString(normalizeCapability(capability)) {
+			return fmt.Errorf("capability inválida: %s", capability)
+		}
+	}
+	return nil
+}
+
+// normalizeCapability remove o prefixo CAP_ aceito por conveniência nos templates
+func normalizeCapability(capability string) string {
+	return strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(capability)), "CAP_")
+}
+
+// containerSecurityContext monta o contexto de segurança de um contêiner.
+// requiredPrivileged indica que o perfil de runtime exige modo privilegiado
+// (Docker-in-Docker, Kubernetes em contêiner). Quando a configuração proíbe
+// escalonamento, qualquer pedido de privilégio ou capability é recusado.
+func containerSecurityContext(name string, settings *SecuritySettings, requiredPrivileged bool) (*v1.SecurityContext, error) {
+	privileged := requiredPrivileged
+	capabilities := []v1.Capability{}
+	if settings != nil {
+		privileged = privileged || settings.Privileged
+		for _, capability := range settings.Capabilities {
+			capabilities = append(capabilities, v1.Capability(normalizeCapability(capability)))
+		}
+	}
+
+	if (privileged || len(capabilities) > 0) && config.Lab.Security.ForbidEscalation {
+		return nil, fmt.Errorf("o contêiner %s requer privilégios adicionais, mas a configuração do servidor proíbe escalonamento", name)
+	}
+
+	if privileged {
+		return &v1.SecurityContext{
+			Privileged: pointer.Bool(true),
+		}, nil
+	}
+
+	securityContext := &v1.SecurityContext{
+		Privileged: pointer.Bool(false),
+		Capabilities: &v1.Capabilities{
+			Drop: []v1.Capability{"ALL"},
+			Add:  capabilities,
+		},
+	}
+	// O Kubernetes não aceita CAP_SYS_ADMIN com allowPrivilegeEscalation=false
+	allowEscalation := false
+	for _, capability := range capabilities {
+		if capability == "SYS_ADMIN" {
+			allowEscalation = true
+		}
+	}
+	securityContext.AllowPrivilegeEscalation = pointer.Bool(allowEscalation)
+	return securityContext, nil
+}
+
+// podSecurityContext retorna o contexto de segurança aplicado a todo o pod do laboratório
+func podSecurityContext() *v1.PodSecurityContext {
+	return &v1.PodSecurityContext{
+		SeccompProfile: &v1.SeccompProfile{
+			Type: v1.SeccompProfileTypeRuntimeDefault,
+		},
+	}
+}
+
+// runtimeClassName retorna o RuntimeClass do pod: o declarado pelo template ou o padrão da configuração
+func runtimeClassName(settings *SecuritySettings) *string {
+	if settings != nil && settings.RuntimeClassName != "" {
+		return pointer.String(settings.RuntimeClassName)
+	}
+	if config.Lab.Security.RuntimeClassName != "" {
+		return pointer.String(config.Lab.Security.RuntimeClassName)
+	}
+	return nil
+}
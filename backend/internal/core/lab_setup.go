@@ -0,0 +1,134 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// defaultSetupTimeout é o tempo máximo de cada tentativa de uma etapa sem timeout declarado
+	defaultSetupTimeout = 2 * time.Minute
+	// defaultSetupRetryDelay é a espera entre tentativas de uma etapa sem retryDelay declarado
+	defaultSetupRetryDelay = 5 * time.Second
+	// maxSetupRetries limita as novas tentativas de cada etapa
+	maxSetupRetries = 10
+)
+
+// SetupStep define um comando executado no laboratório depois que o pod fica
+// pronto, por exemplo para criar um Deployment quebrado ou popular um banco
+type SetupStep struct {
+	Name       string `json:"name" yaml:"name"`
+	Command    string `json:"command" yaml:"command"`                 // Executado com o shell do contêiner
+	Container  string `json:"container,omitempty" yaml:"container"`   // Contêiner onde o comando é executado (padrão: lab)
+	Timeout    string `json:"timeout,omitempty" yaml:"timeout"`       // Tempo máximo de cada tentativa (padrão: 2m)
+	Retries    int    `json:"retries,omitempty" yaml:"retries"`       // Novas tentativas após uma falha
+	RetryDelay string `json:"retryDelay,omitempty" yaml:"retryDelay"` // Espera entre tentativas (padrão: 5s)
+}
+
+// validateSetupSteps verifica nomes, comandos, contêineres e durações das etapas de setup
+func validateSetupSteps(template *LabTemplate) error {
+	seen := map[string]bool{}
+	for i, step := range template.Setup {
+		if step.Name == "" {
+			return fmt.Errorf("etapa de setup %d sem nome", i+1)
+		}
+		if seen[step.Name] {
+			return fmt.Errorf("etapa de setup duplicada: %s", step.Name)
+		}
+		seen[step.Name] = true
+
+		if strings.TrimSpace(step.Command) == "" {
+			return fmt.Errorf("etapa de setup %s sem comando", step.Name)
+		}
+		if !template.hasContainer(step.Container) {
+			return fmt.Errorf("etapa de setup %s usa contêiner inexistente: %s", step.Name, step.Container)
+		}
+		if step.Retries < 0 || step.Retries > maxSetupRetries {
+			return fmt.Errorf("etapa de setup %s: retries deve estar entre 0 e %d", step.Name, maxSetupRetries)
+		}
+		for _, value := range []string{step.Timeout, step.RetryDelay} {
+			if value == "" {
+				continue
+			}
+			if duration, err := time.ParseDuration(value); err != nil || duration <= 0 {
+				return fmt.Errorf("etapa de setup %s: duração inválida %q", step.Name, value)
+			}
+		}
+	}
+	return nil
+}
+
+// durations retorna o timeout e a espera entre tentativas da etapa
+func (s SetupStep) durations() (time.Duration, time.Duration) {
+	timeout, retryDelay := defaultSetupTimeout, defaultSetupRetryDelay
+	if parsed, err := time.ParseDuration(s.Timeout); err == nil && parsed > 0 {
+		timeout = parsed
+	}
+	if parsed, err := time.ParseDuration(s.RetryDelay); err == nil && parsed > 0 {
+		retryDelay = parsed
+	}
+	return timeout, retryDelay
+}
+
+// runSetupSteps executa as etapas de setup do template em ordem. Uma etapa que
+// esgota as tentativas interrompe o setup e o erro indica a etapa e sua saída.
+func (lm *LabManager) runSetupSteps(pod *v1.Pod, template *LabTemplate) error {
+	for i, step := range template.Setup {
+		container := step.Container
+		if container == "" {
+			container = labContainerName
+		}
+		timeout, retryDelay := step.durations()
+		attempts := step.Retries + 1
+
+		var lastErr error
+		for attempt := 1; attempt <= attempts; attempt++ {
+			progress := fmt.Sprintf("etapa %d/%d: %s (tentativa %d/%d)", i+1, len(template.Setup), step.Name, attempt, attempts)
+			if err := lm.setPrepareStatus(pod, prepareStatusPreparing, progress); err != nil {
+				log.Printf("[Setup] Erro ao registrar progresso do setup: %v", err)
+			}
+
+			var stdout, stderr bytes.Buffer
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			err := lm.backend.Exec(ctx, pod, ExecOptions{
+				Container: container,
+				Command:   []string{containerShell(container), "-c", step.Command},
+				Stdout:    &stdout,
+				Stderr:    &stderr,
+			})
+			if ctx.Err() == context.DeadlineExceeded {
+				err = fmt.Errorf("timeout de %s excedido", timeout)
+			}
+			cancel()
+
+			if err == nil {
+				log.Printf("[Setup] Etapa %s concluída em %s/%s", step.Name, pod.Namespace, pod.Name)
+				lastErr = nil
+				break
+			}
+
+			output := strings.TrimSpace(stderr.String())
+			if output == "" {
+				output = strings.TrimSpace(stdout.String())
+			}
+			if output != "" {
+				output = ": " + truncateString(output, 500)
+			}
+			lastErr = fmt.Errorf("etapa de setup %s falhou após %d tentativa(s): %v%s", step.Name, attempt, err, output)
+			log.Printf("[Setup] Tentativa %d/%d da etapa %s em %s/%s falhou: %v", attempt, attempts, step.Name, pod.Namespace, pod.Name, err)
+			if attempt < attempts {
+				time.Sleep(retryDelay)
+			}
+		}
+		if lastErr != nil {
+			return lastErr
+		}
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// labContainerName é o nome do contêiner principal do laboratório (shell do aluno)
+const labContainerName = "lab"
+
+// SidecarContainer define um serviço auxiliar executado ao lado do contêiner do
+// laboratório, no mesmo pod (banco de dados, cache, API simulada, etc.)
+type SidecarContainer struct {
+	Name      string            `json:"name" yaml:"name"`
+	Image     string            `json:"image" yaml:"image"`
+	Command   []string          `json:"command,omitempty" yaml:"command"`
+	Args      []string          `json:"args,omitempty" yaml:"args"`
+	Env       map[string]string `json:"env,omitempty" yaml:"env"`
+	Ports     []SidecarPort     `json:"ports,omitempty" yaml:"ports"`
+	Readiness *RuntimeReadiness `json:"readiness,omitempty" yaml:"readiness"`
+	Security  *SecuritySettings `json:"security,omitempty" yaml:"security"`
+}
+
+// SidecarPort define uma porta exposta por um sidecar
+type SidecarPort struct {
+	Name          string `json:"name,omitempty" yaml:"name"`
+	ContainerPort int32  `json:"containerPort" yaml:"containerPort"`
+	Protocol      string `json:"protocol,omitempty" yaml:"protocol"` // TCP (padrão) ou UDP
+}
+
+// SidecarStatus resume o estado de um sidecar no pod do laboratório
+type SidecarStatus struct {
+	Name         string             `json:"name"`
+	Image        string             `json:"image"`
+	Ready        bool               `json:"ready"`
+	State        string             `json:"state"`
+	Reason       string             `json:"reason,omitempty"`
+	RestartCount int32              `json:"restartCount"`
+	Ports        []v1.ContainerPort `json:"ports,omitempty"`
+}
+
+// validateSidecars verifica os sidecars declarados por um template
+func validateSidecars(sidecars []SidecarContainer) error {
+	names := map[string]bool{labContainerName: true}
+	for _, sidecar := range sidecars {
+		if sidecar.Name == "" || sidecar.Image == "" {
+			return fmt.Errorf("sidecars requerem name e image")
+		}
+		if errs := validation.IsDNS1123Label(sidecar.Name); len(errs) > 0 {
+			return fmt.Errorf("nome de sidecar inválido %s: %v", sidecar.Name, errs)
+		}
+		if names[sidecar.Name] {
+			return fmt.Errorf("contêiner %s declarado mais de uma vez", sidecar.Name)
+		}
+		names[sidecar.Name] = true
+
+		for _, port := range sidecar.Ports {
+			if port.ContainerPort <= 0 || port.ContainerPort > 65535 {
+				return fmt.Errorf("porta inválida no sidecar %s: %d", sidecar.Name, port.ContainerPort)
+			}
+			if port.Protocol != "" && port.Protocol != "TCP" && port.Protocol != "UDP" {
+				return fmt.Errorf("protocolo inválido no sidecar %s: %s", sidecar.Name, port.Protocol)
+			}
+		}
+		if sidecar.Readiness != nil && len(sidecar.Readiness.Command) == 0 && sidecar.Readiness.TCPPort == 0 {
+			return fmt.Errorf("readiness do sidecar %s requer command ou tcpPort", sidecar.Name)
+		}
+		if err := sidecar.Security.validate(); err != nil {
+			return fmt.Errorf("segurança do sidecar %s: %v", sidecar.Name, err)
+		}
+		if sidecar.Security != nil && sidecar.Security.RuntimeClassName != "" {
+			return fmt.Errorf("runtimeClassName vale para o pod inteiro e não pode ser declarado no sidecar %s", sidecar.Name)
+		}
+	}
+	return nil
+}
+
+// hasContainer verifica se o template define um contêiner com o nome informado
+func (t *LabTemplate) hasContainer(name string) bool {
+	if name == "" || name == labContainerName {
+		return true
+	}
+	for _, sidecar := range t.Sidecars {
+		if sidecar.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// container converte o sidecar em um contêiner do pod
+func (s SidecarContainer) container() (v1.Container, error) {
+	securityContext, err := containerSecurityContext(s.Name, s.Security, false)
+	if err != nil {
+		return v1.Container{}, err
+	}
+
+	container := v1.Container{
+		Name:            s.Name,
+		Image:           s.Image,
+		Command:         s.Command,
+		Args:            s.Args,
+		ReadinessProbe:  probeFromReadiness(s.Readiness),
+		SecurityContext: securityContext,
+	}
+
+	// Ordenar as variáveis para manter a especificação do pod estável
+	keys := make([]string, 0, len(s.Env))
+	for key := range s.Env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		container.Env = append(container.Env, v1.EnvVar{Name: key, Value: s.Env[key]})
+	}
+
+	for _, port := range s.Ports {
+		protocol := v1.ProtocolTCP
+		if port.Protocol != "" {
+			protocol = v1.Protocol(port.Protocol)
+		}
+		container.Ports = append(container.Ports, v1.ContainerPort{
+			Name:          port.Name,
+			ContainerPort: port.ContainerPort,
+			Protocol:      protocol,
+		})
+	}
+	return container, nil
+}
+
+// sidecarContainers converte os sidecars do template em contêineres do pod
+func sidecarContainers(template *LabTemplate) ([]v1.Container, error) {
+	containers := make([]v1.Container, 0, len(template.Sidecars))
+	for _, sidecar := range template.Sidecars {
+		container, err := sidecar.container()
+		if err != nil {
+			return nil, err
+		}
+		containers = append(containers, container)
+	}
+	return containers, nil
+}
+
+// findContainerStatus retorna o estado de um contêiner do pod pelo nome
+func findContainerStatus(pod *v1.Pod, name string) (v1.ContainerStatus, bool) {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == name {
+			return status, true
+		}
+	}
+	return v1.ContainerStatus{}, false
+}
+
+// sidecarStatuses resume o estado de todos os contêineres do pod exceto o do laboratório
+func sidecarStatuses(pod *v1.Pod) []SidecarStatus {
+	statuses := []SidecarStatus{}
+	for _, container := range pod.Spec.Containers {
+		if container.Name == labContainerName {
+			continue
+		}
+
+		sidecar := SidecarStatus{
+			Name:  container.Name,
+			Image: container.Image,
+			State: "Waiting",
+			Ports: container.Ports,
+		}
+		if status, ok := findContainerStatus(pod, container.Name); ok {
+			sidecar.Ready = status.Ready
+			sidecar.RestartCount = status.RestartCount
+			switch {
+			case status.State.Running != nil:
+				sidecar.State = "Running"
+			case status.State.Terminated != nil:
+				sidecar.State = "Terminated"
+				sidecar.Reason = status.State.Terminated.Reason
+			case status.State.Waiting != nil:
+				sidecar.Reason = status.State.Waiting.Reason
+			}
+		}
+		statuses = append(statuses, sidecar)
+	}
+	return statuses
+}
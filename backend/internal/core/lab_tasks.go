@@ -0,0 +1,76 @@
+package core
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// validatedTasksAnnotation registra no namespace as tarefas já validadas do
+// laboratório; por ficar no namespace, o histórico sobrevive à troca do pod
+const validatedTasksAnnotation = "girus.io/validated-tasks"
+
+// ValidatedTask é uma tarefa concluída com sucesso pelo aluno
+type ValidatedTask struct {
+	Template    string `json:"templateId"`
+	Index       int    `json:"taskIndex"`
+	Name        string `json:"name,omitempty"`
+	ValidatedAt string `json:"validatedAt"`
+}
+
+// ValidatedTasks retorna o histórico de tarefas validadas do laboratório
+func (lm *LabManager) ValidatedTasks(labID string) []ValidatedTask {
+	namespace, err := lm.getNamespace(labID)
+	if err != nil {
+		return []ValidatedTask{}
+	}
+	return validatedTasks(namespace)
+}
+
+// validatedTasks interpreta o histórico registrado no namespace
+func validatedTasks(namespace *v1.Namespace) []ValidatedTask {
+	tasks := []ValidatedTask{}
+	if value := namespace.Annotations[validatedTasksAnnotation]; value != "" {
+		if err := json.Unmarshal([]byte(value), &tasks); err != nil {
+			log.Printf("Histórico de tarefas inválido no namespace %s: %v", namespace.Name, err)
+			return []ValidatedTask{}
+		}
+	}
+	return tasks
+}
+
+// recordValidatedTask acrescenta a tarefa ao histórico do laboratório, se ainda não estiver nele
+func (lm *LabManager) recordValidatedTask(labID, templateName string, index int, name string) error {
+	var marshalErr error
+	err := lm.updateNamespace(labID, func(namespace *v1.Namespace) bool {
+		tasks := validatedTasks(namespace)
+		for _, task := range tasks {
+			if task.Template == templateName && task.Index == index {
+				return false
+			}
+		}
+		tasks = append(tasks, ValidatedTask{
+			Template:    templateName,
+			Index:       index,
+			Name:        name,
+			ValidatedAt: time.Now().Format(time.RFC3339),
+		})
+		data, err := json.Marshal(tasks)
+		if err != nil {
+			marshalErr = err
+			return false
+		}
+
+		if namespace.Annotations == nil {
+			namespace.Annotations = map[string]string{}
+		}
+		namespace.Annotations[validatedTasksAnnotation] = string(data)
+		return true
+	})
+	if marshalErr != nil {
+		return marshalErr
+	}
+	return err
+}
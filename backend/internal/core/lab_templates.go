@@ -3,8 +3,13 @@ package core
 import (
 	"fmt"
 	"log"
+	"os"
+	"path"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
+	"sync"
 
 	"gopkg.in/yaml.v2"
 	v1 "k8s.io/api/core/v1"
@@ -24,11 +29,30 @@ type LabTemplate struct {
 	Image       string         `json:"image" yaml:"image"`
 	TimerEnabled bool          `json:"timerEnabled" yaml:"timerEnabled"`
 	MaxDuration  string        `json:"maxDuration" yaml:"maxDuration"` // Formato: "30m", "2h", etc.
+	Runtime      *LabRuntime   `json:"runtime,omitempty" yaml:"runtime"`
+	Sidecars     []SidecarContainer `json:"sidecars,omitempty" yaml:"sidecars"`
+	Resources    *ResourceConfig    `json:"resources,omitempty" yaml:"resources"`
+	Security     *SecuritySettings  `json:"security,omitempty" yaml:"security"`
+	Workspace    *WorkspaceSettings `json:"workspace,omitempty" yaml:"workspace"`
+	Snapshot     *SnapshotSettings  `json:"snapshot,omitempty" yaml:"snapshot"`
+	Extensions   *ExtensionSettings `json:"extensions,omitempty" yaml:"extensions"`
+	Setup        []SetupStep        `json:"setup,omitempty" yaml:"setup"`
+	Network      *NetworkSettings   `json:"network,omitempty" yaml:"network"`
+	Quota        *QuotaConfig       `json:"quota,omitempty" yaml:"quota"` // Sobrescreve a cota padrão do namespace
+
+	KubernetesAccess *KubeAccessSettings `json:"kubernetesAccess,omitempty" yaml:"kubernetesAccess"`
+	Expose           []ExposedPort       `json:"expose,omitempty" yaml:"expose"` // Portas acessíveis pelo proxy HTTP
+	Scheduling       *SchedulingSettings `json:"scheduling,omitempty" yaml:"scheduling"`
 }
 
-// TemplateFile define um arquivo de conteúdo do template
+// TemplateFile define um arquivo entregue no sistema de arquivos do laboratório
 type TemplateFile struct {
-	Path string `json:"path" yaml:"path"`
+	Path      string `json:"path" yaml:"path"`                     // Caminho absoluto de destino no contêiner
+	Content   string `json:"content,omitempty" yaml:"content"`     // Conteúdo do arquivo
+	Encoding  string `json:"encoding,omitempty" yaml:"encoding"`   // "base64" para conteúdo binário
+	Mode      string `json:"mode,omitempty" yaml:"mode"`           // Permissões em octal (padrão: 0644)
+	Owner     string `json:"owner,omitempty" yaml:"owner"`         // Dono no formato usuário[:grupo]
+	Container string `json:"container,omitempty" yaml:"container"` // Contêiner de destino (padrão: lab)
 }
 
 // Task define uma tarefa dentro do laboratório
@@ -52,66 +76,270 @@ type Validator struct {
 	Command        string `json:"command" yaml:"command"`
 	ExpectedOutput string `json:"expectedOutput" yaml:"expectedOutput"`
 	ErrorMessage   string `json:"errorMessage" yaml:"errorMessage"`
+	Container      string `json:"container,omitempty" yaml:"container"` // Contêiner onde o comando é executado (padrão: lab)
 }
 
+// CommandExecutor executa um comando em um contêiner do pod e retorna stdout e stderr
+type CommandExecutor func(pod *v1.Pod, container string, command []string) (string, string, error)
+
 // TemplateManager gerencia os templates de laboratório
 type TemplateManager struct {
-	templates map[string]*LabTemplate
+	mu          sync.RWMutex
+	templates   map[string]*LabTemplate
+	sources     map[string][]byte // Conteúdo carregado, por origem, para detectar mudanças
+	subscribers []func()
+	executor    CommandExecutor
 }
 
 // NewTemplateManager cria um novo gerenciador de templates
 func NewTemplateManager() *TemplateManager {
 	return &TemplateManager{
 		templates: make(map[string]*LabTemplate),
+		sources:   make(map[string][]byte),
 	}
 }
 
 // LoadTemplates carrega templates do ConfigMap
 func (tm *TemplateManager) LoadTemplates(clientset kubernetes.Interface) error {
-	// Buscar ConfigMaps com label app=girus-lab-template
+	sources, err := configMapTemplateSources(clientset)
+	if err != nil {
+		return err
+	}
+	tm.addSources(sources)
+
+	log.Printf("Carregados %d templates de laboratório", len(tm.ListTemplates()))
+	return nil
+}
+
+// configMapTemplateSources lê os templates dos ConfigMaps com label app=girus-lab-template
+func configMapTemplateSources(clientset kubernetes.Interface) (map[string][]byte, error) {
 	ctx, cancel := contextWithTimeout()
 	defer cancel()
 	configMaps, err := clientset.CoreV1().ConfigMaps("girus").List(ctx, metav1.ListOptions{
 		LabelSelector: "app=girus-lab-template",
 	})
 	if err != nil {
-		return fmt.Errorf("erro ao buscar templates de laboratório: %v", err)
+		return nil, fmt.Errorf("erro ao buscar templates de laboratório: %v", err)
 	}
 
+	sources := map[string][]byte{}
 	for _, cm := range configMaps.Items {
 		for key, content := range cm.Data {
 			if filepath.Ext(key) == ".yaml" || filepath.Ext(key) == ".yml" {
-				template := &LabTemplate{}
-				if err := yaml.Unmarshal([]byte(content), template); err != nil {
-					log.Printf("Erro ao desserializar template %s: %v", key, err)
-					continue
-				}
-				
-				// Log detalhado para depuração
-				log.Printf("Template carregado: %s (%s) com %d tarefas", template.Name, template.Title, len(template.Tasks))
-				for i, task := range template.Tasks {
-					log.Printf("Tarefa %d: %s - Tips: %d", i, task.Name, len(task.Tips))
-					for j, tip := range task.Tips {
-						log.Printf("  Tip %d: %s (tipo: %s)", j, tip.Title, tip.Type)
-					}
-				}
-				
-				tm.templates[template.Name] = template
+				sources["configmap/"+cm.Name+"/"+key] = []byte(content)
 			}
 		}
 	}
+	return sources, nil
+}
+
+// LoadTemplatesFromDir carrega templates de arquivos YAML em um diretório local.
+// Um diretório inexistente não é considerado erro.
+func (tm *TemplateManager) LoadTemplatesFromDir(dir string) error {
+	if dir == "" {
+		return nil
+	}
+	sources, err := dirTemplateSources(dir)
+	if err != nil {
+		return err
+	}
+	tm.addSources(sources)
 
-	log.Printf("Carregados %d templates de laboratório", len(tm.templates))
+	log.Printf("Carregados %d templates de laboratório (incluindo %s)", len(tm.ListTemplates()), dir)
+	return nil
+}
+
+// dirTemplateSources lê os arquivos YAML de um diretório de templates
+func dirTemplateSources(dir string) (map[string][]byte, error) {
+	sources := map[string][]byte{}
+	if dir == "" {
+		return sources, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return sources, nil
+		}
+		return nil, fmt.Errorf("erro ao ler diretório de templates: %v", err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || (filepath.Ext(entry.Name()) != ".yaml" && filepath.Ext(entry.Name()) != ".yml") {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			log.Printf("Erro ao ler template %s: %v", entry.Name(), err)
+			continue
+		}
+		sources["dir/"+entry.Name()] = content
+	}
+	return sources, nil
+}
+
+// addSources registra os templates lidos de uma origem, em ordem estável
+func (tm *TemplateManager) addSources(sources map[string][]byte) {
+	keys := make([]string, 0, len(sources))
+	for key := range sources {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		tm.mu.Lock()
+		tm.sources[key] = sources[key]
+		tm.mu.Unlock()
+		tm.addTemplate(path.Base(key), sources[key])
+	}
+}
+
+// Reload relê os templates dos ConfigMaps e do diretório e, se algo mudou,
+// substitui os templates carregados e avisa os inscritos. Um erro de leitura
+// mantém os templates atuais.
+func (tm *TemplateManager) Reload(clientset kubernetes.Interface, dir string) (bool, error) {
+	sources, err := configMapTemplateSources(clientset)
+	if err != nil {
+		return false, err
+	}
+	dirSources, err := dirTemplateSources(dir)
+	if err != nil {
+		return false, err
+	}
+	for key, content := range dirSources {
+		sources[key] = content
+	}
+
+	tm.mu.RLock()
+	unchanged := reflect.DeepEqual(sources, tm.sources)
+	tm.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	fresh := NewTemplateManager()
+	fresh.addSources(sources)
+
+	tm.mu.Lock()
+	tm.templates = fresh.templates
+	tm.sources = fresh.sources
+	subscribers := append([]func(){}, tm.subscribers...)
+	tm.mu.Unlock()
+
+	log.Printf("Templates de laboratório recarregados: %d templates", len(fresh.templates))
+	for _, notify := range subscribers {
+		notify()
+	}
+	return true, nil
+}
+
+// Subscribe registra uma função chamada sempre que os templates mudam
+func (tm *TemplateManager) Subscribe(notify func()) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.subscribers = append(tm.subscribers, notify)
+}
+
+// addTemplate desserializa, valida e registra um template
+func (tm *TemplateManager) addTemplate(key string, content []byte) {
+	template := &LabTemplate{}
+	if err := yaml.Unmarshal(content, template); err != nil {
+		log.Printf("Erro ao desserializar template %s: %v", key, err)
+		return
+	}
+	if err := validateTemplate(template); err != nil {
+		log.Printf("Template %s inválido, ignorando: %v", key, err)
+		return
+	}
+	if template.Runtime == nil {
+		log.Printf("Aviso: template %s não declara runtime; usando o perfil %s detectado pelo nome. "+
+			"A detecção pelo nome está obsoleta, declare runtime.profile no template", template.Name, legacyRuntimeProfile(template.Name))
+	}
+
+	// Log detalhado para depuração
+	log.Printf("Template carregado: %s (%s) com %d tarefas", template.Name, template.Title, len(template.Tasks))
+	for i, task := range template.Tasks {
+		log.Printf("Tarefa %d: %s - Tips: %d", i, task.Name, len(task.Tips))
+		for j, tip := range task.Tips {
+			log.Printf("  Tip %d: %s (tipo: %s)", j, tip.Title, tip.Type)
+		}
+	}
+
+	tm.mu.Lock()
+	tm.templates[template.Name] = template
+	tm.mu.Unlock()
+}
+
+// validateTemplate verifica se um template pode ser usado para criar laboratórios
+func validateTemplate(template *LabTemplate) error {
+	if template.Name == "" {
+		return fmt.Errorf("template sem nome")
+	}
+	if _, err := ResolveRuntime(template); err != nil {
+		return fmt.Errorf("runtime inválido: %v", err)
+	}
+	if err := validateSidecars(template.Sidecars); err != nil {
+		return err
+	}
+	if template.Resources != nil {
+		if err := template.Resources.validate(); err != nil {
+			return fmt.Errorf("recursos inválidos: %v", err)
+		}
+	}
+	if err := template.Security.validate(); err != nil {
+		return fmt.Errorf("segurança inválida: %v", err)
+	}
+	if err := template.Workspace.validate(); err != nil {
+		return fmt.Errorf("workspace inválido: %v", err)
+	}
+	if err := template.Snapshot.validate(); err != nil {
+		return fmt.Errorf("snapshot inválido: %v", err)
+	}
+	if err := template.Extensions.validate(); err != nil {
+		return fmt.Errorf("extensões inválidas: %v", err)
+	}
+	if err := validateTemplateFiles(template); err != nil {
+		return err
+	}
+	if err := validateSetupSteps(template); err != nil {
+		return err
+	}
+	if err := template.Network.validate(); err != nil {
+		return fmt.Errorf("rede inválida: %v", err)
+	}
+	if template.Quota != nil {
+		if err := template.Quota.validate(); err != nil {
+			return fmt.Errorf("cota inválida: %v", err)
+		}
+	}
+	if err := template.KubernetesAccess.validate(); err != nil {
+		return fmt.Errorf("acesso ao Kubernetes inválido: %v", err)
+	}
+	if err := validateExposedPorts(template); err != nil {
+		return err
+	}
+	if err := template.Scheduling.validate(); err != nil {
+		return fmt.Errorf("agendamento inválido: %v", err)
+	}
+	for _, task := range template.Tasks {
+		for _, validator := range task.Validation {
+			if !template.hasContainer(validator.Container) {
+				return fmt.Errorf("validação da tarefa %s usa contêiner inexistente: %s", task.Name, validator.Container)
+			}
+		}
+	}
 	return nil
 }
 
 // GetTemplate retorna um template pelo nome
 func (tm *TemplateManager) GetTemplate(name string) *LabTemplate {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
 	return tm.templates[name]
 }
 
 // ListTemplates retorna a lista de templates disponíveis
 func (tm *TemplateManager) ListTemplates() []*LabTemplate {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
 	templates := make([]*LabTemplate, 0, len(tm.templates))
 	for _, tpl := range tm.templates {
 		templates = append(templates, tpl)
@@ -124,7 +352,14 @@ func (tm *TemplateManager) ValidateTaskCompletion(pod *v1.Pod, task Task) (bool,
 	for _, validator := range task.Validation {
 		// Executar comando de validação no pod
 		command := []string{"/bin/sh", "-c", validator.Command}
-		stdout, stderr, err := ExecuteCommandInPod(pod, command)
+		if tm.executor == nil {
+			return false, "Execução de comandos não configurada para validação"
+		}
+		container := validator.Container
+		if container == "" {
+			container = labContainerName
+		}
+		stdout, stderr, err := tm.executor(pod, container, command)
 
 		if err != nil {
 			return false, fmt.Sprintf("Erro ao validar a task! Veja se você concluiu o que foi pedido para a task.")
@@ -0,0 +1,290 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/utils/pointer"
+)
+
+// LocalBackend mantém os objetos do laboratório em memória e executa os comandos
+// como processos locais, permitindo rodar o servidor sem um cluster Kubernetes.
+// Cada laboratório recebe um diretório de trabalho próprio, exportado para os
+// comandos através das variáveis HOME e GIRUS_LAB_ROOT.
+type LocalBackend struct {
+	clientset *fake.Clientset
+	dynamic   *dynamicfake.FakeDynamicClient
+	rootDir   string
+	mu        sync.Mutex
+	workDirs  map[string]string
+}
+
+// NewLocalBackend cria um backend local usando rootDir para os diretórios dos laboratórios
+func NewLocalBackend(rootDir string) (*LocalBackend, error) {
+	if rootDir == "" {
+		rootDir = filepath.Join(os.TempDir(), "girus-labs")
+	}
+	if err := os.MkdirAll(rootDir, 0755); err != nil {
+		return nil, fmt.Errorf("erro ao criar diretório dos laboratórios locais: %v", err)
+	}
+	log.Printf("Usando backend local de laboratórios em %s", rootDir)
+
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "*", stampCreatedObject(clientset.Tracker()))
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		girusLabResource: "GirusLabList",
+	})
+	dynamicClient.PrependReactor("create", "*", stampCreatedObject(dynamicClient.Tracker()))
+
+	return &LocalBackend{
+		clientset: clientset,
+		dynamic:   dynamicClient,
+		rootDir:   rootDir,
+		workDirs:  make(map[string]string),
+	}, nil
+}
+
+// stampCreatedObject grava os objetos criados com os metadados que o API server
+// atribuiria (nome gerado, UID e data de criação), dos quais dependem a ordenação
+// dos laboratórios e a expiração de workspaces. O objeto recebido não é alterado.
+func stampCreatedObject(tracker k8stesting.ObjectTracker) k8stesting.ReactionFunc {
+	return func(action k8stesting.Action) (bool, runtime.Object, error) {
+		create, ok := action.(k8stesting.CreateAction)
+		if !ok || create.GetSubresource() != "" {
+			return false, nil, nil
+		}
+		created := create.GetObject().DeepCopyObject()
+		object, err := meta.Accessor(created)
+		if err != nil {
+			return false, nil, nil
+		}
+		if object.GetName() == "" && object.GetGenerateName() != "" {
+			object.SetName(object.GetGenerateName() + rand.String(5))
+		}
+		if object.GetUID() == "" {
+			object.SetUID(uuid.NewUUID())
+		}
+		if object.GetCreationTimestamp().Time.IsZero() {
+			object.SetCreationTimestamp(metav1.Now())
+		}
+		if err := tracker.Create(create.GetResource(), created, create.GetNamespace()); err != nil {
+			return true, nil, err
+		}
+		return true, created, nil
+	}
+}
+
+// Name retorna o identificador do backend
+func (b *LocalBackend) Name() string {
+	return "local"
+}
+
+// Clientset retorna o armazenamento em memória dos objetos do laboratório
+func (b *LocalBackend) Clientset() kubernetes.Interface {
+	return b.clientset
+}
+
+// DynamicClient retorna o armazenamento em memória dos recursos GirusLab
+func (b *LocalBackend) DynamicClient() (dynamic.Interface, error) {
+	return b.dynamic, nil
+}
+
+// CreateLab registra o pod em memória, prepara seu diretório e o marca como pronto
+func (b *LocalBackend) CreateLab(ctx context.Context, pod *v1.Pod) (*v1.Pod, error) {
+	created, err := b.clientset.CoreV1().Pods(pod.Namespace).Create(ctx, pod, metav1.CreateOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	workDir := filepath.Join(b.rootDir, created.Namespace, created.Name)
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		return nil, fmt.Errorf("erro ao criar diretório do laboratório: %v", err)
+	}
+	b.mu.Lock()
+	b.workDirs[created.Namespace+"/"+created.Name] = workDir
+	b.mu.Unlock()
+
+	// Não há agendamento nem download de imagens: o laboratório fica pronto imediatamente
+	now := metav1.Now()
+	created.Status = v1.PodStatus{
+		Phase:     v1.PodRunning,
+		PodIP:     "127.0.0.1",
+		StartTime: &now,
+		Conditions: []v1.PodCondition{
+			{Type: v1.PodScheduled, Status: v1.ConditionTrue, LastTransitionTime: now},
+			{Type: v1.PodReady, Status: v1.ConditionTrue, LastTransitionTime: now},
+		},
+	}
+	for _, container := range created.Spec.Containers {
+		created.Status.ContainerStatuses = append(created.Status.ContainerStatuses, v1.ContainerStatus{
+			Name:    container.Name,
+			Image:   container.Image,
+			Ready:   true,
+			Started: pointer.Bool(true),
+			State: v1.ContainerState{
+				Running: &v1.ContainerStateRunning{StartedAt: now},
+			},
+		})
+	}
+	return b.clientset.CoreV1().Pods(created.Namespace).UpdateStatus(ctx, created, metav1.UpdateOptions{})
+}
+
+// GetLab obtém o pod registrado em memória
+func (b *LocalBackend) GetLab(ctx context.Context, namespace, name string) (*v1.Pod, error) {
+	return b.clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+// ListLabs lista os pods registrados em memória
+func (b *LocalBackend) ListLabs(ctx context.Context, namespace string, opts metav1.ListOptions) ([]v1.Pod, error) {
+	podList, err := b.clientset.CoreV1().Pods(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return podList.Items, nil
+}
+
+// DeleteLab remove o pod da memória e apaga o diretório do laboratório
+func (b *LocalBackend) DeleteLab(ctx context.Context, namespace, name string, opts metav1.DeleteOptions) error {
+	if err := b.clientset.CoreV1().Pods(namespace).Delete(ctx, name, opts); err != nil {
+		return err
+	}
+
+	key := namespace + "/" + name
+	b.mu.Lock()
+	workDir, ok := b.workDirs[key]
+	delete(b.workDirs, key)
+	b.mu.Unlock()
+	if ok {
+		if err := os.RemoveAll(workDir); err != nil {
+			log.Printf("Erro ao remover diretório do laboratório %s: %v", workDir, err)
+		}
+	}
+	return nil
+}
+
+// Exec executa o comando como um processo local no diretório do laboratório
+func (b *LocalBackend) Exec(ctx context.Context, pod *v1.Pod, opts ExecOptions) error {
+	cmd, err := b.command(ctx, pod, opts.Container, opts.Command)
+	if err != nil {
+		return err
+	}
+	cmd.Stdin = opts.Stdin
+	cmd.Stdout = opts.Stdout
+	cmd.Stderr = opts.Stderr
+	return cmd.Run()
+}
+
+// AttachTerminal abre uma sessão interativa local. Quando o utilitário "script"
+// está disponível ele é usado para alocar um pseudo-terminal; caso contrário a
+// sessão usa pipes e converte as quebras de linha para o terminal web.
+func (b *LocalBackend) AttachTerminal(ctx context.Context, pod *v1.Pod, opts ExecOptions) error {
+	command := opts.Command
+	if scriptPath, err := exec.LookPath("script"); err == nil {
+		command = []string{scriptPath, "-qfec", strings.Join(opts.Command, " "), "/dev/null"}
+	} else {
+		if len(command) == 1 {
+			command = append(command, "-i")
+		}
+		opts.Stdin = &crlfReader{reader: opts.Stdin}
+		opts.Stdout = &crlfWriter{writer: opts.Stdout}
+		if opts.Stderr != nil {
+			opts.Stderr = &crlfWriter{writer: opts.Stderr}
+		}
+	}
+
+	cmd, err := b.command(ctx, pod, opts.Container, command)
+	if err != nil {
+		return err
+	}
+	cmd.Stdin = opts.Stdin
+	cmd.Stdout = opts.Stdout
+	cmd.Stderr = opts.Stdout
+	if opts.Stderr != nil {
+		cmd.Stderr = opts.Stderr
+	}
+	return cmd.Run()
+}
+
+// command prepara um processo local com o ambiente do contêiner informado.
+// Todos os contêineres do pod compartilham o mesmo diretório do laboratório.
+func (b *LocalBackend) command(ctx context.Context, pod *v1.Pod, container string, command []string) (*exec.Cmd, error) {
+	if len(command) == 0 {
+		return nil, fmt.Errorf("comando vazio")
+	}
+
+	b.mu.Lock()
+	workDir, ok := b.workDirs[pod.Namespace+"/"+pod.Name]
+	b.mu.Unlock()
+	if !ok {
+		return nil, errors.NewNotFound(v1.Resource("pods"), pod.Name)
+	}
+
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Dir = workDir
+	// O processo não herda o ambiente do backend, que guarda credenciais e configuração
+	path := os.Getenv("PATH")
+	if path == "" {
+		path = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+	}
+	cmd.Env = []string{"PATH=" + path, "HOME=" + workDir, "GIRUS_LAB_ROOT=" + workDir, "TERM=xterm-256color"}
+	if container == "" {
+		container = labContainerName
+	}
+	for _, podContainer := range pod.Spec.Containers {
+		if podContainer.Name != container {
+			continue
+		}
+		for _, envVar := range podContainer.Env {
+			cmd.Env = append(cmd.Env, envVar.Name+"="+envVar.Value)
+		}
+	}
+	return cmd, nil
+}
+
+// crlfWriter converte "\n" em "\r\n" para exibição correta no terminal web
+type crlfWriter struct {
+	writer io.Writer
+}
+
+func (w *crlfWriter) Write(p []byte) (int, error) {
+	converted := strings.ReplaceAll(string(p), "\n", "\r\n")
+	if _, err := w.writer.Write([]byte(converted)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// crlfReader converte o Enter do terminal web ("\r") em quebra de linha
+type crlfReader struct {
+	reader io.Reader
+}
+
+func (r *crlfReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	for i := 0; i < n; i++ {
+		if p[i] == '\r' {
+			p[i] = '\n'
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,33 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLocalBackendCommandEnvironment(t *testing.T) {
+	t.Setenv("GIRUS_TEST_SECRET", "segredo")
+	lm := newTestLabManager(t, []testLab{{"lab-u1", "u1", "linux", ""}})
+	pod, err := lm.getLabPod("lab-u1", "lab-u1-pod")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr, err := lm.ExecuteCommandInPod(pod, []string{"/bin/sh", "-c", `echo "$GIRUS_TEST_SECRET|$HOME|$GIRUS_LAB_ROOT|$TERM"`})
+	if err != nil {
+		t.Fatalf("erro ao executar comando: %v (%s)", err, stderr)
+	}
+	fields := strings.Split(strings.TrimSpace(stdout), "|")
+	if len(fields) != 4 {
+		t.Fatalf("saída inesperada: %q", stdout)
+	}
+	if fields[0] != "" {
+		t.Errorf("variável do backend visível no laboratório: %q", fields[0])
+	}
+	if fields[1] == "" || fields[1] != fields[2] {
+		t.Errorf("HOME = %q, GIRUS_LAB_ROOT = %q, esperado o diretório do laboratório", fields[1], fields[2])
+	}
+	if fields[3] == "" {
+		t.Error("TERM não definido")
+	}
+}
@@ -0,0 +1,537 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Fases publicadas durante a criação de um laboratório
+const (
+	PhaseAccepted        = "accepted"
+	PhaseNamespaceReady  = "namespace-ready"
+	PhaseFilesCreated    = "files-created"
+	PhasePodScheduled    = "pod-scheduled"
+	PhaseImagePulling    = "image-pulling"
+	PhaseContainersReady = "containers-ready"
+	PhaseSetupRunning    = "setup-running"
+	PhaseSetupDone       = "setup-done"
+	PhaseReused          = "reused"
+	PhaseReady           = "ready"
+	PhaseFailed          = "failed"
+)
+
+const (
+	OperationRunning   = "running"
+	OperationSucceeded = "succeeded"
+	OperationFailed    = "failed"
+
+	// operationRetention é por quanto tempo uma operação concluída continua consultável
+	operationRetention = time.Hour
+	// operationTimeout limita o acompanhamento do pod até o laboratório ficar pronto
+	operationTimeout = 15 * time.Minute
+)
+
+// Motivos de espera de contêiner que não se resolvem sem intervenção
+var fatalWaitingReasons = map[string]bool{
+	"ErrImagePull":               true,
+	"ImagePullBackOff":           true,
+	"InvalidImageName":           true,
+	"CrashLoopBackOff":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+}
+
+var operationResource = schema.GroupResource{Group: "girus.io", Resource: "operations"}
+
+// ProgressFunc recebe as fases da criação de um laboratório; pode ser nil
+type ProgressFunc func(phase, message string)
+
+// report publica uma fase quando há quem a acompanhe
+func (p ProgressFunc) report(phase, message string) {
+	if p != nil {
+		p(phase, message)
+	}
+}
+
+// OperationEvent é uma fase publicada por uma operação
+type OperationEvent struct {
+	Phase    string `json:"phase"`
+	Message  string `json:"message,omitempty"`
+	Progress int    `json:"progress,omitempty"` // Percentual, quando a fase o informa
+	Time     string `json:"time"`
+}
+
+// Operation acompanha uma criação de laboratório em segundo plano
+type Operation struct {
+	ID         string           `json:"id"`
+	Type       string           `json:"type"`
+	UserID     string           `json:"userId"`
+	TemplateID string           `json:"templateId"`
+	LabID      string           `json:"labId,omitempty"`
+	PodName    string           `json:"podName,omitempty"`
+	Phase      string           `json:"phase"`
+	Status     string           `json:"status"`
+	Error      string           `json:"error,omitempty"`
+	Queue      *QueueStatus     `json:"queue,omitempty"`  // Presente enquanto a criação aguarda vaga
+	Reused     bool             `json:"reused,omitempty"` // O usuário já tinha um laboratório do template
+	Events     []OperationEvent `json:"events"`
+	CreatedAt  string           `json:"createdAt"`
+	UpdatedAt  string           `json:"updatedAt"`
+
+	finishedAt time.Time
+}
+
+// done indica se a operação terminou, com sucesso ou falha
+func (o *Operation) done() bool {
+	return o.Status != OperationRunning
+}
+
+// copy retorna uma cópia da operação que pode ser lida fora do lock
+func (o *Operation) copy() *Operation {
+	c := *o
+	c.Events = append([]OperationEvent(nil), o.Events...)
+	return &c
+}
+
+// OperationTracker guarda em memória as operações e entrega seus eventos aos assinantes
+type OperationTracker struct {
+	mu          sync.Mutex
+	operations  map[string]*Operation
+	subscribers map[string]map[chan OperationEvent]struct{}
+	keys        map[string]string // Idempotency-Key (por usuário) -> ID da operação
+}
+
+// NewOperationTracker cria um registro de operações vazio
+func NewOperationTracker() *OperationTracker {
+	return &OperationTracker{
+		operations:  make(map[string]*Operation),
+		subscribers: make(map[string]map[chan OperationEvent]struct{}),
+		keys:        make(map[string]string),
+	}
+}
+
+// Create registra uma nova operação em andamento
+func (t *OperationTracker) Create(kind, userID, templateID string) *Operation {
+	operation, _ := t.CreateOnce(kind, userID, templateID, "")
+	return operation
+}
+
+// CreateOnce registra uma nova operação, a menos que o usuário já tenha uma do
+// mesmo tipo em andamento ou uma criada com a mesma chave de idempotência que
+// não falhou. Nesses casos a operação existente é retornada e created é false.
+func (t *OperationTracker) CreateOnce(kind, userID, templateID, key string) (operation *Operation, created bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id, existing := range t.operations {
+		if existing.done() && time.Since(existing.finishedAt) > operationRetention {
+			delete(t.operations, id)
+		}
+	}
+	for k, id := range t.keys {
+		if _, ok := t.operations[id]; !ok {
+			delete(t.keys, k)
+		}
+	}
+
+	keyID := userID + "/" + key
+	if key != "" {
+		if existing, ok := t.operations[t.keys[keyID]]; ok && existing.Status != OperationFailed {
+			return existing.copy(), false
+		}
+	}
+	for _, existing := range t.operations {
+		if existing.Type == kind && existing.UserID == userID && !existing.done() {
+			return existing.copy(), false
+		}
+	}
+
+	operation = t.newOperation(kind, userID, templateID)
+	if key != "" {
+		t.keys[keyID] = operation.ID
+	}
+	return operation.copy(), true
+}
+
+// Active indica se há uma operação em andamento para o usuário
+func (t *OperationTracker) Active(userID string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, operation := range t.operations {
+		if operation.UserID == userID && !operation.done() {
+			return true
+		}
+	}
+	return false
+}
+
+// newOperation registra a operação; exige o lock
+func (t *OperationTracker) newOperation(kind, userID, templateID string) *Operation {
+	suffix := make([]byte, 8)
+	rand.Read(suffix)
+	now := time.Now().Format(time.RFC3339)
+	operation := &Operation{
+		ID:         "op-" + hex.EncodeToString(suffix),
+		Type:       kind,
+		UserID:     userID,
+		TemplateID: templateID,
+		Status:     OperationRunning,
+		Events:     []OperationEvent{},
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	t.operations[operation.ID] = operation
+	return operation
+}
+
+// Get retorna uma cópia da operação
+func (t *OperationTracker) Get(id string) (*Operation, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	operation, ok := t.operations[id]
+	if !ok {
+		return nil, errors.NewNotFound(operationResource, id)
+	}
+	return operation.copy(), nil
+}
+
+// SetLab registra o laboratório criado pela operação
+func (t *OperationTracker) SetLab(id, namespace, podName string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if operation, ok := t.operations[id]; ok {
+		operation.LabID = namespace
+		operation.PodName = podName
+	}
+}
+
+// Reuse conclui a operação com um laboratório que o usuário já tinha
+func (t *OperationTracker) Reuse(id, namespace, podName string) {
+	t.mu.Lock()
+	if operation, ok := t.operations[id]; ok {
+		operation.LabID = namespace
+		operation.PodName = podName
+		operation.Reused = true
+		t.publishLocked(id, PhaseReused, fmt.Sprintf("Laboratório %s reaproveitado", podName), 0)
+	}
+	t.mu.Unlock()
+	t.Finish(id, nil)
+}
+
+// SetQueue registra a situação da operação na fila (nil ao sair dela)
+func (t *OperationTracker) SetQueue(id string, status *QueueStatus) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if operation, ok := t.operations[id]; ok {
+		operation.Queue = status
+	}
+}
+
+// Publish registra uma fase da operação e a entrega aos assinantes
+func (t *OperationTracker) Publish(id, phase, message string, progress int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.publishLocked(id, phase, message, progress)
+}
+
+func (t *OperationTracker) publishLocked(id, phase, message string, progress int) {
+	operation, ok := t.operations[id]
+	if !ok || operation.done() {
+		return
+	}
+	event := OperationEvent{
+		Phase:    phase,
+		Message:  message,
+		Progress: progress,
+		Time:     time.Now().Format(time.RFC3339),
+	}
+	operation.Events = append(operation.Events, event)
+	operation.Phase = phase
+	operation.UpdatedAt = event.Time
+
+	for ch := range t.subscribers[id] {
+		select {
+		case ch <- event:
+		default:
+			log.Printf("[Operações] Assinante lento da operação %s perdeu o evento %s", id, phase)
+		}
+	}
+}
+
+// Finish conclui a operação com sucesso (err nil) ou falha e encerra as assinaturas
+func (t *OperationTracker) Finish(id string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	operation, ok := t.operations[id]
+	if !ok || operation.done() {
+		return
+	}
+
+	if err != nil {
+		t.publishLocked(id, PhaseFailed, err.Error(), 0)
+		operation.Status = OperationFailed
+		operation.Error = err.Error()
+	} else {
+		t.publishLocked(id, PhaseReady, "Laboratório pronto", 100)
+		operation.Status = OperationSucceeded
+	}
+	operation.finishedAt = time.Now()
+
+	for ch := range t.subscribers[id] {
+		close(ch)
+	}
+	delete(t.subscribers, id)
+}
+
+// Subscribe retorna o estado atual da operação e um canal com os próximos
+// eventos, fechado quando a operação termina. cancel encerra a assinatura.
+func (t *OperationTracker) Subscribe(id string) (*Operation, <-chan OperationEvent, func(), error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	operation, ok := t.operations[id]
+	if !ok {
+		return nil, nil, nil, errors.NewNotFound(operationResource, id)
+	}
+
+	ch := make(chan OperationEvent, 64)
+	if operation.done() {
+		close(ch)
+		return operation.copy(), ch, func() {}, nil
+	}
+	if t.subscribers[id] == nil {
+		t.subscribers[id] = make(map[chan OperationEvent]struct{})
+	}
+	t.subscribers[id][ch] = struct{}{}
+
+	cancel := func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if _, ok := t.subscribers[id][ch]; ok {
+			delete(t.subscribers[id], ch)
+			close(ch)
+		}
+	}
+	return operation.copy(), ch, cancel, nil
+}
+
+// StartCreateLab inicia a criação do laboratório em segundo plano e retorna a
+// operação que acompanha suas fases até o laboratório ficar pronto. Com limites
+// de capacidade configurados, o pedido pode aguardar vaga na fila.
+func (lm *LabManager) StartCreateLab(request LabRequest) (*Operation, error) {
+	if lm.GetTemplate(request.Template) == nil {
+		return nil, errors.NewNotFound(schema.GroupResource{Group: "girus.io", Resource: "templates"}, request.Template)
+	}
+
+	// Cliques repetidos e novas tentativas recebem a operação já registrada
+	operation, created := lm.operations.CreateOnce("create-lab", request.UserID, request.Template, request.IdempotencyKey)
+	if !created {
+		if operation.TemplateID != request.Template {
+			return nil, errors.NewConflict(operationResource, operation.ID,
+				fmt.Errorf("já existe uma criação de laboratório do template %s para o usuário", operation.TemplateID))
+		}
+		log.Printf("[Operações] Pedido repetido do usuário %s reaproveita a operação %s", request.UserID, operation.ID)
+		return operation, nil
+	}
+	lm.operations.Publish(operation.ID, PhaseAccepted, "Criação do laboratório iniciada", 0)
+
+	// Um laboratório saudável do mesmo template é devolvido em vez de criar outro
+	existing, err := lm.existingLab(request.UserID, request.Template)
+	if err != nil {
+		lm.operations.Finish(operation.ID, err)
+		return nil, err
+	}
+	if existing != nil {
+		lm.operations.Reuse(operation.ID, existing.Namespace, existing.Name)
+		return lm.operations.Get(operation.ID)
+	}
+
+	if lm.capacity == nil {
+		go lm.runCreateLab(operation.ID, request)
+		return operation, nil
+	}
+	if err := lm.capacity.Submit(operation.ID, request); err != nil {
+		lm.operations.Finish(operation.ID, err)
+		return nil, err
+	}
+	return lm.operations.Get(operation.ID)
+}
+
+// runCreateLab cria o laboratório de uma operação e acompanha o pod até ficar pronto
+func (lm *LabManager) runCreateLab(operationID string, request LabRequest) {
+	lm.operations.SetQueue(operationID, nil)
+	progress := func(phase, message string) {
+		lm.operations.Publish(operationID, phase, message, 0)
+	}
+	pod, err := lm.createUserLab(request.UserID, request.Template, labCreateOptions{admitted: true}, progress)
+	if err == nil && request.Org != "" {
+		if labelErr := lm.setNamespaceLabel(pod.Namespace, orgLabel, request.Org); labelErr != nil {
+			log.Printf("[Operações] Erro ao registrar a organização do laboratório %s: %v", pod.Namespace, labelErr)
+		}
+	}
+	if lm.capacity != nil {
+		lm.capacity.release(operationID)
+	}
+	if err != nil {
+		log.Printf("[Operações] Falha na criação do laboratório (%s): %v", operationID, err)
+		lm.operations.Finish(operationID, err)
+		return
+	}
+	lm.operations.SetLab(operationID, pod.Namespace, pod.Name)
+	if lm.operator != nil {
+		lm.operator.Record(request.UserID, request.Template, pod)
+	}
+	lm.operations.Finish(operationID, lm.watchLabProgress(operationID, pod))
+}
+
+// CancelOperation retira da fila uma criação que ainda aguarda vaga
+func (lm *LabManager) CancelOperation(id string) error {
+	if _, err := lm.operations.Get(id); err != nil {
+		return err
+	}
+	if lm.capacity == nil || !lm.capacity.Cancel(id) {
+		return errors.NewConflict(operationResource, id, fmt.Errorf("a operação não está na fila"))
+	}
+	lm.operations.Finish(id, fmt.Errorf("pedido cancelado enquanto aguardava vaga"))
+	return nil
+}
+
+// GetCapacityStatus retorna a ocupação e a fila de laboratórios
+func (lm *LabManager) GetCapacityStatus() (*CapacityStatus, error) {
+	if lm.capacity == nil {
+		return nil, errors.NewNotFound(operationResource, "capacity")
+	}
+	return lm.capacity.Status()
+}
+
+// StartCapacityQueue inicia o processamento da fila, quando há limites configurados
+func (lm *LabManager) StartCapacityQueue(ctx context.Context) {
+	if lm.capacity != nil {
+		lm.capacity.Start(ctx)
+	}
+}
+
+// GetOperation retorna uma operação pelo ID
+func (lm *LabManager) GetOperation(id string) (*Operation, error) {
+	return lm.operations.Get(id)
+}
+
+// SubscribeOperation assina os eventos de uma operação
+func (lm *LabManager) SubscribeOperation(id string) (*Operation, <-chan OperationEvent, func(), error) {
+	return lm.operations.Subscribe(id)
+}
+
+// watchLabProgress acompanha o pod criado publicando agendamento, download das
+// imagens, prontidão dos contêineres e preparação, até o laboratório ficar pronto
+func (lm *LabManager) watchLabProgress(operationID string, pod *v1.Pod) error {
+	template := lm.GetTemplate(pod.Labels["template"])
+	scheduled, containersReady := false, false
+	seenEvents := map[string]bool{}
+	lastSetupMessage := ""
+	deadline := time.Now().Add(operationTimeout)
+
+	for {
+		current, err := lm.getLabPod(pod.Namespace, pod.Name)
+		if err != nil {
+			return fmt.Errorf("erro ao acompanhar o pod %s: %v", pod.Name, err)
+		}
+
+		if !scheduled && (current.Spec.NodeName != "" || current.Status.Phase == v1.PodRunning) {
+			scheduled = true
+			message := "Pod agendado"
+			if current.Spec.NodeName != "" {
+				message = fmt.Sprintf("Pod agendado no nó %s", current.Spec.NodeName)
+			}
+			lm.operations.Publish(operationID, PhasePodScheduled, message, 0)
+		}
+
+		if !containersReady {
+			lm.publishImagePulls(operationID, current, seenEvents)
+		}
+
+		if current.Status.Phase == v1.PodFailed {
+			return fmt.Errorf("o pod do laboratório falhou: %s", current.Status.Message)
+		}
+		for _, status := range append(current.Status.InitContainerStatuses, current.Status.ContainerStatuses...) {
+			if waiting := status.State.Waiting; waiting != nil && fatalWaitingReasons[waiting.Reason] {
+				return fmt.Errorf("contêiner %s: %s: %s", status.Name, waiting.Reason, waiting.Message)
+			}
+		}
+
+		if !containersReady && current.Status.Phase == v1.PodRunning && len(current.Status.ContainerStatuses) > 0 {
+			ready := true
+			for _, status := range current.Status.ContainerStatuses {
+				ready = ready && status.Ready
+			}
+			if ready {
+				containersReady = true
+				lm.operations.Publish(operationID, PhaseContainersReady, "Todos os contêineres estão prontos", 0)
+			}
+		}
+
+		if containersReady {
+			if template == nil || !needsPreparation(template) {
+				return nil
+			}
+			switch current.Annotations[prepareStatusAnnotation] {
+			case prepareStatusReady:
+				lm.operations.Publish(operationID, PhaseSetupDone, "Preparação do laboratório concluída", 0)
+				return nil
+			case prepareStatusFailed:
+				return fmt.Errorf("%s", current.Annotations[prepareMessageAnnotation])
+			default:
+				if message := current.Annotations[prepareMessageAnnotation]; message != "" && message != lastSetupMessage {
+					lastSetupMessage = message
+					lm.operations.Publish(operationID, PhaseSetupRunning, message, 0)
+				}
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timeout esperando o laboratório ficar pronto")
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// publishImagePulls publica os eventos de download de imagem do pod com o
+// progresso medido pela fração de imagens já baixadas
+func (lm *LabManager) publishImagePulls(operationID string, pod *v1.Pod, seen map[string]bool) {
+	events, err := lm.podEvents(pod.Namespace, pod.Name)
+	if err != nil {
+		return
+	}
+
+	total := len(pod.Spec.InitContainers) + len(pod.Spec.Containers)
+	pulled := 0
+	for _, event := range events {
+		if event.InvolvedObject.Name != pod.Name {
+			continue
+		}
+		if event.Reason == "Pulled" {
+			pulled++
+		}
+	}
+	for _, event := range events {
+		if event.InvolvedObject.Name != pod.Name || (event.Reason != "Pulling" && event.Reason != "Pulled") {
+			continue
+		}
+		key := string(event.UID) + event.Reason
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		progress := 0
+		if total > 0 {
+			progress = pulled * 100 / total
+		}
+		lm.operations.Publish(operationID, PhaseImagePulling, event.Message, progress)
+	}
+}
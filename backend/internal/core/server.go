@@ -4,9 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/http/httputil"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,8 +17,8 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/tools/remotecommand"
 	"k8s.io/utils/pointer"
 )
@@ -40,7 +43,7 @@ func NewServer(config *Config) *Server {
 		MaxAge:           12 * time.Hour,
 	}))
 
-	labManager, err := NewLabManager()
+	labManager, err := NewLabManagerFromConfig(config)
 	if err != nil {
 		log.Fatalf("Erro ao criar gerenciador de laboratórios: %v", err)
 	}
@@ -93,6 +96,27 @@ func setupRoutes(router *gin.Engine, server *Server) {
 		api.DELETE("/labs/current", func(c *gin.Context) {
 			server.DeleteCurrentLab(c)
 		})
+		api.POST("/labs/:id/pause", func(c *gin.Context) {
+			server.handlePauseLab(c)
+		})
+		api.POST("/labs/:id/resume", func(c *gin.Context) {
+			server.handleResumeLab(c)
+		})
+		api.POST("/labs/:id/extend", func(c *gin.Context) {
+			server.handleExtendLab(c)
+		})
+		api.POST("/labs/:id/reset", func(c *gin.Context) {
+			server.handleResetLab(c)
+		})
+		api.GET("/labs/:id/quota", func(c *gin.Context) {
+			server.handleLabQuota(c)
+		})
+		api.POST("/labs/:id/kubeconfig/rotate", func(c *gin.Context) {
+			server.handleRotateLabToken(c)
+		})
+		api.Any("/labs/:id/proxy/:port/*path", func(c *gin.Context) {
+			server.handleLabProxy(c)
+		})
 
 		// Template Routes
 		api.GET("/templates", func(c *gin.Context) {
@@ -111,6 +135,84 @@ func setupRoutes(router *gin.Engine, server *Server) {
 			c.JSON(200, template)
 		})
 
+		// Snapshots
+		api.GET("/users/:userId/snapshots", func(c *gin.Context) {
+			server.handleListSnapshots(c)
+		})
+		api.GET("/users/:userId/snapshots/:id/download", func(c *gin.Context) {
+			server.handleDownloadSnapshot(c)
+		})
+		api.POST("/users/:userId/snapshots/:id/restore", func(c *gin.Context) {
+			server.handleRestoreSnapshot(c)
+		})
+		api.DELETE("/users/:userId/snapshots/:id", func(c *gin.Context) {
+			server.handleDeleteSnapshot(c)
+		})
+
+		// Workspaces persistentes
+		api.GET("/users/:userId/workspaces", func(c *gin.Context) {
+			server.handleListWorkspaces(c)
+		})
+		api.DELETE("/users/:userId/workspaces/:name", func(c *gin.Context) {
+			server.handleDeleteWorkspace(c)
+		})
+
+		// Operações assíncronas
+		api.GET("/operations/:id", func(c *gin.Context) {
+			server.handleGetOperation(c)
+		})
+		api.GET("/operations/:id/events", func(c *gin.Context) {
+			server.handleOperationEvents(c)
+		})
+		api.DELETE("/operations/:id", func(c *gin.Context) {
+			server.handleCancelOperation(c)
+		})
+
+		// Capacidade e fila de laboratórios
+		api.GET("/capacity", func(c *gin.Context) {
+			status, err := server.labManager.GetCapacityStatus()
+			if err != nil {
+				if errors.IsNotFound(err) {
+					c.JSON(http.StatusNotFound, gin.H{"error": "Limites de capacidade não configurados"})
+					return
+				}
+				log.Printf("[API] Erro ao obter capacidade dos laboratórios: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao obter capacidade dos laboratórios"})
+				return
+			}
+			c.JSON(http.StatusOK, status)
+		})
+
+		// Coleta de recursos órfãos (restrita a instrutores)
+		api.GET("/admin/gc", func(c *gin.Context) {
+			server.handleGCReport(c)
+		})
+		api.POST("/admin/gc", func(c *gin.Context) {
+			server.handleRunGC(c)
+		})
+
+		// Warm pool
+		api.GET("/pool/stats", func(c *gin.Context) {
+			stats, err := server.labManager.GetPoolStats()
+			if err != nil {
+				log.Printf("[API] Erro ao obter estatísticas do warm pool: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao obter estatísticas do warm pool"})
+				return
+			}
+			c.JSON(http.StatusOK, stats)
+		})
+
+		// Pré-download de imagens
+		api.GET("/images/prepull", func(c *gin.Context) {
+			status, err := server.labManager.GetPrepullStatus()
+			if err != nil {
+				log.Printf("[API] Erro ao obter estado do pré-download de imagens: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao obter estado do pré-download de imagens"})
+				return
+			}
+			c.JSON(http.StatusOK, status)
+		})
+
 		// Agrupar rotas que usam namespace/pod para evitar conflito
 		podApi := api.Group("/pods/:namespace/:pod")
 		{
@@ -126,6 +228,11 @@ func setupRoutes(router *gin.Engine, server *Server) {
 			podApi.POST("/validate-lab", func(c *gin.Context) {
 				server.validateLabCompletion(c)
 			})
+
+			// Snapshot do estado atual do laboratório
+			podApi.POST("/snapshots", func(c *gin.Context) {
+				server.handleCreateSnapshot(c)
+			})
 		}
 	}
 }
@@ -249,20 +356,66 @@ func createLab(c *gin.Context, server *Server) {
 		req.TemplateId = ""
 	}
 
+	request := LabRequest{
+		UserID:         userId,
+		Template:       req.TemplateId,
+		Org:            c.GetString("org"),
+		IdempotencyKey: c.GetHeader("Idempotency-Key"),
+	}
+	if len(request.IdempotencyKey) > 255 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key deve ter no máximo 255 caracteres"})
+		return
+	}
+	if request.Org == "" && config.Lab.Extensions.TrustRoleHeader {
+		request.Org = c.GetHeader("X-Girus-Org")
+	}
+	if IsInstructorRole(requestRole(c)) {
+		request.Priority = 1
+	}
+
 	log.Printf("Iniciando criação de laboratório para usuário: %s com template: %s", userId, req.TemplateId)
-	err := server.labManager.CreateLabEnvironment(userId, req.TemplateId)
+	operation, err := server.labManager.StartCreateLab(request)
 	if err != nil {
 		log.Printf("Erro ao criar laboratório: %v", err)
-		c.JSON(500, gin.H{"error": err.Error()})
+		switch {
+		case errors.IsNotFound(err):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Template não encontrado"})
+		case errors.IsTooManyRequests(err):
+			c.Header("Retry-After", strconv.Itoa(int(capacityRetryAfter.Seconds())))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "A fila de laboratórios está cheia, tente novamente mais tarde"})
+		case errors.IsConflict(err):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(500, gin.H{"error": err.Error()})
+		}
 		return
 	}
 
-	log.Printf("Laboratório criado com sucesso para usuário: %s", userId)
-	c.JSON(200, gin.H{
-		"message":    "Laboratório criado com sucesso",
-		"labId":      fmt.Sprintf("lab-%s", userId),
-		"templateId": req.TemplateId,
-	})
+	// O usuário já tinha um laboratório saudável do template
+	if operation.Reused {
+		c.JSON(http.StatusOK, gin.H{
+			"message":     "Laboratório existente reaproveitado",
+			"operationId": operation.ID,
+			"templateId":  operation.TemplateID,
+			"labId":       operation.LabID,
+			"podName":     operation.PodName,
+			"reused":      true,
+		})
+		return
+	}
+
+	// A criação continua em segundo plano; o progresso é acompanhado pela operação
+	response := gin.H{
+		"message":     "Criação do laboratório iniciada",
+		"operationId": operation.ID,
+		"templateId":  req.TemplateId,
+	}
+	if operation.Queue != nil {
+		response["message"] = "Laboratório na fila aguardando vaga"
+		response["queue"] = operation.Queue
+	}
+	c.Header("Location", "/api/v1/operations/"+operation.ID)
+	c.JSON(http.StatusAccepted, response)
 }
 
 func getCurrentLab(c *gin.Context, server *Server) {
@@ -270,16 +423,12 @@ func getCurrentLab(c *gin.Context, server *Server) {
 	userID := "test-user"
 
 	// Construir namespace a partir do userID
-	namespace := fmt.Sprintf("lab-%s", userID)
+	namespace := server.labManager.namespaceForUser(userID)
 
 	log.Printf("[API] Buscando laboratório atual para o usuário %s", userID)
 
 	// Listar todos os pods do usuário com os seletores corretos
-	ctx, cancel := contextWithTimeout()
-	defer cancel()
-	podList, err := server.labManager.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
-		LabelSelector: "app=girus-lab",
-	})
+	pods, err := server.labManager.listLabPods(namespace, labPodSelector)
 
 	if err != nil {
 		log.Printf("[API] Erro ao listar pods do usuário %s: %v", userID, err)
@@ -287,9 +436,20 @@ func getCurrentLab(c *gin.Context, server *Server) {
 		return
 	}
 
-	log.Printf("[API] Encontrados %d pods para o usuário %s", len(podList.Items), userID)
+	log.Printf("[API] Encontrados %d pods para o usuário %s", len(pods), userID)
 
-	if len(podList.Items) == 0 {
+	if len(pods) == 0 {
+		if paused, ok := server.labManager.PausedLab(namespace); ok {
+			log.Printf("[API] Laboratório do usuário %s está pausado", userID)
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":      "Nenhum laboratório ativo encontrado",
+				"paused":     true,
+				"labId":      paused.LabID,
+				"templateId": paused.Template,
+				"pausedAt":   paused.PausedAt,
+			})
+			return
+		}
 		log.Printf("[API] Nenhum pod encontrado para o usuário %s", userID)
 		c.JSON(http.StatusNotFound, gin.H{"error": "Nenhum laboratório ativo encontrado"})
 		return
@@ -297,25 +457,16 @@ func getCurrentLab(c *gin.Context, server *Server) {
 
 	// Se houver mais de um pod, ordenar pela data de criação e pegar o mais recente
 	var currentPod *corev1.Pod
-	if len(podList.Items) > 1 {
+	if len(pods) > 1 {
 		// Ordenar pods por data de criação (mais recente primeiro)
-		sort.Slice(podList.Items, func(i, j int) bool {
+		sort.Slice(pods, func(i, j int) bool {
 			// Pods com CreationTimestamp mais recente vêm primeiro
-			return podList.Items[i].CreationTimestamp.After(podList.Items[j].CreationTimestamp.Time)
+			return pods[i].CreationTimestamp.After(pods[j].CreationTimestamp.Time)
 		})
-		currentPod = &podList.Items[0]
-		log.Printf("[API] Múltiplos pods encontrados (%d), usando o mais recente: %s", len(podList.Items), currentPod.Name)
-		
-		// Opcionalmente, limpar os pods antigos em segundo plano
-		go func() {
-			for i := 1; i < len(podList.Items); i++ {
-				oldPod := podList.Items[i]
-				log.Printf("[API] Limpando pod antigo em segundo plano: %s", oldPod.Name)
-				_ = server.labManager.DeletePod(namespace, oldPod.Name)
-			}
-		}()
+		currentPod = &pods[0]
+		log.Printf("[API] Múltiplos pods encontrados (%d), usando o mais recente: %s", len(pods), currentPod.Name)
 	} else {
-		currentPod = &podList.Items[0]
+		currentPod = &pods[0]
 		log.Printf("[API] Um único pod encontrado: %s", currentPod.Name)
 	}
 
@@ -323,8 +474,8 @@ func getCurrentLab(c *gin.Context, server *Server) {
 	templateId := currentPod.Labels["template"]
 	log.Printf("[API] Laboratório encontrado: %s (template: %s)", currentPod.Name, templateId)
 
-	// Verificar status detalhado do pod
-	podStatus := string(currentPod.Status.Phase)
+	// Verificar status detalhado do pod (ou da preparação, enquanto ela não termina com sucesso)
+	podStatus := labStatus(currentPod)
 	log.Printf("[API] Status do pod: %s", podStatus)
 	
 	// Verificar se todos os contêineres estão prontos
@@ -360,6 +511,10 @@ func getCurrentLab(c *gin.Context, server *Server) {
 		"containersStatus":   containersStatus,
 		"creationTimestamp": currentPod.CreationTimestamp.Format(time.RFC3339),
 		"youtubeVideo":      youtubeVideo,
+		"prepare": gin.H{
+			"status":  currentPod.Annotations[prepareStatusAnnotation],
+			"message": currentPod.Annotations[prepareMessageAnnotation],
+		},
 	}
 	
 	// Adicionar tarefas do template à resposta se o template foi encontrado
@@ -367,6 +522,9 @@ func getCurrentLab(c *gin.Context, server *Server) {
 		log.Printf("[API] Incluindo %d tarefas com dicas na resposta", len(template.Tasks))
 		responseData["tasks"] = template.Tasks
 	}
+
+	// Tarefas já validadas, preservadas quando o laboratório é reiniciado
+	responseData["validatedTasks"] = server.labManager.ValidatedTasks(currentPod.Namespace)
 	
 	// Se temos informações detalhadas do laboratório, adicionar dados do timer
 	if found {
@@ -382,79 +540,6 @@ func getCurrentLab(c *gin.Context, server *Server) {
 
 // NOTE: A função contextWithTimeout está definida em lab_manager.go
 
-// Função handlePodStatus com contexto atualizado
-func (s *Server) handleGetPodStatus(c *gin.Context) {
-	namespace := c.Param("namespace")
-	podName := c.Param("pod")
-
-	// Listar todos os pods do usuário
-	ctx, cancel := contextWithTimeout()
-	defer cancel()
-	podList, err := s.labManager.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
-		LabelSelector: fmt.Sprintf("app=girus-lab,user=%s", namespace),
-	})
-
-	if err != nil {
-		log.Printf("[API] Erro ao listar pods: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao verificar status dos pods"})
-		return
-	}
-
-	// Se não há pods, verificar por nome específico
-	if len(podList.Items) == 0 && podName != "" {
-		ctx, cancel = contextWithTimeout()
-		defer cancel()
-		pod, err := s.labManager.clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
-		if err != nil {
-			log.Printf("[API] Pod %s não encontrado: %v", podName, err)
-			c.JSON(http.StatusNotFound, gin.H{"error": "Pod não encontrado"})
-			return
-		}
-		podList.Items = append(podList.Items, *pod)
-	}
-
-	// Verificar se há pods que correspondem ao critério
-	if len(podList.Items) == 0 {
-		log.Printf("[API] Nenhum pod encontrado para namespace %s", namespace)
-		c.JSON(http.StatusNotFound, gin.H{"error": "Nenhum pod encontrado"})
-		return
-	}
-
-	// Verificar status de cada pod
-	pods := []map[string]interface{}{}
-	for _, pod := range podList.Items {
-		podInfo := map[string]interface{}{
-			"name":      pod.Name,
-			"namespace": pod.Namespace,
-			"phase":     pod.Status.Phase,
-		}
-
-		// Verificar se todos os contêineres estão prontos
-		allContainersReady := true
-		containersInfo := []map[string]interface{}{}
-		for _, container := range pod.Status.ContainerStatuses {
-			containerInfo := map[string]interface{}{
-				"name":    container.Name,
-				"ready":   container.Ready,
-				"restartCount": container.RestartCount,
-			}
-			if !container.Ready {
-				allContainersReady = false
-			}
-			containersInfo = append(containersInfo, containerInfo)
-		}
-		podInfo["allContainersReady"] = allContainersReady
-		podInfo["containers"] = containersInfo
-
-		pods = append(pods, podInfo)
-	}
-
-	log.Printf("[API] Todos os contêineres prontos: %v", pods[0]["allContainersReady"])
-	c.JSON(http.StatusOK, gin.H{
-		"pods": pods,
-	})
-}
-
 // WebSocketTerminal implementa as interfaces necessárias para funcionar com SPDY
 type WebSocketTerminal struct {
 	conn         *websocket.Conn
@@ -522,13 +607,13 @@ func (s *Server) handleConnectTerminal(c *gin.Context) {
 	container := c.Param("container")
 
 	if container == "" {
-		container = "lab" // Nome padrão do contêiner
+		container = labContainerName // Nome padrão do contêiner
 	}
 
 	// Obter objeto do pod
 	ctx, cancel := contextWithTimeout()
 	defer cancel()
-	podObj, err := s.labManager.clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	podObj, err := s.labManager.backend.GetLab(ctx, namespace, podName)
 	if err != nil {
 		log.Printf("[API] Erro ao obter pod: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Erro ao conectar ao terminal: %v", err)})
@@ -566,6 +651,26 @@ func (s *Server) handleConnectTerminal(c *gin.Context) {
 
 	log.Printf("Pod encontrado e está rodando com todos os contêineres prontos. Iniciando upgrade para WebSocket")
 
+	// Aguardar a preparação e a restauração do snapshot antes de liberar o terminal
+	if preparing(podObj) {
+		log.Printf("Pod %s ainda está sendo preparado", podName)
+		c.JSON(http.StatusConflict, gin.H{"error": "O laboratório ainda está sendo preparado"})
+		return
+	}
+	if !prepared(podObj) {
+		log.Printf("A preparação do pod %s falhou", podName)
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "A preparação do laboratório falhou",
+			"details": podObj.Annotations[prepareMessageAnnotation],
+		})
+		return
+	}
+	if restorePending(podObj) {
+		log.Printf("Pod %s ainda está restaurando um snapshot", podName)
+		c.JSON(http.StatusConflict, gin.H{"error": "O laboratório ainda está restaurando o snapshot"})
+		return
+	}
+
 	// Agora verificar se o contêiner solicitado existe
 	containerExists := false
 	for _, podContainer := range podObj.Spec.Containers {
@@ -600,40 +705,19 @@ func (s *Server) handleConnectTerminal(c *gin.Context) {
 		return
 	}
 	defer conn.Close()
-
-	// Configurar requisição de terminal
-	req := s.labManager.clientset.CoreV1().RESTClient().Post().
-		Resource("pods").
-		Name(podName).
-		Namespace(namespace).
-		SubResource("exec")
-
-	req.VersionedParams(&corev1.PodExecOptions{
-		Container: container,
-		Command:   []string{"/bin/sh"},
-		Stdin:     true,
-		Stdout:    true,
-		Stderr:    true,
-		TTY:       true,
-	}, scheme.ParameterCodec)
-
-	// Estabelecer conexão exec
-	executor, err := remotecommand.NewSPDYExecutor(s.labManager.config, "POST", req.URL())
-	if err != nil {
-		log.Printf("Erro ao criar executor SPDY: %v", err)
-		conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("Erro ao criar executor SPDY: %v", err)))
-		return
-	}
+	defer s.labManager.terminals.Register(namespace, conn)()
 
 	// Criar os pipes para comunicação bidirecional
 	wsTerminal := NewWebSocketTerminal(conn)
 
 	// Executar o comando no pod
-	err = executor.Stream(remotecommand.StreamOptions{
+	err = s.labManager.backend.AttachTerminal(context.Background(), podObj, ExecOptions{
+		Container:         container,
+		Command:           []string{"/bin/sh"},
 		Stdin:             wsTerminal,
 		Stdout:            wsTerminal,
 		Stderr:            wsTerminal,
-		Tty:               true,
+		TTY:               true,
 		TerminalSizeQueue: wsTerminal,
 	})
 
@@ -648,13 +732,13 @@ func (s *Server) CleanupUserLabs(namespace string) error {
 	// Verificar se existem pods para limpar
 	ctx, cancel := contextWithTimeout()
 	defer cancel()
-	pod, err := s.labManager.clientset.CoreV1().Pods(namespace).Get(ctx, "lab-pod", metav1.GetOptions{})
+	pod, err := s.labManager.backend.GetLab(ctx, namespace, "lab-pod")
 	if err == nil {
 		// Se o pod existe, removê-lo
 		log.Printf("Removendo pod %s/%s", namespace, pod.Name)
 		ctx, cancel = contextWithTimeout()
 		defer cancel()
-		err = s.labManager.clientset.CoreV1().Pods(namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{
+		err = s.labManager.backend.DeleteLab(ctx, namespace, pod.Name, metav1.DeleteOptions{
 			GracePeriodSeconds: pointer.Int64(0), // Remoção imediata
 		})
 		if err != nil {
@@ -665,14 +749,14 @@ func (s *Server) CleanupUserLabs(namespace string) error {
 	// Listar todos os pods do usuário
 	ctx, cancel = contextWithTimeout()
 	defer cancel()
-	podList, err := s.labManager.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
-	if err == nil && len(podList.Items) > 0 {
+	pods, err := s.labManager.backend.ListLabs(ctx, namespace, metav1.ListOptions{})
+	if err == nil && len(pods) > 0 {
 		// Excluir todos os pods do usuário
 		errCount := 0
-		for _, pod := range podList.Items {
+		for _, pod := range pods {
 			log.Printf("[API] Excluindo pod %s/%s", namespace, pod.Name)
 			deleteCtx, deleteCancel := contextWithTimeout()
-			err = s.labManager.clientset.CoreV1().Pods(namespace).Delete(deleteCtx, pod.Name, metav1.DeleteOptions{})
+			err = s.labManager.backend.DeleteLab(deleteCtx, namespace, pod.Name, metav1.DeleteOptions{})
 			deleteCancel()
 			if err != nil {
 				log.Printf("[API] Erro ao excluir pod %s/%s: %v", namespace, pod.Name, err)
@@ -687,13 +771,14 @@ func (s *Server) CleanupUserLabs(namespace string) error {
 func (s *Server) handleWebSocketTerminal(c *gin.Context) {
 	namespace := c.Param("namespace")
 	podName := c.Param("pod")
+	container := c.DefaultQuery("container", labContainerName)
 
-	log.Printf("Tentando conectar ao terminal do pod %s no namespace %s", podName, namespace)
+	log.Printf("Tentando conectar ao terminal do contêiner %s do pod %s no namespace %s", container, podName, namespace)
 
 	// Verificar se o pod existe e está pronto
 	ctx, cancel := contextWithTimeout()
 	defer cancel()
-	podObj, err := s.labManager.clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	podObj, err := s.labManager.backend.GetLab(ctx, namespace, podName)
 	if err != nil {
 		log.Printf("Erro ao encontrar pod: %v", err)
 		c.JSON(http.StatusNotFound, gin.H{"error": "Pod não encontrado"})
@@ -707,23 +792,42 @@ func (s *Server) handleWebSocketTerminal(c *gin.Context) {
 		return
 	}
 
-	// Verificar se todos os contêineres estão prontos
-	containersReady := true
-	for _, containerStatus := range podObj.Status.ContainerStatuses {
-		if !containerStatus.Ready {
-			containersReady = false
-			log.Printf("Contêiner %s no pod %s não está pronto", containerStatus.Name, podName)
-			break
-		}
+	// Verificar se o contêiner alvo existe e está pronto; sidecars ainda
+	// inicializando não impedem o acesso ao terminal de outro contêiner
+	containerStatus, found := findContainerStatus(podObj, container)
+	if !found {
+		log.Printf("Contêiner %s não encontrado no pod %s", container, podName)
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Contêiner '%s' não encontrado no pod", container)})
+		return
 	}
 
-	if !containersReady {
-		log.Printf("Nem todos os contêineres do pod estão prontos")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Nem todos os contêineres do pod estão prontos"})
+	if !containerStatus.Ready {
+		log.Printf("Contêiner %s no pod %s não está pronto", container, podName)
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Contêiner '%s' não está pronto", container)})
 		return
 	}
 
-	log.Printf("Pod encontrado e está rodando com todos os contêineres prontos. Iniciando upgrade para WebSocket")
+	// Aguardar a preparação e a restauração do snapshot antes de liberar o terminal
+	if preparing(podObj) {
+		log.Printf("Pod %s ainda está sendo preparado", podName)
+		c.JSON(http.StatusConflict, gin.H{"error": "O laboratório ainda está sendo preparado"})
+		return
+	}
+	if !prepared(podObj) {
+		log.Printf("A preparação do pod %s falhou", podName)
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "A preparação do laboratório falhou",
+			"details": podObj.Annotations[prepareMessageAnnotation],
+		})
+		return
+	}
+	if restorePending(podObj) {
+		log.Printf("Pod %s ainda está restaurando um snapshot", podName)
+		c.JSON(http.StatusConflict, gin.H{"error": "O laboratório ainda está restaurando o snapshot"})
+		return
+	}
+
+	log.Printf("Pod encontrado e contêiner %s pronto. Iniciando upgrade para WebSocket", container)
 
 	// Upgrade para websocket
 	upgrader := websocket.Upgrader{
@@ -750,43 +854,15 @@ func (s *Server) handleWebSocketTerminal(c *gin.Context) {
 
 	log.Printf("WebSocket conectado com sucesso. Configurando exec no pod")
 
+	// Registrar o terminal para que um reset do laboratório possa pedir a reconexão
+	defer s.labManager.terminals.Register(namespace, conn)()
+
 	// Configurar controle de fechamento adequado
 	conn.SetCloseHandler(func(code int, text string) error {
 		log.Printf("Cliente fechou conexão WebSocket: código=%d, razão=%s", code, text)
 		return nil // Não fechamos a conexão aqui, pois isso pode impedir a leitura de mensagens pendentes
 	})
 
-	// Configurar exec para o pod
-	req := s.labManager.clientset.CoreV1().RESTClient().Post().
-		Resource("pods").
-		Name(podName).
-		Namespace(namespace).
-		SubResource("exec")
-
-	req.VersionedParams(&corev1.PodExecOptions{
-		Command: []string{"/bin/bash"},
-		Stdin:   true,
-		Stdout:  true,
-		Stderr:  true,
-		TTY:     true,
-	}, scheme.ParameterCodec)
-
-	config, err := s.labManager.getKubeConfig()
-	if err != nil {
-		log.Printf("Erro ao obter configuração Kubernetes: %v", err)
-		sendWebSocketError(conn, fmt.Sprintf("Erro na configuração: %v", err))
-		conn.Close() // Aqui podemos fechar, pois houve erro crítico
-		return
-	}
-
-	exec, err := remotecommand.NewSPDYExecutor(config, "POST", req.URL())
-	if err != nil {
-		log.Printf("Erro ao criar executor SPDY: %v", err)
-		sendWebSocketError(conn, fmt.Sprintf("Erro ao criar executor: %v", err))
-		conn.Close() // Aqui podemos fechar, pois houve erro crítico
-		return
-	}
-
 	// Criar adaptadores para websocket
 	wsHandler := &terminalHandler{
 		conn:         conn,
@@ -803,12 +879,14 @@ func (s *Server) handleWebSocketTerminal(c *gin.Context) {
 	// Executar o streaming em uma goroutine
 	streamDone := make(chan error, 1)
 	go func() {
-		err := exec.Stream(remotecommand.StreamOptions{
+		err := s.labManager.backend.AttachTerminal(context.Background(), podObj, ExecOptions{
+			Container:         container,
+			Command:           []string{containerShell(container)},
 			Stdin:             wsHandler,
 			Stdout:            wsHandler,
 			Stderr:            wsHandler,
 			TerminalSizeQueue: wsHandler,
-			Tty:               true,
+			TTY:               true,
 		})
 		streamDone <- err
 	}()
@@ -958,10 +1036,30 @@ func (s *Server) Run() error {
 	// Iniciar monitoramento de laboratórios com timer
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel() // Garantir que o monitoramento será encerrado quando o servidor for encerrado
+
+	// Os informers servem as leituras de pods e namespaces dos demais componentes
+	s.labManager.StartCache(ctx)
 	s.labManager.StartTimerMonitor(ctx)
 	log.Printf("Monitoramento de laboratórios com timer iniciado")
 
-	log.Printf("Servidor iniciado na porta %s", s.config.Port)
+	// Iniciar o warm pool de laboratórios pré-provisionados, quando habilitado
+	s.labManager.StartWarmPool(ctx)
+
+	// Iniciar a limpeza de workspaces persistentes expirados, quando habilitados
+	s.labManager.StartWorkspaceCleanup(ctx)
+
+	// Recarregar templates alterados e manter as imagens deles nos nós
+	s.labManager.StartTemplateReload(ctx)
+	s.labManager.StartImagePrepull(ctx)
+	s.labManager.StartCapacityQueue(ctx)
+
+	// Reconciliar os laboratórios declarados como recursos GirusLab
+	s.labManager.StartOperator(ctx)
+
+	// Remover namespaces, ConfigMaps e pods deixados para trás pelos laboratórios
+	s.labManager.StartGarbageCollector(ctx)
+
+	log.Printf("Servidor iniciado na porta %d", s.config.Port)
 	return router.Run(":" + fmt.Sprintf("%d", s.config.Port))
 }
 
@@ -989,6 +1087,15 @@ func (server *Server) StartLab(c *gin.Context) {
 	err := server.labManager.CreateLabEnvironment(userId, templateId)
 	if err != nil {
 		log.Printf("Erro ao criar laboratório: %v", err)
+		if errors.IsConflict(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.IsTooManyRequests(err) {
+			c.Header("Retry-After", strconv.Itoa(int(capacityRetryAfter.Seconds())))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
@@ -1015,7 +1122,7 @@ func (s *Server) validateLabTask(c *gin.Context) {
 	// Obter o pod
 	ctx, cancel := contextWithTimeout()
 	defer cancel()
-	pod, err := s.labManager.clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	pod, err := s.labManager.backend.GetLab(ctx, namespace, podName)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Pod não encontrado"})
 		return
@@ -1038,6 +1145,13 @@ func (s *Server) validateLabTask(c *gin.Context) {
 	task := template.Tasks[req.TaskIndex]
 	success, message := s.labManager.templates.ValidateTaskCompletion(pod, task)
 
+	// O histórico fica no namespace e é preservado quando o laboratório é reiniciado
+	if success {
+		if err := s.labManager.recordValidatedTask(namespace, req.TemplateId, req.TaskIndex, task.Name); err != nil {
+			log.Printf("Erro ao registrar tarefa validada no laboratório %s: %v", namespace, err)
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": success,
 		"message": message,
@@ -1094,10 +1208,8 @@ func getPodStatus(c *gin.Context, server *Server) {
 
 	log.Printf("Verificando status do pod %s no namespace %s", podName, namespace)
 
-	// Buscar o pod no Kubernetes
-	ctx, cancel := contextWithTimeout()
-	defer cancel()
-	podObj, err := server.labManager.clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	// Buscar o pod (pelo cache, quando disponível)
+	podObj, err := server.labManager.getLabPod(namespace, podName)
 	if err != nil {
 		log.Printf("Erro ao buscar pod: %v", err)
 		c.JSON(http.StatusNotFound, gin.H{
@@ -1114,6 +1226,16 @@ func getPodStatus(c *gin.Context, server *Server) {
 		"startTime":           podObj.Status.StartTime,
 		"containerStatuses":   podObj.Status.ContainerStatuses,
 		"initContainerStatus": podObj.Status.InitContainerStatuses,
+		"sidecars":            sidecarStatuses(podObj),
+		"prepare": gin.H{
+			"status":  podObj.Annotations[prepareStatusAnnotation],
+			"message": podObj.Annotations[prepareMessageAnnotation],
+		},
+		"restore": gin.H{
+			"status":   podObj.Annotations[restoreStatusAnnotation],
+			"snapshot": podObj.Annotations[restoreSnapshotAnnotation],
+			"message":  podObj.Annotations[restoreMessageAnnotation],
+		},
 	})
 }
 
@@ -1137,7 +1259,7 @@ func deleteLab(c *gin.Context, server *Server) {
 	}
 
 	// Construir namespace a partir do userID
-	namespace := fmt.Sprintf("lab-%s", userID)
+	namespace := server.labManager.namespaceForUser(userID)
 
 	log.Printf("[API] Solicitação para excluir laboratório do usuário %s no namespace %s", userID, namespace)
 
@@ -1173,13 +1295,13 @@ func deleteLab(c *gin.Context, server *Server) {
 	log.Printf("[API] Excluindo todos os pods no namespace %s", namespace)
 	
 	// Listar todos os pods no namespace
-	var podList *corev1.PodList
+	var pods []corev1.Pod
 	var podListErr error
 	
 	// Tentar listar pods com retry
 	for attempt := 1; attempt <= 3; attempt++ {
 		ctx, cancel = contextWithTimeout()
-		podList, podListErr = server.labManager.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+		pods, podListErr = server.labManager.backend.ListLabs(ctx, namespace, metav1.ListOptions{})
 		cancel()
 		
 		if podListErr == nil {
@@ -1198,13 +1320,13 @@ func deleteLab(c *gin.Context, server *Server) {
 	}
 	
 	// Se não há pods, retorna sucesso imediatamente
-	if len(podList.Items) == 0 {
+	if len(pods) == 0 {
 		log.Printf("[API] Nenhum pod encontrado no namespace %s para excluir", namespace)
 		c.JSON(http.StatusOK, gin.H{"message": "Laboratório encerrado com sucesso"})
 		return
 	}
 	
-	log.Printf("[API] Encontrados %d pods para excluir no namespace %s", len(podList.Items), namespace)
+	log.Printf("[API] Encontrados %d pods para excluir no namespace %s", len(pods), namespace)
 	
 	// Excluir cada pod encontrado
 	successCount := 0
@@ -1213,11 +1335,11 @@ func deleteLab(c *gin.Context, server *Server) {
 	// Usar um canal para controlar o timeout das operações
 	doneChan := make(chan struct{})
 	go func() {
-		for _, pod := range podList.Items {
+		for _, pod := range pods {
 			if pod.Name != "" {
 				log.Printf("[API] Excluindo pod %s/%s", namespace, pod.Name)
 				deleteCtx, deleteCancel := contextWithTimeout()
-				deleteErr := server.labManager.clientset.CoreV1().Pods(namespace).Delete(deleteCtx, pod.Name, metav1.DeleteOptions{
+				deleteErr := server.labManager.backend.DeleteLab(deleteCtx, namespace, pod.Name, metav1.DeleteOptions{
 					GracePeriodSeconds: pointer.Int64(0), // Forçar exclusão imediata
 				})
 				deleteCancel()
@@ -1252,7 +1374,7 @@ func (server *Server) handleUserLabs(c *gin.Context) {
 	// Listar todos os pods do usuário
 	ctx, cancel := contextWithTimeout()
 	defer cancel()
-	podList, err := server.labManager.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+	pods, err := server.labManager.backend.ListLabs(ctx, namespace, metav1.ListOptions{
 		LabelSelector: fmt.Sprintf("app=girus-lab,user=%s", namespace),
 	})
 	
@@ -1263,7 +1385,7 @@ func (server *Server) handleUserLabs(c *gin.Context) {
 	
 	// Formatar resposta
 	labs := []gin.H{}
-	for _, pod := range podList.Items {
+	for _, pod := range pods {
 		templateName := pod.Labels["template"]
 		
 		lab := gin.H{
@@ -1290,7 +1412,7 @@ func (s *Server) handleGetLabStatus(c *gin.Context) {
 	// Obter o pod
 	ctx, cancel := contextWithTimeout()
 	defer cancel()
-	podObj, err := s.labManager.clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	podObj, err := s.labManager.backend.GetLab(ctx, namespace, podName)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Lab não encontrado"})
 		return
@@ -1313,7 +1435,7 @@ func (s *Server) handleWebSocketStatus(c *gin.Context) {
 	// Verificar se o pod existe
 	ctx, cancel := contextWithTimeout()
 	defer cancel()
-	_, err := s.labManager.clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	_, err := s.labManager.backend.GetLab(ctx, namespace, podName)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Pod não encontrado"})
 		return
@@ -1331,7 +1453,7 @@ func (server *Server) handleDeleteLab(c *gin.Context) {
 	// Verificar se o pod existe
 	ctx, cancel := contextWithTimeout()
 	defer cancel()
-	_, err := server.labManager.clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	_, err := server.labManager.backend.GetLab(ctx, namespace, podName)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Lab não encontrado"})
 		return
@@ -1353,7 +1475,7 @@ func (server *Server) handleCleanupAllLabs(c *gin.Context) {
 	// Listar todos os pods do usuário
 	ctx, cancel := contextWithTimeout()
 	defer cancel()
-	podList, err := server.labManager.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	pods, err := server.labManager.backend.ListLabs(ctx, namespace, metav1.ListOptions{})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Erro ao listar pods: %v", err)})
 		return
@@ -1361,10 +1483,10 @@ func (server *Server) handleCleanupAllLabs(c *gin.Context) {
 	
 	// Excluir todos os pods do usuário
 	deletedPods := 0
-	for _, pod := range podList.Items {
+	for _, pod := range pods {
 		ctx, cancel := contextWithTimeout()
 		defer cancel()
-		err = server.labManager.clientset.CoreV1().Pods(namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{
+		err = server.labManager.backend.DeleteLab(ctx, namespace, pod.Name, metav1.DeleteOptions{
 			GracePeriodSeconds: pointer.Int64(0),
 		})
 		if err != nil {
@@ -1424,6 +1546,10 @@ func (server *Server) DeleteLab(c *gin.Context) {
 
 	log.Printf("Solicitação para deletar laboratório do usuário: %s (force: %v)", userId, forceDelete)
 	err := server.labManager.DeleteLabEnvironment(userId, forceDelete)
+	if errors.IsNotFound(err) {
+		c.JSON(404, gin.H{"error": "Laboratório não encontrado"})
+		return
+	}
 	if err != nil {
 		c.JSON(500, gin.H{"error": fmt.Sprintf("Erro ao deletar laboratório: %v", err)})
 		return
@@ -1445,6 +1571,10 @@ func (server *Server) DeleteCurrentLab(c *gin.Context) {
 	
 	log.Printf("Excluindo laboratório atual (userID: %s, force: %v)", labInfo.UserID, forceDelete)
 	err := server.labManager.DeleteLabEnvironment(labInfo.UserID, forceDelete)
+	if errors.IsNotFound(err) {
+		c.JSON(404, gin.H{"error": "Nenhum laboratório encontrado"})
+		return
+	}
 	if err != nil {
 		c.JSON(500, gin.H{"error": fmt.Sprintf("Erro ao excluir laboratório: %v", err)})
 		return
@@ -1452,3 +1582,543 @@ func (server *Server) DeleteCurrentLab(c *gin.Context) {
 	
 	c.JSON(200, gin.H{"message": "Laboratório atual excluído com sucesso"})
 }
+
+// handleListWorkspaces lista os workspaces persistentes de um usuário
+func (server *Server) handleListWorkspaces(c *gin.Context) {
+	userID := c.Param("userId")
+	if !authorizeUser(c, userID) {
+		return
+	}
+
+	workspaces, err := server.labManager.ListWorkspaces(userID)
+	if err != nil {
+		log.Printf("[API] Erro ao listar workspaces do usuário %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao listar workspaces"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":    server.labManager.workspaces != nil,
+		"workspaces": workspaces,
+	})
+}
+
+// handleDeleteWorkspace exclui um workspace persistente de um usuário
+func (server *Server) handleDeleteWorkspace(c *gin.Context) {
+	userID := c.Param("userId")
+	if !authorizeUser(c, userID) {
+		return
+	}
+	name := c.Param("name")
+
+	err := server.labManager.DeleteWorkspace(userID, name)
+	if err != nil {
+		log.Printf("[API] Erro ao excluir workspace %s do usuário %s: %v", name, userID, err)
+		switch {
+		case server.labManager.workspaces == nil:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.IsNotFound(err):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Workspace não encontrado"})
+		case errors.IsConflict(err):
+			c.JSON(http.StatusConflict, gin.H{"error": "Workspace em uso por um laboratório ativo"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao excluir workspace"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Workspace excluído com sucesso"})
+}
+
+// handleCreateSnapshot salva o estado atual de um laboratório
+func (server *Server) handleCreateSnapshot(c *gin.Context) {
+	namespace := c.Param("namespace")
+	podName := c.Param("pod")
+
+	var req struct {
+		Paths []string `json:"paths"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Formato de requisição inválido"})
+			return
+		}
+	}
+
+	snapshot, err := server.labManager.CreateSnapshot(namespace, podName, req.Paths)
+	if err != nil {
+		log.Printf("[API] Erro ao criar snapshot de %s/%s: %v", namespace, podName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, snapshot)
+}
+
+// handleListSnapshots lista os snapshots de um usuário
+func (server *Server) handleListSnapshots(c *gin.Context) {
+	userID := c.Param("userId")
+	if !authorizeUser(c, userID) {
+		return
+	}
+
+	snapshots, err := server.labManager.ListSnapshots(userID)
+	if err != nil {
+		log.Printf("[API] Erro ao listar snapshots do usuário %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao listar snapshots"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":   server.labManager.snapshots != nil,
+		"snapshots": snapshots,
+	})
+}
+
+// handleDownloadSnapshot envia o arquivo de um snapshot (ex.: para um instrutor)
+func (server *Server) handleDownloadSnapshot(c *gin.Context) {
+	userID := c.Param("userId")
+	if !authorizeUser(c, userID) {
+		return
+	}
+	id := c.Param("id")
+
+	snapshot, content, err := server.labManager.GetSnapshot(userID, id)
+	if err != nil {
+		respondSnapshotError(c, err)
+		return
+	}
+	defer content.Close()
+
+	c.DataFromReader(http.StatusOK, snapshot.Size, "application/gzip", content, map[string]string{
+		"Content-Disposition": fmt.Sprintf(`attachment; filename="%s.tar.gz"`, snapshot.ID),
+	})
+}
+
+// handleRestoreSnapshot cria um novo laboratório a partir de um snapshot
+func (server *Server) handleRestoreSnapshot(c *gin.Context) {
+	userID := c.Param("userId")
+	if !authorizeUser(c, userID) {
+		return
+	}
+	id := c.Param("id")
+
+	snapshot, err := server.labManager.CreateLabFromSnapshot(userID, id)
+	if err != nil {
+		respondSnapshotError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":    "Laboratório criado, restaurando snapshot",
+		"labId":      server.labManager.namespaceForUser(userID),
+		"templateId": snapshot.Template,
+		"snapshotId": snapshot.ID,
+	})
+}
+
+// handleDeleteSnapshot exclui um snapshot de um usuário
+func (server *Server) handleDeleteSnapshot(c *gin.Context) {
+	userID := c.Param("userId")
+	if !authorizeUser(c, userID) {
+		return
+	}
+	id := c.Param("id")
+
+	if err := server.labManager.DeleteSnapshot(userID, id); err != nil {
+		respondSnapshotError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Snapshot excluído com sucesso"})
+}
+
+// respondSnapshotError converte erros de snapshot em respostas HTTP
+func respondSnapshotError(c *gin.Context, err error) {
+	log.Printf("[API] Erro na operação de snapshot: %v", err)
+	if errors.IsNotFound(err) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Snapshot não encontrado"})
+		return
+	}
+	if errors.IsConflict(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.IsTooManyRequests(err) {
+		c.Header("Retry-After", strconv.Itoa(int(capacityRetryAfter.Seconds())))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
+
+// handlePauseLab pausa um laboratório, liberando o pod e preservando seu estado
+func (server *Server) handlePauseLab(c *gin.Context) {
+	if !server.authorizeLab(c, c.Param("id")) {
+		return
+	}
+	result, err := server.labManager.PauseLab(c.Param("id"))
+	if err != nil {
+		respondLabStateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Laboratório pausado com sucesso",
+		"lab":     result,
+	})
+}
+
+// handleResumeLab recria o pod de um laboratório pausado
+func (server *Server) handleResumeLab(c *gin.Context) {
+	if !server.authorizeLab(c, c.Param("id")) {
+		return
+	}
+	pod, err := server.labManager.ResumeLab(c.Param("id"))
+	if err != nil {
+		respondLabStateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":    "Laboratório retomado, aguardando o pod ficar pronto",
+		"labId":      pod.Namespace,
+		"podName":    pod.Name,
+		"templateId": pod.Labels["template"],
+	})
+}
+
+// handleResetLab recria o laboratório do zero mantendo sua identidade e o progresso
+func (server *Server) handleResetLab(c *gin.Context) {
+	if !server.authorizeLab(c, c.Param("id")) {
+		return
+	}
+	operation, err := server.labManager.StartResetLab(c.Param("id"))
+	if err != nil {
+		respondLabStateError(c, err)
+		return
+	}
+
+	c.Header("Location", "/api/v1/operations/"+operation.ID)
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":        "Reinício do laboratório iniciado",
+		"operationId":    operation.ID,
+		"labId":          c.Param("id"),
+		"templateId":     operation.TemplateID,
+		"timer":          resetTimerPolicy(),
+		"validatedTasks": server.labManager.ValidatedTasks(c.Param("id")),
+	})
+}
+
+// handleExtendLab estende o prazo de um laboratório em andamento
+func (server *Server) handleExtendLab(c *gin.Context) {
+	if !server.authorizeLab(c, c.Param("id")) {
+		return
+	}
+	var req struct {
+		Duration string `json:"duration"` // Vazio = passo padrão do template
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Corpo da requisição inválido"})
+			return
+		}
+	}
+
+	var requested time.Duration
+	if req.Duration != "" {
+		var err error
+		requested, err = time.ParseDuration(req.Duration)
+		if err != nil || requested <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Duração inválida: " + req.Duration})
+			return
+		}
+	}
+
+	result, err := server.labManager.ExtendLab(c.Param("id"), requested, IsInstructorRole(requestRole(c)))
+	if err != nil {
+		respondLabStateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Tempo do laboratório estendido com sucesso",
+		"lab":     result,
+	})
+}
+
+// requestRole retorna o papel do usuário. O papel vem do middleware de
+// autenticação; o cabeçalho só é aceito quando configurado.
+func requestRole(c *gin.Context) string {
+	role := c.GetString("role")
+	if role == "" && config.Lab.Extensions.TrustRoleHeader {
+		role = c.GetHeader("X-Girus-Role")
+	}
+	return role
+}
+
+// requestUserID retorna o usuário que faz a requisição
+func requestUserID(c *gin.Context) string {
+	userID := c.GetString("userId")
+	if userID == "" {
+		userID = getUserIDFromContext(c)
+	}
+	if userID == "" {
+		userID = "test-user" // Temporário para teste
+	}
+	return userID
+}
+
+// authorizeUser permite agir sobre os recursos de um usuário apenas a ele mesmo
+// ou a um instrutor; caso contrário responde 403 e retorna false
+func authorizeUser(c *gin.Context, userID string) bool {
+	if requestUserID(c) == userID || IsInstructorRole(requestRole(c)) {
+		return true
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": "Os recursos pertencem a outro usuário"})
+	return false
+}
+
+// authorizeLab permite agir sobre um laboratório apenas ao seu dono ou a um
+// instrutor; caso contrário responde com o erro e retorna false
+func (server *Server) authorizeLab(c *gin.Context, labID string) bool {
+	if _, err := server.labManager.authorizeLab(labID, requestUserID(c), IsInstructorRole(requestRole(c))); err != nil {
+		respondLabStateError(c, err)
+		return false
+	}
+	return true
+}
+
+// handleLabProxy encaminha requisições HTTP e WebSocket para uma porta exposta
+// do laboratório, permitindo que a interface exiba a aplicação em um iframe
+func (server *Server) handleLabProxy(c *gin.Context) {
+	userID := requestUserID(c)
+
+	port, err := strconv.Atoi(c.Param("port"))
+	if err != nil || port < 1 || port > 65535 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Porta inválida: " + c.Param("port")})
+		return
+	}
+
+	labID := c.Param("id")
+	target, err := server.labManager.ProxyTarget(labID, userID, int32(port), IsInstructorRole(requestRole(c)))
+	if err != nil {
+		respondLabStateError(c, err)
+		return
+	}
+
+	prefix := fmt.Sprintf("/api/v1/labs/%s/proxy/%d", labID, port)
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = target.Scheme
+			req.URL.Host = target.Host
+			req.URL.Path = "/" + strings.TrimPrefix(c.Param("path"), "/")
+			req.URL.RawPath = ""
+			req.Host = target.Host
+
+			// Credenciais do Girus não devem chegar à aplicação do aluno
+			query := req.URL.Query()
+			query.Del("user_id")
+			req.URL.RawQuery = query.Encode()
+			for _, header := range []string{"Authorization", "Cookie", "X-Girus-Role", "X-Real-Ip", "Forwarded"} {
+				req.Header.Del(header)
+			}
+			// Valor nil impede que o ReverseProxy acrescente o IP do cliente
+			req.Header["X-Forwarded-For"] = nil
+			if _, ok := req.Header["User-Agent"]; !ok {
+				req.Header.Set("User-Agent", "")
+			}
+			req.Header.Set("X-Forwarded-Prefix", prefix)
+			req.Header.Set("X-Forwarded-Host", c.Request.Host)
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			// Permitir a exibição em iframe na interface do Girus. A aplicação do
+			// aluno compartilha a origem da API, então roda isolada em sandbox
+			// (sem allow-same-origin) para não ler cookies nem chamar a API
+			resp.Header.Del("X-Frame-Options")
+			resp.Header.Set("Content-Security-Policy", "sandbox allow-scripts allow-forms allow-popups")
+
+			// Redirecionamentos e cookies absolutos precisam do prefixo do proxy
+			if location := resp.Header.Get("Location"); strings.HasPrefix(location, "/") && !strings.HasPrefix(location, "//") {
+				resp.Header.Set("Location", prefix+location)
+			}
+			if cookies := resp.Cookies(); len(cookies) > 0 {
+				resp.Header.Del("Set-Cookie")
+				for _, cookie := range cookies {
+					cookie.Domain = ""
+					cookie.Path = prefix + "/" + strings.TrimPrefix(cookie.Path, "/")
+					resp.Header.Add("Set-Cookie", cookie.String())
+				}
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			log.Printf("[Proxy] Erro ao encaminhar para %s porta %d: %v", labID, port, err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadGateway)
+			json.NewEncoder(w).Encode(gin.H{"error": fmt.Sprintf("A aplicação na porta %d não respondeu", port)})
+		},
+	}
+	proxy.ServeHTTP(c.Writer, c.Request)
+}
+
+// handleLabQuota retorna o uso da cota do namespace do laboratório, para que o
+// aluno entenda por que um recurso criado por ele não sobe
+func (server *Server) handleLabQuota(c *gin.Context) {
+	if config.Lab.DisableQuotas {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cotas de laboratório desabilitadas"})
+		return
+	}
+	usage, err := server.labManager.GetQuotaUsage(c.Param("id"))
+	if err != nil {
+		respondLabStateError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, usage)
+}
+
+// handleRotateLabToken emite um novo token para o kubeconfig do laboratório
+func (server *Server) handleRotateLabToken(c *gin.Context) {
+	if !server.authorizeLab(c, c.Param("id")) {
+		return
+	}
+	rotation, err := server.labManager.RotateLabToken(c.Param("id"))
+	if err != nil {
+		respondLabStateError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Token do laboratório renovado",
+		"labId":     rotation.LabID,
+		"expiresAt": rotation.ExpiresAt,
+	})
+}
+
+// respondLabStateError traduz erros de operações sobre laboratórios em respostas HTTP
+func respondLabStateError(c *gin.Context, err error) {
+	log.Printf("[API] Erro ao alterar estado do laboratório: %v", err)
+	switch {
+	case errors.IsNotFound(err):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Laboratório não encontrado"})
+	case errors.IsConflict(err):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.IsTooManyRequests(err):
+		c.Header("Retry-After", strconv.Itoa(int(capacityRetryAfter.Seconds())))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+	case errors.IsForbidden(err):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.IsBadRequest(err):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// handleGetOperation retorna o estado e os eventos de uma operação
+func (server *Server) handleGetOperation(c *gin.Context) {
+	operation, err := server.labManager.GetOperation(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Operação não encontrada"})
+		return
+	}
+	c.JSON(http.StatusOK, operation)
+}
+
+// handleCancelOperation cancela uma criação de laboratório que ainda está na fila
+func (server *Server) handleCancelOperation(c *gin.Context) {
+	err := server.labManager.CancelOperation(c.Param("id"))
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, gin.H{"message": "Pedido removido da fila"})
+	case errors.IsNotFound(err):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Operação não encontrada"})
+	case errors.IsConflict(err):
+		c.JSON(http.StatusConflict, gin.H{"error": "A operação não está aguardando na fila"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// handleOperationEvents transmite os eventos de uma operação via Server-Sent Events.
+// Os eventos já publicados são reenviados e o fluxo termina com o evento "done".
+func (server *Server) handleOperationEvents(c *gin.Context) {
+	id := c.Param("id")
+	operation, events, cancel, err := server.labManager.SubscribeOperation(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Operação não encontrada"})
+		return
+	}
+	defer cancel()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	for _, event := range operation.Events {
+		c.SSEvent(event.Phase, event)
+	}
+	c.Writer.Flush()
+
+	keepalive := time.NewTicker(15 * time.Second)
+	defer keepalive.Stop()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				if final, err := server.labManager.GetOperation(id); err == nil {
+					c.SSEvent("done", final)
+				}
+				return false
+			}
+			c.SSEvent(event.Phase, event)
+			return true
+		case <-keepalive.C:
+			_, err := io.WriteString(w, ": keepalive\n\n")
+			return err == nil
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+// handleRunGC executa a coleta de recursos órfãos; com ?dryRun=true apenas relata
+// o que seria removido
+func (server *Server) handleRunGC(c *gin.Context) {
+	if !IsInstructorRole(requestRole(c)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Apenas instrutores podem executar a coleta de recursos órfãos"})
+		return
+	}
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dryRun", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Parâmetro dryRun inválido"})
+		return
+	}
+
+	report, err := server.labManager.CollectOrphans(dryRun)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Coleta de recursos órfãos desabilitada"})
+			return
+		}
+		log.Printf("[API] Erro na coleta de recursos órfãos: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro na coleta de recursos órfãos"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// handleGCReport retorna o relatório da última coleta periódica de recursos órfãos
+func (server *Server) handleGCReport(c *gin.Context) {
+	if !IsInstructorRole(requestRole(c)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Apenas instrutores podem consultar a coleta de recursos órfãos"})
+		return
+	}
+	report, err := server.labManager.LastGCReport()
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Coleta de recursos órfãos desabilitada"})
+		return
+	}
+	if report == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Nenhuma coleta executada ainda"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,227 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const localTestTemplate = `name: linux-basics
+title: Linux Básico
+description: Laboratório de teste
+timerEnabled: true
+maxDuration: 30m
+tasks:
+  - name: criar arquivo
+    description: crie hello.txt
+    steps: ["touch hello.txt"]
+    validation:
+      - command: "test -f hello.txt && echo ok"
+        expectedOutput: ok
+        errorMessage: arquivo não existe
+`
+
+// newLocalTestServer cria o servidor completo sobre o backend local, com
+// templates e diretórios de laboratório temporários
+func newLocalTestServer(t *testing.T) *Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	templatesDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(templatesDir, "linux.yaml"), []byte(localTestTemplate), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GIRUS_LAB_BACKEND", "local")
+	t.Setenv("GIRUS_TEMPLATES_DIR", templatesDir)
+	t.Setenv("GIRUS_LOCAL_WORKDIR", t.TempDir())
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := config
+	config = cfg
+	t.Cleanup(func() { config = previous })
+	return NewServer(cfg)
+}
+
+// doJSON executa a requisição no roteador e decodifica a resposta
+func doJSON(t *testing.T, server *Server, method, path string, body interface{}) (int, map[string]interface{}) {
+	t.Helper()
+	return doJSONWithHeaders(t, server, method, path, body, nil)
+}
+
+// doJSONWithHeaders executa a requisição com os cabeçalhos informados
+func doJSONWithHeaders(t *testing.T, server *Server, method, path string, body interface{}, headers map[string]string) (int, map[string]interface{}) {
+	t.Helper()
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &payload)
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	rec := httptest.NewRecorder()
+	server.router.ServeHTTP(rec, req)
+
+	response := map[string]interface{}{}
+	if rec.Body.Len() > 0 {
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("%s %s: resposta inválida %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+	return rec.Code, response
+}
+
+func TestLocalBackendLabLifecycle(t *testing.T) {
+	server := newLocalTestServer(t)
+
+	// Criação: a operação termina em segundo plano
+	code, created := doJSON(t, server, http.MethodPost, "/api/v1/labs", map[string]string{"templateId": "linux-basics"})
+	if code != http.StatusAccepted {
+		t.Fatalf("criação retornou %d: %v", code, created)
+	}
+	operationPath := "/api/v1/operations/" + created["operationId"].(string)
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		_, operation := doJSON(t, server, http.MethodGet, operationPath, nil)
+		if operation["status"] == OperationSucceeded {
+			break
+		}
+		if operation["status"] == OperationFailed || time.Now().After(deadline) {
+			t.Fatalf("operação não concluída: %v", operation)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// Consulta
+	code, lab := doJSON(t, server, http.MethodGet, "/api/v1/labs/current", nil)
+	if code != http.StatusOK {
+		t.Fatalf("consulta retornou %d: %v", code, lab)
+	}
+	if lab["namespace"] != "lab-test-user" || lab["status"] != "Running" || lab["templateId"] != "linux-basics" {
+		t.Fatalf("laboratório inesperado: %v", lab)
+	}
+	namespace, podName := lab["namespace"].(string), lab["podName"].(string)
+
+	// Execução: a validação roda o comando da tarefa como processo local
+	validatePath := "/api/v1/pods/" + namespace + "/" + podName + "/validate"
+	task := map[string]interface{}{"templateId": "linux-basics", "taskIndex": 0}
+	if _, result := doJSON(t, server, http.MethodPost, validatePath, task); result["success"] != false {
+		t.Fatalf("tarefa validada antes de ser feita: %v", result)
+	}
+	pod, err := server.labManager.GetPod(namespace, podName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, stderr, err := server.labManager.ExecuteCommandInPod(pod, []string{"/bin/sh", "-c", "touch hello.txt"}); err != nil {
+		t.Fatalf("erro ao executar comando: %v (%s)", err, stderr)
+	}
+	if _, result := doJSON(t, server, http.MethodPost, validatePath, task); result["success"] != true {
+		t.Fatalf("tarefa não validada: %v", result)
+	}
+
+	// Exclusão
+	if code, result := doJSON(t, server, http.MethodDelete, "/api/v1/labs/current", nil); code != http.StatusOK {
+		t.Fatalf("exclusão retornou %d: %v", code, result)
+	}
+	if code, _ := doJSON(t, server, http.MethodGet, "/api/v1/labs/current", nil); code != http.StatusNotFound {
+		t.Fatalf("laboratório ainda encontrado após a exclusão: %d", code)
+	}
+	if code, _ := doJSON(t, server, http.MethodDelete, "/api/v1/labs/current", nil); code != http.StatusNotFound {
+		t.Fatalf("segunda exclusão retornou %d", code)
+	}
+	workDir := filepath.Join(config.Lab.LocalWorkDir, namespace, podName)
+	if _, err := os.Stat(workDir); !os.IsNotExist(err) {
+		t.Fatalf("diretório do laboratório não removido: %v", err)
+	}
+}
+
+func TestUserResourcesRequireOwnerOrInstructor(t *testing.T) {
+	t.Setenv("GIRUS_TRUST_ROLE_HEADER", "true")
+	server := newLocalTestServer(t)
+	instructor := map[string]string{"X-Girus-Role": "instructor"}
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		headers map[string]string
+		want    int
+	}{
+		{"snapshots de outro usuário", http.MethodGet, "/api/v1/users/other/snapshots", nil, http.StatusForbidden},
+		{"snapshots do próprio usuário", http.MethodGet, "/api/v1/users/test-user/snapshots", nil, http.StatusOK},
+		{"snapshots de outro usuário por instrutor", http.MethodGet, "/api/v1/users/other/snapshots", instructor, http.StatusOK},
+		{"download de snapshot de outro usuário", http.MethodGet, "/api/v1/users/other/snapshots/snap-1/download", nil, http.StatusForbidden},
+		{"restauração de snapshot de outro usuário", http.MethodPost, "/api/v1/users/other/snapshots/snap-1/restore", nil, http.StatusForbidden},
+		{"exclusão de snapshot de outro usuário", http.MethodDelete, "/api/v1/users/other/snapshots/snap-1", nil, http.StatusForbidden},
+		{"workspaces de outro usuário", http.MethodGet, "/api/v1/users/other/workspaces", nil, http.StatusForbidden},
+		{"workspaces do próprio usuário", http.MethodGet, "/api/v1/users/test-user/workspaces", nil, http.StatusOK},
+		{"workspaces de outro usuário por instrutor", http.MethodGet, "/api/v1/users/other/workspaces", instructor, http.StatusOK},
+		{"exclusão de workspace de outro usuário", http.MethodDelete, "/api/v1/users/other/workspaces/default", nil, http.StatusForbidden},
+		{"usuário informado pela requisição", http.MethodGet, "/api/v1/users/other/snapshots?user_id=other", nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, body := doJSONWithHeaders(t, server, tt.method, tt.path, nil, tt.headers); code != tt.want {
+				t.Errorf("%s %s retornou %d, esperado %d: %v", tt.method, tt.path, code, tt.want, body)
+			}
+		})
+	}
+}
+
+func TestLabActionsRequireOwnerOrInstructor(t *testing.T) {
+	t.Setenv("GIRUS_TRUST_ROLE_HEADER", "true")
+	server := newLocalTestServer(t)
+	instructor := map[string]string{"X-Girus-Role": "instructor"}
+
+	// Laboratório de outro usuário sem pod nem acesso à API: quem passa pela
+	// verificação recebe o erro da própria operação
+	namespace := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:   "lab-other",
+		Labels: map[string]string{"createdBy": "girus", "userId": "other"},
+	}}
+	if _, err := server.labManager.clientset.CoreV1().Namespaces().Create(context.Background(), namespace, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		headers map[string]string
+		want    int
+	}{
+		{"pausa de laboratório de outro usuário", "/api/v1/labs/lab-other/pause", nil, http.StatusForbidden},
+		{"pausa por instrutor", "/api/v1/labs/lab-other/pause", instructor, http.StatusNotFound},
+		{"retomada de laboratório de outro usuário", "/api/v1/labs/lab-other/resume", nil, http.StatusForbidden},
+		{"retomada por instrutor", "/api/v1/labs/lab-other/resume", instructor, http.StatusConflict},
+		{"reinício de laboratório de outro usuário", "/api/v1/labs/lab-other/reset", nil, http.StatusForbidden},
+		{"reinício por instrutor", "/api/v1/labs/lab-other/reset", instructor, http.StatusNotFound},
+		{"extensão de laboratório de outro usuário", "/api/v1/labs/lab-other/extend", nil, http.StatusForbidden},
+		{"extensão por instrutor", "/api/v1/labs/lab-other/extend", instructor, http.StatusNotFound},
+		{"renovação de token de laboratório de outro usuário", "/api/v1/labs/lab-other/kubeconfig/rotate", nil, http.StatusForbidden},
+		{"renovação de token por instrutor", "/api/v1/labs/lab-other/kubeconfig/rotate", instructor, http.StatusBadRequest},
+		{"laboratório inexistente", "/api/v1/labs/lab-missing/pause", nil, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, body := doJSONWithHeaders(t, server, http.MethodPost, tt.path, nil, tt.headers); code != tt.want {
+				t.Errorf("POST %s retornou %d, esperado %d: %v", tt.path, code, tt.want, body)
+			}
+		})
+	}
+}
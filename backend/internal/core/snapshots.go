@@ -0,0 +1,507 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// restoreStatusAnnotation indica o andamento da restauração de um snapshot no pod
+	// ("pending", "completed" ou "failed"). O terminal só é aberto após a conclusão.
+	restoreStatusAnnotation = "girus.io/restore-status"
+	// restoreSnapshotAnnotation registra qual snapshot foi restaurado no pod
+	restoreSnapshotAnnotation = "girus.io/restore-snapshot"
+	// restoreMessageAnnotation registra o motivo de uma falha na restauração
+	restoreMessageAnnotation = "girus.io/restore-message"
+)
+
+// SnapshotSettings define quais caminhos do laboratório podem ser salvos em snapshots
+type SnapshotSettings struct {
+	Disabled bool     `json:"disabled,omitempty" yaml:"disabled"`
+	Paths    []string `json:"paths,omitempty" yaml:"paths"` // Caminhos absolutos dentro do contêiner do laboratório
+}
+
+// validate verifica se os caminhos declarados são absolutos e não saem da raiz
+func (s *SnapshotSettings) validate() error {
+	if s == nil {
+		return nil
+	}
+	for _, snapshotPath := range s.Paths {
+		if err := validateSnapshotPath(snapshotPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateSnapshotPath verifica um caminho de snapshot
+func validateSnapshotPath(snapshotPath string) error {
+	if !strings.HasPrefix(snapshotPath, "/") || path.Clean(snapshotPath) == "/" {
+		return fmt.Errorf("caminho de snapshot deve ser absoluto e diferente da raiz: %s", snapshotPath)
+	}
+	if strings.Contains(snapshotPath, "..") {
+		return fmt.Errorf("caminho de snapshot não pode conter \"..\": %s", snapshotPath)
+	}
+	return nil
+}
+
+// Snapshot descreve um arquivo com o estado salvo de um laboratório
+type Snapshot struct {
+	ID        string   `json:"id"`
+	UserID    string   `json:"userId"`
+	Template  string   `json:"template"`
+	Namespace string   `json:"namespace"`
+	PodName   string   `json:"podName"`
+	Paths     []string `json:"paths"`
+	Size      int64    `json:"size"`
+	CreatedAt string   `json:"createdAt"`
+}
+
+// SnapshotStore armazena os arquivos de snapshot e seus metadados
+type SnapshotStore interface {
+	// Save grava o conteúdo do snapshot e preenche snapshot.Size
+	Save(snapshot *Snapshot, content io.Reader) error
+	// Get obtém os metadados de um snapshot
+	Get(userID, id string) (*Snapshot, error)
+	// Open abre o conteúdo de um snapshot para leitura
+	Open(userID, id string) (io.ReadCloser, error)
+	// List lista os snapshots de um usuário
+	List(userID string) ([]Snapshot, error)
+	// Delete exclui um snapshot
+	Delete(userID, id string) error
+}
+
+var snapshotKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// snapshotResource identifica snapshots nos erros no formato da API do Kubernetes
+var snapshotResource = schema.GroupResource{Group: "girus.io", Resource: "snapshots"}
+
+// FileSnapshotStore guarda os snapshots em um diretório local, um subdiretório por usuário
+type FileSnapshotStore struct {
+	dir     string
+	maxSize int64
+}
+
+// NewFileSnapshotStore cria um armazenamento de snapshots em dir
+func NewFileSnapshotStore(dir string, maxSize int64) (*FileSnapshotStore, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("erro ao criar diretório de snapshots: %v", err)
+	}
+	return &FileSnapshotStore{dir: dir, maxSize: maxSize}, nil
+}
+
+// paths retorna os arquivos de conteúdo e de metadados de um snapshot
+func (s *FileSnapshotStore) paths(userID, id string) (string, string, error) {
+	if !snapshotKeyPattern.MatchString(userID) || !snapshotKeyPattern.MatchString(id) || strings.Contains(userID+id, "..") {
+		return "", "", fmt.Errorf("identificador de snapshot inválido")
+	}
+	base := filepath.Join(s.dir, userID, id)
+	return base + ".tar.gz", base + ".json", nil
+}
+
+// Save grava o snapshot, descartando o arquivo se o limite de tamanho for excedido
+func (s *FileSnapshotStore) Save(snapshot *Snapshot, content io.Reader) error {
+	archivePath, metadataPath, err := s.paths(snapshot.UserID, snapshot.ID)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(archivePath), 0750); err != nil {
+		return fmt.Errorf("erro ao criar diretório de snapshots: %v", err)
+	}
+
+	file, err := os.Create(archivePath)
+	if err != nil {
+		return fmt.Errorf("erro ao criar arquivo de snapshot: %v", err)
+	}
+	reader := content
+	if s.maxSize > 0 {
+		reader = io.LimitReader(content, s.maxSize+1)
+	}
+	size, err := io.Copy(file, reader)
+	file.Close()
+	if err == nil && s.maxSize > 0 && size > s.maxSize {
+		err = fmt.Errorf("snapshot excede o tamanho máximo de %d bytes", s.maxSize)
+	}
+	if err != nil {
+		os.Remove(archivePath)
+		return err
+	}
+
+	snapshot.Size = size
+	metadata, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		os.Remove(archivePath)
+		return err
+	}
+	if err := os.WriteFile(metadataPath, metadata, 0640); err != nil {
+		os.Remove(archivePath)
+		return fmt.Errorf("erro ao gravar metadados do snapshot: %v", err)
+	}
+	return nil
+}
+
+// Get lê os metadados de um snapshot
+func (s *FileSnapshotStore) Get(userID, id string) (*Snapshot, error) {
+	_, metadataPath, err := s.paths(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(metadataPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.NewNotFound(snapshotResource, id)
+		}
+		return nil, err
+	}
+	snapshot := &Snapshot{}
+	if err := json.Unmarshal(content, snapshot); err != nil {
+		return nil, fmt.Errorf("metadados do snapshot %s corrompidos: %v", id, err)
+	}
+	return snapshot, nil
+}
+
+// Open abre o arquivo de um snapshot
+func (s *FileSnapshotStore) Open(userID, id string) (io.ReadCloser, error) {
+	archivePath, _, err := s.paths(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(archivePath)
+}
+
+// List lista os snapshots de um usuário, do mais recente para o mais antigo
+func (s *FileSnapshotStore) List(userID string) ([]Snapshot, error) {
+	snapshots := []Snapshot{}
+	if !snapshotKeyPattern.MatchString(userID) {
+		return snapshots, nil
+	}
+	entries, err := os.ReadDir(filepath.Join(s.dir, userID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return snapshots, nil
+		}
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		snapshot, err := s.Get(userID, strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil {
+			log.Printf("[Snapshot] Ignorando %s: %v", entry.Name(), err)
+			continue
+		}
+		snapshots = append(snapshots, *snapshot)
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].CreatedAt > snapshots[j].CreatedAt })
+	return snapshots, nil
+}
+
+// Delete remove o conteúdo e os metadados de um snapshot
+func (s *FileSnapshotStore) Delete(userID, id string) error {
+	archivePath, metadataPath, err := s.paths(userID, id)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(metadataPath); os.IsNotExist(err) {
+		return errors.NewNotFound(snapshotResource, id)
+	}
+	os.Remove(archivePath)
+	return os.Remove(metadataPath)
+}
+
+// snapshotPaths retorna os caminhos que podem ser salvos para o template
+func snapshotPaths(template *LabTemplate) []string {
+	if template != nil && template.Snapshot != nil && len(template.Snapshot.Paths) > 0 {
+		return template.Snapshot.Paths
+	}
+	return config.Lab.Snapshot.DefaultPaths
+}
+
+// selectSnapshotPaths restringe os caminhos solicitados aos permitidos pelo template
+func selectSnapshotPaths(allowed, requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return allowed, nil
+	}
+	selected := []string{}
+	for _, requestedPath := range requested {
+		if err := validateSnapshotPath(requestedPath); err != nil {
+			return nil, err
+		}
+		cleaned := path.Clean(requestedPath)
+		permitted := false
+		for _, allowedPath := range allowed {
+			allowedPath = path.Clean(allowedPath)
+			if cleaned == allowedPath || strings.HasPrefix(cleaned, allowedPath+"/") {
+				permitted = true
+				break
+			}
+		}
+		if !permitted {
+			return nil, fmt.Errorf("caminho %s não pode ser incluído no snapshot deste laboratório", requestedPath)
+		}
+		selected = append(selected, cleaned)
+	}
+	return selected, nil
+}
+
+// shellQuote protege um argumento para uso em um comando sh
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// snapshotArchiveCommand gera o comando que empacota os caminhos existentes na saída padrão.
+// Os caminhos são relativos a GIRUS_LAB_ROOT (raiz do laboratório no backend local) ou a "/".
+func snapshotArchiveCommand(paths []string) []string {
+	quoted := make([]string, 0, len(paths))
+	for _, snapshotPath := range paths {
+		quoted = append(quoted, shellQuote(strings.TrimPrefix(path.Clean(snapshotPath), "/")))
+	}
+	script := fmt.Sprintf(`cd "${GIRUS_LAB_ROOT:-/}" && set -- && for p in %s; do [ -e "$p" ] && set -- "$@" "$p"; done; `+
+		`if [ $# -eq 0 ]; then tar -czf - -T /dev/null; else tar -czf - -- "$@"; fi`, strings.Join(quoted, " "))
+	return []string{"/bin/sh", "-c", script}
+}
+
+// snapshotRestoreCommand gera o comando que extrai um snapshot recebido pela entrada padrão
+func snapshotRestoreCommand() []string {
+	return []string{"/bin/sh", "-c", `cd "${GIRUS_LAB_ROOT:-/}" && tar -xzf -`}
+}
+
+// newSnapshotID gera um identificador ordenável por data de criação
+func newSnapshotID() string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%s-%s", time.Now().UTC().Format("20060102-150405"), hex.EncodeToString(suffix))
+}
+
+// CreateSnapshot salva os caminhos selecionados do laboratório em um snapshot
+func (lm *LabManager) CreateSnapshot(namespace, podName string, requestedPaths []string) (*Snapshot, error) {
+	if lm.snapshots == nil {
+		return nil, fmt.Errorf("snapshots estão desabilitados")
+	}
+
+	pod, err := lm.GetPod(namespace, podName)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao obter pod: %v", err)
+	}
+	userID := pod.Labels["user"]
+	if userID == "" {
+		return nil, fmt.Errorf("o pod %s/%s não pertence a um usuário", namespace, podName)
+	}
+	templateName := pod.Labels["template"]
+	template := lm.GetTemplate(templateName)
+	if template != nil && template.Snapshot != nil && template.Snapshot.Disabled {
+		return nil, fmt.Errorf("o template %s não permite snapshots", templateName)
+	}
+
+	paths, err := selectSnapshotPaths(snapshotPaths(template), requestedPaths)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("nenhum caminho configurado para snapshots do template %s", templateName)
+	}
+
+	snapshot := &Snapshot{
+		ID:        newSnapshotID(),
+		UserID:    userID,
+		Template:  templateName,
+		Namespace: namespace,
+		PodName:   podName,
+		Paths:     paths,
+		CreatedAt: time.Now().Format(time.RFC3339),
+	}
+	log.Printf("[Snapshot] Criando snapshot %s do pod %s/%s: %v", snapshot.ID, namespace, podName, paths)
+
+	// Transmitir o tar gerado no contêiner diretamente para o armazenamento
+	reader, writer := io.Pipe()
+	var stderr strings.Builder
+	execDone := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+		err := lm.backend.Exec(ctx, pod, ExecOptions{
+			Container: labContainerName,
+			Command:   snapshotArchiveCommand(paths),
+			Stdout:    writer,
+			Stderr:    &stderr,
+		})
+		writer.CloseWithError(err)
+		execDone <- err
+	}()
+
+	saveErr := lm.snapshots.Save(snapshot, reader)
+	reader.Close()
+	execErr := <-execDone
+	switch {
+	case saveErr != nil && saveErr != execErr:
+		// Falha do armazenamento (ex.: tamanho máximo excedido) interrompe o exec
+		return nil, fmt.Errorf("erro ao salvar snapshot: %v", saveErr)
+	case execErr != nil:
+		if saveErr == nil {
+			lm.snapshots.Delete(userID, snapshot.ID)
+		}
+		return nil, fmt.Errorf("erro ao empacotar arquivos do laboratório: %v %s", execErr, strings.TrimSpace(stderr.String()))
+	}
+
+	log.Printf("[Snapshot] Snapshot %s salvo (%d bytes)", snapshot.ID, snapshot.Size)
+	return snapshot, nil
+}
+
+// ListSnapshots lista os snapshots de um usuário
+func (lm *LabManager) ListSnapshots(userID string) ([]Snapshot, error) {
+	if lm.snapshots == nil {
+		return []Snapshot{}, nil
+	}
+	return lm.snapshots.List(userID)
+}
+
+// GetSnapshot obtém os metadados e o conteúdo de um snapshot
+func (lm *LabManager) GetSnapshot(userID, id string) (*Snapshot, io.ReadCloser, error) {
+	if lm.snapshots == nil {
+		return nil, nil, fmt.Errorf("snapshots estão desabilitados")
+	}
+	snapshot, err := lm.snapshots.Get(userID, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	content, err := lm.snapshots.Open(userID, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return snapshot, content, nil
+}
+
+// DeleteSnapshot exclui um snapshot de um usuário
+func (lm *LabManager) DeleteSnapshot(userID, id string) error {
+	if lm.snapshots == nil {
+		return fmt.Errorf("snapshots estão desabilitados")
+	}
+	return lm.snapshots.Delete(userID, id)
+}
+
+// CreateLabFromSnapshot cria um novo laboratório com o template do snapshot e
+// restaura o snapshot nele assim que o pod estiver pronto. Até lá o pod fica
+// anotado como "pending" e o terminal não é aberto. O snapshot nunca é extraído
+// sobre um laboratório em uso: o laboratório atual é substituído pelo novo ou,
+// com a política "reject", a restauração é recusada.
+func (lm *LabManager) CreateLabFromSnapshot(userID, snapshotID string) (*Snapshot, error) {
+	if lm.snapshots == nil {
+		return nil, fmt.Errorf("snapshots estão desabilitados")
+	}
+	snapshot, err := lm.snapshots.Get(userID, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	template := lm.GetTemplate(snapshot.Template)
+	if template == nil {
+		return nil, fmt.Errorf("template %s do snapshot não encontrado", snapshot.Template)
+	}
+
+	if existingLabPolicy() == ExistingLabReject {
+		running, err := lm.runningLab(userID)
+		if err != nil {
+			return nil, err
+		}
+		if running != nil {
+			return nil, errors.NewConflict(labResource, running.Namespace,
+				fmt.Errorf("exclua o laboratório em execução antes de restaurar o snapshot"))
+		}
+	}
+
+	pod, err := lm.createLabFromTemplate(userID, template, labCreateOptions{fresh: true}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := lm.setRestoreStatus(pod, snapshot.ID, "pending", ""); err != nil {
+		return nil, fmt.Errorf("erro ao marcar restauração do snapshot: %v", err)
+	}
+
+	go lm.restoreSnapshot(pod, snapshot)
+	return snapshot, nil
+}
+
+// restoreSnapshot aguarda o pod ficar pronto e extrai o snapshot no contêiner do laboratório
+func (lm *LabManager) restoreSnapshot(pod *v1.Pod, snapshot *Snapshot) {
+	fail := func(err error) {
+		log.Printf("[Snapshot] Falha ao restaurar snapshot %s em %s/%s: %v", snapshot.ID, pod.Namespace, pod.Name, err)
+		if err := lm.setRestoreStatus(pod, snapshot.ID, "failed", err.Error()); err != nil {
+			log.Printf("[Snapshot] Erro ao registrar falha da restauração: %v", err)
+		}
+	}
+
+	if err := WaitForPodReady(lm.clientset, pod, 10*time.Minute); err != nil {
+		fail(err)
+		return
+	}
+	// O snapshot sobrescreve os arquivos entregues pelo template
+	if err := lm.waitForPrepared(pod, prepareTimeout); err != nil {
+		fail(err)
+		return
+	}
+
+	content, err := lm.snapshots.Open(snapshot.UserID, snapshot.ID)
+	if err != nil {
+		fail(err)
+		return
+	}
+	defer content.Close()
+
+	var stderr strings.Builder
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	err = lm.backend.Exec(ctx, pod, ExecOptions{
+		Container: labContainerName,
+		Command:   snapshotRestoreCommand(),
+		Stdin:     content,
+		Stderr:    &stderr,
+	})
+	if err != nil {
+		fail(fmt.Errorf("%v %s", err, strings.TrimSpace(stderr.String())))
+		return
+	}
+
+	if err := lm.setRestoreStatus(pod, snapshot.ID, "completed", ""); err != nil {
+		log.Printf("[Snapshot] Erro ao registrar conclusão da restauração: %v", err)
+		return
+	}
+	log.Printf("[Snapshot] Snapshot %s restaurado em %s/%s", snapshot.ID, pod.Namespace, pod.Name)
+}
+
+// setRestoreStatus atualiza as anotações de restauração do pod
+func (lm *LabManager) setRestoreStatus(pod *v1.Pod, snapshotID, status, message string) error {
+	_, err := lm.updateLabPod(pod.Namespace, pod.Name, func(current *v1.Pod) {
+		if current.Annotations == nil {
+			current.Annotations = map[string]string{}
+		}
+		current.Annotations[restoreStatusAnnotation] = status
+		current.Annotations[restoreSnapshotAnnotation] = snapshotID
+		if message != "" {
+			current.Annotations[restoreMessageAnnotation] = message
+		} else {
+			delete(current.Annotations, restoreMessageAnnotation)
+		}
+	})
+	return err
+}
+
+// restorePending indica se o pod ainda aguarda a restauração de um snapshot
+func restorePending(pod *v1.Pod) bool {
+	return pod.Annotations[restoreStatusAnnotation] == "pending"
+}
@@ -0,0 +1,64 @@
+package core
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// terminalResetCode é o código de fechamento enviado aos terminais de um
+// laboratório reiniciado; o cliente deve reconectar ao novo pod
+const terminalResetCode = 4000
+
+// TerminalRegistry guarda as conexões de terminal abertas por laboratório
+type TerminalRegistry struct {
+	mu    sync.Mutex
+	conns map[string]map[*websocket.Conn]struct{}
+}
+
+// NewTerminalRegistry cria um registro de terminais vazio
+func NewTerminalRegistry() *TerminalRegistry {
+	return &TerminalRegistry{conns: make(map[string]map[*websocket.Conn]struct{})}
+}
+
+// Register associa a conexão ao laboratório; a função retornada a remove
+func (r *TerminalRegistry) Register(labID string, conn *websocket.Conn) func() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conns[labID] == nil {
+		r.conns[labID] = make(map[*websocket.Conn]struct{})
+	}
+	r.conns[labID][conn] = struct{}{}
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.conns[labID], conn)
+		if len(r.conns[labID]) == 0 {
+			delete(r.conns, labID)
+		}
+	}
+}
+
+// Disconnect encerra os terminais do laboratório com o código de reconexão e
+// retorna quantos foram avisados. WriteControl e Close podem ser chamados
+// enquanto o stream do terminal ainda escreve na conexão.
+func (r *TerminalRegistry) Disconnect(labID string, code int, reason string) int {
+	r.mu.Lock()
+	conns := make([]*websocket.Conn, 0, len(r.conns[labID]))
+	for conn := range r.conns[labID] {
+		conns = append(conns, conn)
+	}
+	delete(r.conns, labID)
+	r.mu.Unlock()
+
+	for _, conn := range conns {
+		message := websocket.FormatCloseMessage(code, reason)
+		if err := conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second)); err != nil {
+			log.Printf("[Terminal] Erro ao avisar terminal do laboratório %s: %v", labID, err)
+		}
+		conn.Close()
+	}
+	return len(conns)
+}
@@ -0,0 +1,420 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// poolLabel identifica namespaces e pods do warm pool ("idle" ou "assigned")
+	poolLabel = "girus.io/pool"
+	// startedAtAnnotation registra quando o laboratório foi entregue ao usuário
+	startedAtAnnotation = "girus.io/started-at"
+)
+
+// WarmPool mantém laboratórios pré-provisionados prontos para entrega imediata.
+// Cada laboratório do pool vive em um namespace próprio (lab-pool-*), que passa
+// a pertencer ao usuário quando é entregue.
+type WarmPool struct {
+	lm          *LabManager
+	cfg         WarmPoolConfig
+	mu          sync.Mutex
+	assignments map[string]string // userID -> namespace entregue pelo pool
+	claiming    map[string]bool   // Namespaces sendo entregues por esta réplica
+	replenish   chan struct{}
+}
+
+// PoolTemplateStats resume o estado do pool para um template
+type PoolTemplateStats struct {
+	Template     string `json:"template"`
+	MinIdle      int    `json:"minIdle"`
+	Ready        int    `json:"ready"`
+	Provisioning int    `json:"provisioning"`
+	Assigned     int    `json:"assigned"`
+}
+
+// PoolStats resume o estado do warm pool
+type PoolStats struct {
+	Enabled   bool                `json:"enabled"`
+	MaxTotal  int                 `json:"maxTotal"`
+	Idle      int                 `json:"idle"`
+	Templates []PoolTemplateStats `json:"templates"`
+}
+
+// NewWarmPool cria o warm pool do LabManager
+func NewWarmPool(lm *LabManager, cfg WarmPoolConfig) *WarmPool {
+	return &WarmPool{
+		lm:          lm,
+		cfg:         cfg,
+		assignments: make(map[string]string),
+		claiming:    make(map[string]bool),
+		replenish:   make(chan struct{}, 1),
+	}
+}
+
+// Start recupera as entregas existentes e inicia a reposição em segundo plano
+func (p *WarmPool) Start(ctx context.Context) {
+	p.loadAssignments()
+
+	interval, err := time.ParseDuration(p.cfg.ReplenishInterval)
+	if err != nil || interval <= 0 {
+		interval = 30 * time.Second
+	}
+	log.Printf("Iniciando warm pool (máximo %d laboratórios ociosos, reposição a cada %s)", p.cfg.MaxTotal, interval)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		p.fill()
+		for {
+			select {
+			case <-ticker.C:
+				p.fill()
+			case <-p.replenish:
+				p.fill()
+			case <-ctx.Done():
+				log.Printf("Warm pool encerrado")
+				return
+			}
+		}
+	}()
+}
+
+// minIdleFor retorna o mínimo de laboratórios ociosos configurado para o template
+func (p *WarmPool) minIdleFor(templateName string) int {
+	if minIdle, ok := p.cfg.MinIdle[templateName]; ok {
+		return minIdle
+	}
+	return p.cfg.DefaultMinIdle
+}
+
+// NamespaceFor retorna o namespace entregue pelo pool ao usuário, se houver
+func (p *WarmPool) NamespaceFor(userID string) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	namespace, ok := p.assignments[userID]
+	return namespace, ok
+}
+
+// Release esquece a entrega feita ao usuário (o namespace foi removido)
+func (p *WarmPool) Release(userID string) {
+	p.mu.Lock()
+	delete(p.assignments, userID)
+	p.mu.Unlock()
+}
+
+// Discard exclui o laboratório entregue ao usuário pelo pool, se houver
+func (p *WarmPool) Discard(userID string) {
+	p.mu.Lock()
+	namespace, ok := p.assignments[userID]
+	delete(p.assignments, userID)
+	p.mu.Unlock()
+
+	if ok {
+		log.Printf("[Warm Pool] Descartando laboratório %s entregue ao usuário %s", namespace, userID)
+		go p.lm.deleteNamespace(namespace)
+	}
+}
+
+// loadAssignments reconstrói o mapa de entregas a partir dos rótulos dos namespaces
+func (p *WarmPool) loadAssignments() {
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+	namespaces, err := p.lm.clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{
+		LabelSelector: poolLabel + "=assigned",
+	})
+	if err != nil {
+		log.Printf("[Warm Pool] Erro ao recuperar laboratórios entregues: %v", err)
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, ns := range namespaces.Items {
+		if userID := ns.Labels["userId"]; userID != "" {
+			p.assignments[userID] = ns.Name
+		}
+	}
+	log.Printf("[Warm Pool] %d laboratórios entregues recuperados", len(p.assignments))
+}
+
+// Claim entrega ao usuário um laboratório ocioso e pronto do template, se existir.
+// A entrega rotula o namespace e o pod com o usuário e dispara a reposição do pool.
+// As chamadas à API são feitas fora do lock, que protege apenas os mapas do pool.
+func (p *WarmPool) Claim(userID, templateName string) (string, string, bool) {
+	if p.minIdleFor(templateName) <= 0 {
+		return "", "", false
+	}
+
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+	pods, err := p.lm.backend.ListLabs(ctx, "", metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("app=girus-lab,%s=idle,template=%s", poolLabel, templateName),
+	})
+	if err != nil {
+		log.Printf("[Warm Pool] Erro ao listar laboratórios ociosos: %v", err)
+		return "", "", false
+	}
+
+	for i := range pods {
+		pod := &pods[i]
+		if !podIsReady(pod) || !p.reserve(pod.Namespace) {
+			continue
+		}
+		claimed := p.transfer(ctx, pod, userID)
+		p.mu.Lock()
+		delete(p.claiming, pod.Namespace)
+		if claimed {
+			// Um laboratório entregue anteriormente pelo pool é substituído pelo novo
+			if previous, ok := p.assignments[userID]; ok && previous != pod.Namespace {
+				go p.lm.deleteNamespace(previous)
+			}
+			p.assignments[userID] = pod.Namespace
+		}
+		p.mu.Unlock()
+		if !claimed {
+			continue
+		}
+		p.trigger()
+
+		log.Printf("[Warm Pool] Laboratório %s/%s (%s) entregue ao usuário %s", pod.Namespace, pod.Name, templateName, userID)
+		return pod.Namespace, pod.Name, true
+	}
+
+	p.trigger()
+	return "", "", false
+}
+
+// reserve impede que duas entregas simultâneas desta réplica disputem o mesmo namespace
+func (p *WarmPool) reserve(namespace string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.claiming[namespace] {
+		return false
+	}
+	p.claiming[namespace] = true
+	return true
+}
+
+// transfer rotula o namespace e o pod ociosos com o usuário. Se o pod não puder
+// ser transferido, o namespace volta a ficar ocioso.
+func (p *WarmPool) transfer(ctx context.Context, pod *v1.Pod, userID string) bool {
+	// Transferir o namespace para o usuário; um conflito indica que outra réplica o entregou
+	ns, err := p.lm.clientset.CoreV1().Namespaces().Get(ctx, pod.Namespace, metav1.GetOptions{})
+	if err != nil || ns.Labels[poolLabel] != "idle" {
+		return false
+	}
+	now := time.Now().Format(time.RFC3339)
+	ns.Labels[poolLabel] = "assigned"
+	ns.Labels["userId"] = userID
+	if ns.Annotations == nil {
+		ns.Annotations = map[string]string{}
+	}
+	ns.Annotations[startedAtAnnotation] = now
+	updated, err := p.lm.clientset.CoreV1().Namespaces().Update(ctx, ns, metav1.UpdateOptions{})
+	if err != nil {
+		if !errors.IsConflict(err) {
+			log.Printf("[Warm Pool] Erro ao transferir namespace %s: %v", ns.Name, err)
+		}
+		return false
+	}
+
+	// Transferir o pod para o usuário
+	pod.Labels[poolLabel] = "assigned"
+	pod.Labels["user"] = userID
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	pod.Annotations[startedAtAnnotation] = now
+	if _, err := p.lm.clientset.CoreV1().Pods(pod.Namespace).Update(ctx, pod, metav1.UpdateOptions{}); err != nil {
+		log.Printf("[Warm Pool] Erro ao transferir pod %s/%s: %v", pod.Namespace, pod.Name, err)
+		updated.Labels[poolLabel] = "idle"
+		delete(updated.Labels, "userId")
+		delete(updated.Annotations, startedAtAnnotation)
+		if _, err := p.lm.clientset.CoreV1().Namespaces().Update(ctx, updated, metav1.UpdateOptions{}); err != nil {
+			log.Printf("[Warm Pool] Erro ao devolver o namespace %s ao pool: %v", updated.Name, err)
+		}
+		return false
+	}
+	return true
+}
+
+// trigger solicita uma reposição do pool sem bloquear
+func (p *WarmPool) trigger() {
+	select {
+	case p.replenish <- struct{}{}:
+	default:
+	}
+}
+
+// idlePods lista os pods ociosos do pool agrupados por template
+func (p *WarmPool) idlePods() (map[string][]v1.Pod, error) {
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+	pods, err := p.lm.backend.ListLabs(ctx, "", metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("app=girus-lab,%s=idle", poolLabel),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	byTemplate := make(map[string][]v1.Pod)
+	for _, pod := range pods {
+		byTemplate[pod.Labels["template"]] = append(byTemplate[pod.Labels["template"]], pod)
+	}
+	return byTemplate, nil
+}
+
+// fill remove laboratórios ociosos com falha e provisiona os que faltam
+func (p *WarmPool) fill() {
+	byTemplate, err := p.idlePods()
+	if err != nil {
+		log.Printf("[Warm Pool] Erro ao listar laboratórios ociosos: %v", err)
+		return
+	}
+
+	total := 0
+	for templateName, pods := range byTemplate {
+		healthy := pods[:0]
+		for _, pod := range pods {
+			if pod.Status.Phase == v1.PodFailed || pod.Status.Phase == v1.PodSucceeded || pod.Annotations[prepareStatusAnnotation] == prepareStatusFailed {
+				log.Printf("[Warm Pool] Removendo laboratório ocioso com falha %s/%s", pod.Namespace, pod.Name)
+				p.lm.deleteNamespace(pod.Namespace)
+				continue
+			}
+			healthy = append(healthy, pod)
+		}
+		byTemplate[templateName] = healthy
+		total += len(healthy)
+	}
+
+	for _, template := range p.lm.templates.ListTemplates() {
+		missing := p.minIdleFor(template.Name) - len(byTemplate[template.Name])
+		for ; missing > 0; missing-- {
+			if p.cfg.MaxTotal > 0 && total >= p.cfg.MaxTotal {
+				log.Printf("[Warm Pool] Limite de %d laboratórios ociosos atingido", p.cfg.MaxTotal)
+				return
+			}
+			if err := p.provision(template); err != nil {
+				log.Printf("[Warm Pool] Erro ao provisionar laboratório para %s: %v", template.Name, err)
+				break
+			}
+			total++
+		}
+	}
+}
+
+// provision cria um laboratório ocioso do template em um namespace próprio do pool
+func (p *WarmPool) provision(template *LabTemplate) error {
+	runtime, err := ResolveRuntime(template)
+	if err != nil {
+		return err
+	}
+
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	namespace := fmt.Sprintf("lab-pool-%s", hex.EncodeToString(suffix))
+	podName := generateUniquePodName("lab", "pool-"+hex.EncodeToString(suffix))
+
+	err = p.lm.ensureNamespace(namespace, map[string]string{
+		"createdBy": "girus",
+		"template":  template.Name,
+		poolLabel:   "idle",
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = p.lm.provisionLab(namespace, podName, template, runtime, map[string]string{
+		"app":      "girus-lab",
+		"user":     "",
+		"template": template.Name,
+		poolLabel:  "idle",
+	}, nil)
+	if err != nil {
+		p.lm.deleteNamespace(namespace)
+		return err
+	}
+
+	log.Printf("[Warm Pool] Laboratório ocioso %s/%s provisionado para %s", namespace, podName, template.Name)
+	return nil
+}
+
+// Stats retorna o estado atual do pool por template
+func (p *WarmPool) Stats() (PoolStats, error) {
+	stats := PoolStats{
+		Enabled:  true,
+		MaxTotal: p.cfg.MaxTotal,
+	}
+
+	byTemplate, err := p.idlePods()
+	if err != nil {
+		return stats, err
+	}
+
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+	assigned, err := p.lm.clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{
+		LabelSelector: poolLabel + "=assigned",
+	})
+	if err != nil {
+		return stats, err
+	}
+	assignedByTemplate := make(map[string]int)
+	for _, ns := range assigned.Items {
+		assignedByTemplate[ns.Labels["template"]]++
+	}
+
+	names := map[string]bool{}
+	for _, template := range p.lm.templates.ListTemplates() {
+		names[template.Name] = true
+	}
+	for name := range byTemplate {
+		names[name] = true
+	}
+
+	for name := range names {
+		templateStats := PoolTemplateStats{
+			Template: name,
+			MinIdle:  p.minIdleFor(name),
+			Assigned: assignedByTemplate[name],
+		}
+		for i := range byTemplate[name] {
+			if podIsReady(&byTemplate[name][i]) {
+				templateStats.Ready++
+			} else {
+				templateStats.Provisioning++
+			}
+		}
+		stats.Idle += templateStats.Ready + templateStats.Provisioning
+		stats.Templates = append(stats.Templates, templateStats)
+	}
+	sort.Slice(stats.Templates, func(i, j int) bool {
+		return stats.Templates[i].Template < stats.Templates[j].Template
+	})
+	return stats, nil
+}
+
+// podIsReady verifica, sem consultar o cluster, se o pod está em execução, pronto e preparado
+func podIsReady(pod *v1.Pod) bool {
+	if pod.Status.Phase != v1.PodRunning || !prepared(pod) {
+		return false
+	}
+	for _, containerStatus := range pod.Status.ContainerStatuses {
+		if !containerStatus.Ready {
+			return false
+		}
+	}
+	return len(pod.Status.ContainerStatuses) > 0
+}
@@ -0,0 +1,152 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newTestWarmPool cria um warm pool com os laboratórios informados ociosos
+func newTestWarmPool(t *testing.T, idle []string) (*WarmPool, *LabManager) {
+	t.Helper()
+	running := []testLab{}
+	for _, namespace := range idle {
+		running = append(running, testLab{namespace, "pool", "linux", ""})
+	}
+	lm := newTestLabManager(t, running)
+	for _, namespace := range idle {
+		err := lm.updateNamespace(namespace, func(ns *v1.Namespace) bool {
+			ns.Labels[poolLabel] = "idle"
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := lm.updateLabPod(namespace, namespace+"-pod", func(pod *v1.Pod) {
+			pod.Labels[poolLabel] = "idle"
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pool := NewWarmPool(lm, WarmPoolConfig{DefaultMinIdle: 1})
+	lm.pool = pool
+	return pool, lm
+}
+
+// poolState lê o namespace e o pod do laboratório do pool
+func poolState(t *testing.T, lm *LabManager, namespace string) (*v1.Namespace, *v1.Pod) {
+	t.Helper()
+	ns, err := lm.getNamespace(namespace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pod, err := lm.getLabPod(namespace, namespace+"-pod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ns, pod
+}
+
+func TestWarmPoolClaim(t *testing.T) {
+	pool, lm := newTestWarmPool(t, []string{"lab-pool-a"})
+
+	if _, _, ok := pool.Claim("u1", "docker"); ok {
+		t.Fatal("laboratório de outro template entregue")
+	}
+	namespace, podName, ok := pool.Claim("u1", "linux")
+	if !ok || namespace != "lab-pool-a" || podName != "lab-pool-a-pod" {
+		t.Fatalf("Claim() = %s, %s, %v", namespace, podName, ok)
+	}
+
+	ns, pod := poolState(t, lm, namespace)
+	if ns.Labels[poolLabel] != "assigned" || ns.Labels["userId"] != "u1" || ns.Annotations[startedAtAnnotation] == "" {
+		t.Errorf("namespace não transferido: labels %v, anotações %v", ns.Labels, ns.Annotations)
+	}
+	if pod.Labels[poolLabel] != "assigned" || pod.Labels["user"] != "u1" || pod.Annotations[startedAtAnnotation] != ns.Annotations[startedAtAnnotation] {
+		t.Errorf("pod não transferido: labels %v, anotações %v", pod.Labels, pod.Annotations)
+	}
+	if got := lm.namespaceForUser("u1"); got != namespace {
+		t.Errorf("namespace do usuário = %s, esperado %s", got, namespace)
+	}
+	if _, _, ok := pool.Claim("u2", "linux"); ok {
+		t.Error("laboratório entregue duas vezes")
+	}
+}
+
+func TestWarmPoolConcurrentClaim(t *testing.T) {
+	idle := []string{"lab-pool-a", "lab-pool-b"}
+	pool, lm := newTestWarmPool(t, idle)
+
+	const users = 8
+	var wg sync.WaitGroup
+	claimed := make([]string, users)
+	for i := 0; i < users; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if namespace, _, ok := pool.Claim(fmt.Sprintf("u%d", i), "linux"); ok {
+				claimed[i] = namespace
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	owners := map[string]string{}
+	for i, namespace := range claimed {
+		if namespace == "" {
+			continue
+		}
+		if owner, ok := owners[namespace]; ok {
+			t.Fatalf("namespace %s entregue a %s e a u%d", namespace, owner, i)
+		}
+		owners[namespace] = fmt.Sprintf("u%d", i)
+	}
+	if len(owners) != len(idle) {
+		t.Fatalf("%d laboratórios entregues, esperado %d: %v", len(owners), len(idle), owners)
+	}
+	for namespace, user := range owners {
+		ns, pod := poolState(t, lm, namespace)
+		if ns.Labels["userId"] != user || pod.Labels["user"] != user {
+			t.Errorf("%s entregue a %s, mas rotulado para %s (pod: %s)", namespace, user, ns.Labels["userId"], pod.Labels["user"])
+		}
+		if got, _ := pool.NamespaceFor(user); got != namespace {
+			t.Errorf("entrega de %s registrada como %q", user, got)
+		}
+	}
+}
+
+func TestWarmPoolClaimRollback(t *testing.T) {
+	pool, lm := newTestWarmPool(t, []string{"lab-pool-a"})
+	clientset := lm.backend.(*LocalBackend).clientset
+	failing := true
+	clientset.PrependReactor("update", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if failing {
+			return true, nil, fmt.Errorf("falha simulada")
+		}
+		return false, nil, nil
+	})
+
+	if _, _, ok := pool.Claim("u1", "linux"); ok {
+		t.Fatal("laboratório entregue apesar da falha ao transferir o pod")
+	}
+	ns, pod := poolState(t, lm, "lab-pool-a")
+	if ns.Labels[poolLabel] != "idle" || ns.Labels["userId"] != "" || ns.Annotations[startedAtAnnotation] != "" {
+		t.Errorf("namespace não devolvido ao pool: labels %v, anotações %v", ns.Labels, ns.Annotations)
+	}
+	if pod.Labels[poolLabel] != "idle" {
+		t.Errorf("pod fora do pool: labels %v", pod.Labels)
+	}
+	if _, ok := pool.NamespaceFor("u1"); ok {
+		t.Error("entrega registrada apesar da falha")
+	}
+
+	// O laboratório devolvido pode ser entregue na próxima tentativa
+	failing = false
+	if namespace, _, ok := pool.Claim("u1", "linux"); !ok || namespace != "lab-pool-a" {
+		t.Fatalf("Claim() após a falha = %s, %v", namespace, ok)
+	}
+}
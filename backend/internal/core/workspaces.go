@@ -0,0 +1,342 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// workspaceVolumeName é o nome do volume do workspace no pod do laboratório
+	workspaceVolumeName = "girus-workspace"
+	// lastUsedAnnotation registra a última vez que o workspace foi montado em um laboratório
+	lastUsedAnnotation = "girus.io/last-used"
+)
+
+// WorkspaceSettings permite que o template ajuste o workspace persistente
+type WorkspaceSettings struct {
+	Disabled  bool   `json:"disabled,omitempty" yaml:"disabled"`
+	MountPath string `json:"mountPath,omitempty" yaml:"mountPath"`
+	Size      string `json:"size,omitempty" yaml:"size"` // Limitado por WorkspaceConfig.MaxSize
+}
+
+// validate verifica o tamanho solicitado pelo template
+func (w *WorkspaceSettings) validate() error {
+	if w == nil || w.Size == "" {
+		return nil
+	}
+	if _, err := resource.ParseQuantity(w.Size); err != nil {
+		return fmt.Errorf("tamanho inválido (%q): %v", w.Size, err)
+	}
+	return nil
+}
+
+// WorkspaceInfo descreve um workspace persistente de um usuário
+type WorkspaceInfo struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Template  string `json:"template,omitempty"`
+	Size      string `json:"size"`
+	Status    string `json:"status"`
+	InUse     bool   `json:"inUse"`
+	CreatedAt string `json:"createdAt"`
+	LastUsed  string `json:"lastUsed,omitempty"`
+	ExpiresAt string `json:"expiresAt,omitempty"`
+}
+
+// WorkspaceManager mantém os PersistentVolumeClaims que preservam o trabalho dos
+// usuários entre sessões de laboratório. Os PVCs ficam no namespace lab-<userID>,
+// que deixa de ser excluído junto com o laboratório quando os workspaces estão habilitados.
+type WorkspaceManager struct {
+	lm  *LabManager
+	cfg WorkspaceConfig
+}
+
+// NewWorkspaceManager cria o gerenciador de workspaces do LabManager
+func NewWorkspaceManager(lm *LabManager, cfg WorkspaceConfig) *WorkspaceManager {
+	return &WorkspaceManager{lm: lm, cfg: cfg}
+}
+
+// workspaceNamespace retorna o namespace onde ficam os workspaces do usuário
+func workspaceNamespace(userID string) string {
+	return fmt.Sprintf("lab-%s", userID)
+}
+
+var workspaceNamePattern = regexp.MustCompile(`[^a-z0-9-]`)
+
+// claimName retorna o nome do PVC conforme o escopo configurado
+func (w *WorkspaceManager) claimName(templateName string) string {
+	if w.cfg.Scope != "user-template" {
+		return "workspace"
+	}
+	name := "workspace-" + workspaceNamePattern.ReplaceAllString(strings.ToLower(templateName), "-")
+	if len(name) > 63 {
+		name = name[:63]
+	}
+	return strings.TrimSuffix(name, "-")
+}
+
+// AppliesTo indica se os laboratórios do template recebem um workspace persistente
+func (w *WorkspaceManager) AppliesTo(template *LabTemplate) bool {
+	return template.Workspace == nil || !template.Workspace.Disabled
+}
+
+// Volume garante que o PVC do usuário exista e retorna o volume e o ponto de montagem do workspace
+func (w *WorkspaceManager) Volume(userID string, template *LabTemplate) (v1.Volume, v1.VolumeMount, error) {
+	namespace := workspaceNamespace(userID)
+	name := w.claimName(template.Name)
+
+	mountPath := w.cfg.MountPath
+	size := w.cfg.Size
+	if template.Workspace != nil {
+		if template.Workspace.MountPath != "" {
+			mountPath = template.Workspace.MountPath
+		}
+		if template.Workspace.Size != "" {
+			size = template.Workspace.Size
+		}
+	}
+	if w.cfg.MaxSize != "" {
+		requested, maximum := resource.MustParse(size), resource.MustParse(w.cfg.MaxSize)
+		if requested.Cmp(maximum) > 0 {
+			log.Printf("[Workspace] Tamanho %s solicitado por %s excede o máximo, usando %s", size, template.Name, w.cfg.MaxSize)
+			size = w.cfg.MaxSize
+		}
+	}
+
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+	now := time.Now().Format(time.RFC3339)
+	claims := w.lm.clientset.CoreV1().PersistentVolumeClaims(namespace)
+
+	claim, err := claims.Get(ctx, name, metav1.GetOptions{})
+	switch {
+	case err == nil:
+		// Workspace existente: apenas registrar o novo uso
+		if claim.Annotations == nil {
+			claim.Annotations = map[string]string{}
+		}
+		claim.Annotations[lastUsedAnnotation] = now
+		if _, err := claims.Update(ctx, claim, metav1.UpdateOptions{}); err != nil {
+			log.Printf("[Workspace] Erro ao atualizar último uso de %s/%s: %v", namespace, name, err)
+		}
+		log.Printf("[Workspace] Reutilizando workspace %s/%s do usuário %s", namespace, name, userID)
+	case errors.IsNotFound(err):
+		labels := map[string]string{
+			"app":  "girus-workspace",
+			"user": userID,
+		}
+		if w.cfg.Scope == "user-template" {
+			labels["template"] = template.Name
+		}
+		claim = &v1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   namespace,
+				Labels:      labels,
+				Annotations: map[string]string{lastUsedAnnotation: now},
+			},
+			Spec: v1.PersistentVolumeClaimSpec{
+				AccessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
+				Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{
+						v1.ResourceStorage: resource.MustParse(size),
+					},
+				},
+			},
+		}
+		if w.cfg.StorageClass != "" {
+			claim.Spec.StorageClassName = &w.cfg.StorageClass
+		}
+		if _, err := claims.Create(ctx, claim, metav1.CreateOptions{}); err != nil {
+			return v1.Volume{}, v1.VolumeMount{}, fmt.Errorf("erro ao criar workspace: %v", err)
+		}
+		log.Printf("[Workspace] Workspace %s/%s (%s) criado para o usuário %s", namespace, name, size, userID)
+	default:
+		return v1.Volume{}, v1.VolumeMount{}, fmt.Errorf("erro ao verificar workspace: %v", err)
+	}
+
+	volume := v1.Volume{
+		Name: workspaceVolumeName,
+		VolumeSource: v1.VolumeSource{
+			PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: name},
+		},
+	}
+	mount := v1.VolumeMount{Name: workspaceVolumeName, MountPath: mountPath}
+	return volume, mount, nil
+}
+
+// claimsInUse retorna os PVCs montados por pods ativos no namespace
+func (w *WorkspaceManager) claimsInUse(namespace string) (map[string]bool, error) {
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+	pods, err := w.lm.backend.ListLabs(ctx, namespace, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	inUse := make(map[string]bool)
+	for _, pod := range pods {
+		if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+			continue
+		}
+		for _, volume := range pod.Spec.Volumes {
+			if volume.PersistentVolumeClaim != nil {
+				inUse[volume.PersistentVolumeClaim.ClaimName] = true
+			}
+		}
+	}
+	return inUse, nil
+}
+
+// lastUsed retorna o último uso registrado do PVC, ou sua criação
+func lastUsed(claim *v1.PersistentVolumeClaim) time.Time {
+	if value, ok := claim.Annotations[lastUsedAnnotation]; ok {
+		if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+			return parsed
+		}
+	}
+	return claim.CreationTimestamp.Time
+}
+
+// retention retorna por quanto tempo um workspace sem uso é mantido (0 = indefinidamente)
+func (w *WorkspaceManager) retention() time.Duration {
+	return time.Duration(w.cfg.RetainDays) * 24 * time.Hour
+}
+
+// List retorna os workspaces do usuário
+func (w *WorkspaceManager) List(userID string) ([]WorkspaceInfo, error) {
+	namespace := workspaceNamespace(userID)
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+	claims, err := w.lm.clientset.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: "app=girus-workspace",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("erro ao listar workspaces: %v", err)
+	}
+	inUse, err := w.claimsInUse(namespace)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao verificar uso dos workspaces: %v", err)
+	}
+
+	workspaces := []WorkspaceInfo{}
+	for i := range claims.Items {
+		claim := &claims.Items[i]
+		storage := claim.Spec.Resources.Requests[v1.ResourceStorage]
+		info := WorkspaceInfo{
+			Name:      claim.Name,
+			Namespace: claim.Namespace,
+			Template:  claim.Labels["template"],
+			Size:      storage.String(),
+			Status:    string(claim.Status.Phase),
+			InUse:     inUse[claim.Name],
+			CreatedAt: claim.CreationTimestamp.Format(time.RFC3339),
+			LastUsed:  lastUsed(claim).Format(time.RFC3339),
+		}
+		if w.retention() > 0 && !info.InUse {
+			info.ExpiresAt = lastUsed(claim).Add(w.retention()).Format(time.RFC3339)
+		}
+		workspaces = append(workspaces, info)
+	}
+	sort.Slice(workspaces, func(i, j int) bool { return workspaces[i].Name < workspaces[j].Name })
+	return workspaces, nil
+}
+
+// Delete exclui um workspace do usuário que não esteja montado em um laboratório ativo
+func (w *WorkspaceManager) Delete(userID, name string) error {
+	namespace := workspaceNamespace(userID)
+	inUse, err := w.claimsInUse(namespace)
+	if err != nil {
+		return fmt.Errorf("erro ao verificar uso do workspace: %v", err)
+	}
+	if inUse[name] {
+		return errors.NewConflict(v1.Resource("persistentvolumeclaims"), name,
+			fmt.Errorf("workspace está em uso por um laboratório ativo"))
+	}
+
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+	claim, err := w.lm.clientset.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if claim.Labels["app"] != "girus-workspace" {
+		return errors.NewNotFound(v1.Resource("persistentvolumeclaims"), name)
+	}
+	if err := w.lm.clientset.CoreV1().PersistentVolumeClaims(namespace).Delete(ctx, name, metav1.DeleteOptions{}); err != nil {
+		return err
+	}
+	log.Printf("[Workspace] Workspace %s/%s excluído", namespace, name)
+	return nil
+}
+
+// Start inicia a remoção periódica de workspaces sem uso além do período de retenção
+func (w *WorkspaceManager) Start(ctx context.Context) {
+	if w.retention() <= 0 {
+		log.Printf("[Workspace] Retenção ilimitada, limpeza de workspaces desativada")
+		return
+	}
+	log.Printf("Iniciando limpeza de workspaces sem uso há mais de %d dias", w.cfg.RetainDays)
+
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+
+		w.cleanup()
+		for {
+			select {
+			case <-ticker.C:
+				w.cleanup()
+			case <-ctx.Done():
+				log.Printf("Limpeza de workspaces encerrada")
+				return
+			}
+		}
+	}()
+}
+
+// cleanup exclui os workspaces cujo período de retenção terminou
+func (w *WorkspaceManager) cleanup() {
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+	claims, err := w.lm.clientset.CoreV1().PersistentVolumeClaims("").List(ctx, metav1.ListOptions{
+		LabelSelector: "app=girus-workspace",
+	})
+	if err != nil {
+		log.Printf("[Workspace] Erro ao listar workspaces: %v", err)
+		return
+	}
+
+	now := time.Now()
+	removed := 0
+	for i := range claims.Items {
+		claim := &claims.Items[i]
+		if now.Sub(lastUsed(claim)) < w.retention() {
+			continue
+		}
+		inUse, err := w.claimsInUse(claim.Namespace)
+		if err != nil || inUse[claim.Name] {
+			continue
+		}
+		err = w.lm.clientset.CoreV1().PersistentVolumeClaims(claim.Namespace).Delete(ctx, claim.Name, metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			log.Printf("[Workspace] Erro ao excluir workspace expirado %s/%s: %v", claim.Namespace, claim.Name, err)
+			continue
+		}
+		removed++
+		log.Printf("[Workspace] Workspace %s/%s removido após %d dias sem uso", claim.Namespace, claim.Name, w.cfg.RetainDays)
+	}
+	if removed > 0 {
+		log.Printf("[Workspace] %d workspaces expirados removidos", removed)
+	}
+}